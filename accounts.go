@@ -0,0 +1,122 @@
+package oauthenticator
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+type selectedToken struct {
+	accounts Accounts
+}
+
+// SelectedToken returns a TokenPersistence that always refers to the token of
+// the currently selected account.
+func SelectedToken(accounts Accounts) TokenPersistence {
+	return &selectedToken{
+		accounts: accounts,
+	}
+}
+
+func (st *selectedToken) Token() (*oauth2.Token, error) {
+	account, err := st.accounts.Selected()
+	if err != nil {
+		return nil, err
+	}
+	return st.accounts.Token(account).Token()
+}
+
+func (st *selectedToken) SetToken(t *oauth2.Token) {
+	account, err := st.accounts.Selected()
+	if err != nil {
+		account = DefaultAccount
+	}
+	st.accounts.Token(account).SetToken(t)
+}
+
+// SelectedAccount returns the account to use when none is explicitly
+// selected: the default account if it exists, or the first one otherwise.
+func SelectedAccount(accounts []string) string {
+	for _, a := range accounts {
+		if a == DefaultAccount {
+			return a
+		}
+	}
+	if len(accounts) > 0 {
+		return accounts[0]
+	}
+	return DefaultAccount
+}
+
+// AccountName derives an account name from a token: the subject of the
+// id_token if present, DefaultAccount otherwise. The id_token is not
+// verified, the result is only suitable as a label.
+func AccountName(t *oauth2.Token) string {
+	claims, ok := idTokenClaims(t)
+	if !ok || claims.Subject == "" {
+		return DefaultAccount
+	}
+	return claims.Subject
+}
+
+type idClaims struct {
+	Subject string `json:"sub"`
+	Expiry  int64  `json:"exp"`
+}
+
+// idTokenClaims decodes the claims of the id_token of the token without
+// verifying it
+func idTokenClaims(t *oauth2.Token) (*idClaims, bool) {
+	if t == nil {
+		return nil, false
+	}
+	idtoken, _ := t.Extra("id_token").(string)
+	parts := strings.Split(idtoken, ".")
+	if len(parts) != 3 {
+		return nil, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, false
+	}
+	claims := &idClaims{}
+	if json.Unmarshal(payload, claims) != nil {
+		return nil, false
+	}
+	return claims, true
+}
+
+// ErrAccountRequired is returned by StoreToken if the token does not tell its
+// account, and the default account is taken already
+var ErrAccountRequired = errors.New("the token does not identify the account, an account name is required")
+
+// StoreToken saves a freshly obtained token as the given account and selects
+// it. If no account name is given, it is derived from the token. Tokens
+// without an id_token are stored as the default account, unless it exists
+// already. It returns the name of the account.
+func StoreToken(accounts Accounts, account string, token *oauth2.Token) (string, error) {
+	if account == "" {
+		claims, ok := idTokenClaims(token)
+		if ok && claims.Subject != "" {
+			account = claims.Subject
+		} else {
+			// tokens of different accounts can not be told apart, the
+			// first one is not overwritten
+			names, err := accounts.List()
+			if err != nil {
+				return "", err
+			}
+			for _, name := range names {
+				if name == DefaultAccount {
+					return "", ErrAccountRequired
+				}
+			}
+			account = DefaultAccount
+		}
+	}
+	accounts.Token(account).SetToken(token)
+	return account, accounts.Select(account)
+}
@@ -18,13 +18,20 @@ func Main(app Application) {
 	app.ParseFlags()
 	app.Init()
 
-	go app.Start()
+	done := make(chan struct{})
+	go func() {
+		app.Start()
+		close(done)
+	}()
 
 	// Setting up signal capturing
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt)
 
-	// Waiting for SIGINT (kill -2)
-	<-stop
+	// Waiting for SIGINT (kill -2) or for the application to finish
+	select {
+	case <-stop:
+	case <-done:
+	}
 	app.Stop()
 }
@@ -0,0 +1,28 @@
+package app
+
+import (
+	"flag"
+	"os"
+	"strings"
+)
+
+// FlagsFromEnv sets the flags from PREFIX_NAME environment variables, for
+// programs started by other tools without arguments. Flags given on the
+// command line take precedence.
+func FlagsFromEnv(prefix string) error {
+	var err error
+	flag.VisitAll(func(f *flag.Flag) {
+		if err != nil {
+			return
+		}
+		value, ok := os.LookupEnv(envName(prefix, f.Name))
+		if ok {
+			err = f.Value.Set(value)
+		}
+	})
+	return err
+}
+
+func envName(prefix string, name string) string {
+	return prefix + "_" + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
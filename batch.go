@@ -0,0 +1,30 @@
+package oauthenticator
+
+import (
+	"golang.org/x/oauth2"
+)
+
+// ConfigState is a config together with its details and tokens, as read by a
+// Batcher
+type ConfigState struct {
+	Config  Config
+	OAuth2  *oauth2.Config
+	Options []oauth2.AuthCodeOption
+	// Tokens holds the token of every account
+	Tokens map[string]*oauth2.Token
+	// Selected is the selected account as stored, it may not exist
+	Selected string
+}
+
+// Batcher is implemented by providers that can read all configs together with
+// their details and tokens in a single round trip
+type Batcher interface {
+	Batch() ([]ConfigState, error)
+}
+
+// BatchWriter is implemented by writable providers that can store several
+// configs at once. PutConfigs stores all of the definitions like PutConfig,
+// or none of them if it fails.
+type BatchWriter interface {
+	PutConfigs(definitions []ConfigDefinition) ([]Config, error)
+}
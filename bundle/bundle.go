@@ -0,0 +1,269 @@
+// Package bundle exports the configs and tokens of a provider to a portable
+// file and imports them into another provider.
+package bundle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+)
+
+// ErrConflict is returned by Import if configs of the bundle already exist and
+// the conflict policy is Fail
+var ErrConflict = errors.New("configs already exist")
+
+// Bundle holds configs together with their tokens
+type Bundle struct {
+	Configs []Entry `json:"configs"`
+}
+
+// Entry is a config of a bundle. Tokens are stored by account, serialized by
+// oauthenticator.MarshalToken.
+type Entry struct {
+	oauthenticator.ConfigDefinition
+	Selected string                     `json:"selected,omitempty"`
+	Tokens   map[string]json.RawMessage `json:"tokens,omitempty"`
+}
+
+// Policy tells what to do when importing a config that already exists
+type Policy string
+
+const (
+	// Fail aborts the import before writing anything
+	Fail Policy = "fail"
+	// Skip keeps the existing config and its tokens
+	Skip Policy = "skip"
+	// Replace replaces the existing config. Its tokens are kept, except for
+	// the accounts present in the bundle.
+	Replace Policy = "replace"
+)
+
+// ParsePolicy parses the name of a conflict policy
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case Fail, Skip, Replace:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown conflict policy: %s", name)
+}
+
+// Action is what Import did, or would do in a dry run, with a config
+type Action string
+
+const (
+	Created  Action = "created"
+	Replaced Action = "replaced"
+	Skipped  Action = "skipped"
+)
+
+// Change is the action taken on a config during import
+type Change struct {
+	Identifier string
+	Action     Action
+	Accounts   []string
+}
+
+type options struct {
+	redact bool
+	dryrun bool
+	policy Policy
+}
+
+// Option alters the behavior of Export and Import
+type Option func(*options)
+
+// Redact leaves client secrets and tokens out of exported bundles
+func Redact() Option {
+	return func(o *options) {
+		o.redact = true
+	}
+}
+
+// DryRun only reports the changes Import would make
+func DryRun() Option {
+	return func(o *options) {
+		o.dryrun = true
+	}
+}
+
+// OnConflict sets the policy for configs that already exist, Fail by default
+func OnConflict(policy Policy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
+}
+
+func apply(opts []Option) *options {
+	o := &options{
+		policy: Fail,
+	}
+	for _, option := range opts {
+		option(o)
+	}
+	return o
+}
+
+// Export reads all configs of the provider with the tokens of all accounts
+func Export(provider oauthenticator.Provider, opts ...Option) (*Bundle, error) {
+	o := apply(opts)
+	configs, err := provider.Configs()
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{}
+	for _, c := range configs {
+		entry := Entry{
+			ConfigDefinition: oauthenticator.Definition(c),
+		}
+		if o.redact {
+			entry.ClientSecret = ""
+			b.Configs = append(b.Configs, entry)
+			continue
+		}
+		err = entry.readTokens(c.Accounts())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Identifier(), err)
+		}
+		b.Configs = append(b.Configs, entry)
+	}
+	return b, nil
+}
+
+func (e *Entry) readTokens(accounts oauthenticator.Accounts) error {
+	names, err := accounts.List()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	e.Tokens = make(map[string]json.RawMessage)
+	for _, account := range names {
+		token, err := accounts.Token(account).Token()
+		if err != nil {
+			return err
+		}
+		if token == nil {
+			continue
+		}
+		data, err := oauthenticator.MarshalToken(token)
+		if err != nil {
+			return err
+		}
+		e.Tokens[account] = data
+	}
+	e.Selected, err = accounts.Selected()
+	return err
+}
+
+// Import writes the configs of the bundle and their tokens into the provider.
+// Configs without a client secret, e.g. exported with Redact, keep the
+// secret of the existing config when replacing it.
+func Import(provider oauthenticator.WritableProvider, b *Bundle, opts ...Option) ([]Change, error) {
+	o := apply(opts)
+	changes := make([]Change, len(b.Configs))
+	existing := make(map[string]oauthenticator.Config)
+	seen := make(map[string]bool)
+	var conflicts []string
+	for i, entry := range b.Configs {
+		if entry.Identifier == "" {
+			return nil, fmt.Errorf("config without identifier: %s", entry.Label)
+		}
+		if seen[entry.Identifier] {
+			return nil, fmt.Errorf("config listed twice: %s", entry.Identifier)
+		}
+		seen[entry.Identifier] = true
+		changes[i] = Change{
+			Identifier: entry.Identifier,
+			Action:     Created,
+		}
+		for account := range entry.Tokens {
+			changes[i].Accounts = append(changes[i].Accounts, account)
+		}
+		sort.Strings(changes[i].Accounts)
+
+		c, err := provider.Config(entry.Identifier)
+		if errors.Is(err, oauthenticator.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		existing[entry.Identifier] = c
+		switch o.policy {
+		case Skip:
+			changes[i].Action = Skipped
+			changes[i].Accounts = nil
+		case Replace:
+			changes[i].Action = Replaced
+		default:
+			conflicts = append(conflicts, entry.Identifier)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrConflict, strings.Join(conflicts, ", "))
+	}
+	if o.dryrun {
+		return changes, nil
+	}
+
+	var entries []*Entry
+	var definitions []oauthenticator.ConfigDefinition
+	for i := range b.Configs {
+		if changes[i].Action == Skipped {
+			continue
+		}
+		entry := &b.Configs[i]
+		definition := entry.ConfigDefinition
+		if c, ok := existing[entry.Identifier]; ok && definition.ClientSecret == "" {
+			definition.ClientSecret = c.Config().ClientSecret
+		}
+		entries = append(entries, entry)
+		definitions = append(definitions, definition)
+	}
+	configs, err := putConfigs(provider, definitions)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		err = entry.writeTokens(configs[i].Accounts())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", entry.Identifier, err)
+		}
+	}
+	return changes, nil
+}
+
+// putConfigs stores the definitions in one batch if the provider supports it
+func putConfigs(provider oauthenticator.WritableProvider, definitions []oauthenticator.ConfigDefinition) ([]oauthenticator.Config, error) {
+	if batch, ok := provider.(oauthenticator.BatchWriter); ok {
+		return batch.PutConfigs(definitions)
+	}
+	configs := make([]oauthenticator.Config, len(definitions))
+	for i, definition := range definitions {
+		c, err := provider.PutConfig(definition)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", definition.Identifier, err)
+		}
+		configs[i] = c
+	}
+	return configs, nil
+}
+
+func (e *Entry) writeTokens(accounts oauthenticator.Accounts) error {
+	for account, data := range e.Tokens {
+		token, err := oauthenticator.UnmarshalToken(data)
+		if err != nil {
+			return err
+		}
+		accounts.Token(account).SetToken(token)
+	}
+	if _, ok := e.Tokens[e.Selected]; ok {
+		return accounts.Select(e.Selected)
+	}
+	return nil
+}
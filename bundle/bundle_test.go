@@ -0,0 +1,216 @@
+package bundle_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/bundle"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+	"golang.org/x/oauth2"
+)
+
+// source has the test configs with two accounts of the mail config
+func source(t *testing.T) *memory.Provider {
+	p := memory.New(conformance.Configs()...)
+	c, err := p.Config("mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Accounts().Token(oauthenticator.DefaultAccount).SetToken(&oauth2.Token{AccessToken: "default", RefreshToken: "refresh"})
+	_, err = oauthenticator.StoreToken(c.Accounts(), "work", &oauth2.Token{AccessToken: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func change(changes []bundle.Change, identifier string) bundle.Change {
+	for _, c := range changes {
+		if c.Identifier == identifier {
+			return c
+		}
+	}
+	return bundle.Change{}
+}
+
+func checkMail(t *testing.T, p oauthenticator.Provider, secret string) {
+	c, err := p.Config("mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oauthenticator.Definition(c).ClientSecret != secret {
+		t.Fatal(oauthenticator.Definition(c))
+	}
+	token, err := c.Token().Token()
+	if err != nil || token == nil || token.AccessToken != "work" {
+		t.Fatal(token, err)
+	}
+	token, err = c.Accounts().Token(oauthenticator.DefaultAccount).Token()
+	if err != nil || token == nil || token.RefreshToken != "refresh" {
+		t.Fatal(token, err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []bundle.Format{bundle.JSON, bundle.JSONLD} {
+		t.Run(string(format), func(t *testing.T) {
+			b, err := bundle.Export(source(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			buf := &bytes.Buffer{}
+			err = bundle.Write(buf, b, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err = bundle.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			target := memory.New()
+			changes, err := bundle.Import(target, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(conformance.Configs()) {
+				t.Fatal(changes)
+			}
+			checkMail(t, target, conformance.Configs()[0].ClientSecret)
+			for _, definition := range conformance.Configs() {
+				c, err := target.Config(definition.Identifier)
+				if err != nil {
+					t.Fatal(err)
+				}
+				d := oauthenticator.Definition(c)
+				if d.Type != definition.Type || d.AuthURL != definition.AuthURL || len(d.Scopes) != len(definition.Scopes) || len(d.Params) != len(definition.Params) {
+					t.Fatal(d, definition)
+				}
+			}
+		})
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	b, err := bundle.Export(source(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := memory.New(conformance.Configs()[0])
+	definition := conformance.Configs()[0]
+	definition.Label = "changed"
+	_, err = target.PutConfig(definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = bundle.Import(target, b)
+	if !errors.Is(err, bundle.ErrConflict) {
+		t.Fatal(err)
+	}
+	if configs, _ := target.Configs(); len(configs) != 1 {
+		t.Fatal("configs written despite conflict")
+	}
+
+	changes, err := bundle.Import(target, b, bundle.OnConflict(bundle.Skip))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ := target.Config("mail")
+	if c.Label() != "changed" || change(changes, "mail").Action != bundle.Skipped {
+		t.Fatal(c.Label(), changes)
+	}
+
+	changes, err = bundle.Import(target, b, bundle.OnConflict(bundle.Replace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _ = target.Config("mail")
+	if c.Label() == "changed" || change(changes, "mail").Action != bundle.Replaced {
+		t.Fatal(c.Label(), changes)
+	}
+	checkMail(t, target, definition.ClientSecret)
+}
+
+func TestDryRun(t *testing.T) {
+	b, err := bundle.Export(source(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := memory.New()
+	changes, err := bundle.Import(target, b, bundle.DryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change(changes, "mail").Action != bundle.Created || len(change(changes, "mail").Accounts) != 2 {
+		t.Fatal(changes)
+	}
+	if configs, _ := target.Configs(); len(configs) != 0 {
+		t.Fatal("configs written in dry run")
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	b, err := bundle.Export(source(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Configs = append(b.Configs, b.Configs[0])
+	target := memory.New()
+	_, err = bundle.Import(target, b)
+	if err == nil {
+		t.Fatal("duplicate config accepted")
+	}
+	if configs, _ := target.Configs(); len(configs) != 0 {
+		t.Fatal("configs written despite duplicate")
+	}
+}
+
+// batchOnly fails single writes, so only batched imports succeed
+type batchOnly struct {
+	*memory.Provider
+}
+
+func (batchOnly) PutConfig(oauthenticator.ConfigDefinition) (oauthenticator.Config, error) {
+	return nil, errors.New("config written outside of a batch")
+}
+
+func TestBatch(t *testing.T) {
+	b, err := bundle.Export(source(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := batchOnly{memory.New()}
+	_, err = bundle.Import(target, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMail(t, target, conformance.Configs()[0].ClientSecret)
+}
+
+func TestRedact(t *testing.T) {
+	b, err := bundle.Export(source(t), bundle.Redact())
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	err = bundle.Write(buf, b, bundle.JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := conformance.Configs()[0].ClientSecret
+	if bytes.Contains(buf.Bytes(), []byte(secret)) || bytes.Contains(buf.Bytes(), []byte("refresh")) {
+		t.Fatal(buf.String())
+	}
+
+	// redacted secrets are kept on replace
+	target := source(t)
+	_, err = bundle.Import(target, b, bundle.OnConflict(bundle.Replace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMail(t, target, secret)
+}
@@ -0,0 +1,287 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+
+	"github.com/balazsgrill/oauthenticator"
+	sparqlpersistence "github.com/balazsgrill/oauthenticator/persistence/sparql"
+)
+
+// Format of a serialized bundle
+type Format string
+
+const (
+	JSON Format = "json"
+	// JSONLD describes configs and tokens in the vocabulary and graphs used
+	// by the SPARQL backend with its default options, so the bundle can be
+	// loaded into a repository as is. Configs are put in the ConfigGraph.
+	JSONLD Format = "jsonld"
+)
+
+// ConfigGraph is the graph configs are put in by JSON-LD bundles
+const ConfigGraph = "configs"
+
+// ParseFormat parses the name of a format
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(name); f {
+	case JSON, JSONLD:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format: %s", name)
+}
+
+// Write serializes the bundle in the given format
+func Write(w io.Writer, b *Bundle, format Format) error {
+	var document interface{} = b
+	if format == JSONLD {
+		var err error
+		document, err = toJSONLD(b)
+		if err != nil {
+			return err
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(document)
+}
+
+// Read parses a bundle written by Write in any of the formats
+func Read(r io.Reader) (*Bundle, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fields["@graph"]; ok {
+		document := &jsonldDocument{}
+		err = json.Unmarshal(data, document)
+		if err != nil {
+			return nil, err
+		}
+		return fromJSONLD(document)
+	}
+	b := &Bundle{}
+	err = json.Unmarshal(data, b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+var jsonldContext = map[string]interface{}{
+	"rdf":             "http://www.w3.org/1999/02/22-rdf-syntax-ns#",
+	"rdfs":            "http://www.w3.org/2000/01/rdf-schema#",
+	"dc":              "http://purl.org/dc/elements/1.1/",
+	"oauth":           sparqlpersistence.DefaultNamespace,
+	"Client":          "oauth:Client",
+	"identifier":      "dc:identifier",
+	"label":           "rdfs:label",
+	"value":           "rdf:value",
+	"clientid":        "oauth:clientID",
+	"clientsecret":    "oauth:clientSecret",
+	"redirecturl":     "oauth:redirectURL",
+	"endpoint":        "oauth:endpoint",
+	"authurl":         "oauth:authurl",
+	"tokenurl":        "oauth:tokenurl",
+	"scope":           "oauth:scope",
+	"param":           "oauth:param",
+	"token":           "oauth:token",
+	"account":         "oauth:account",
+	"selectedAccount": "oauth:selectedAccount",
+}
+
+type jsonldDocument struct {
+	Context interface{}   `json:"@context"`
+	Graph   []jsonldGraph `json:"@graph"`
+}
+
+type jsonldGraph struct {
+	ID    string          `json:"@id"`
+	Graph json.RawMessage `json:"@graph"`
+}
+
+// jsonldClient is a client in the config graph
+type jsonldClient struct {
+	ID           string         `json:"@id"`
+	Types        []string       `json:"@type"`
+	Identifier   string         `json:"identifier"`
+	Label        string         `json:"label"`
+	ClientID     string         `json:"clientid"`
+	ClientSecret string         `json:"clientsecret"`
+	RedirectURL  string         `json:"redirecturl"`
+	Endpoint     jsonldEndpoint `json:"endpoint"`
+	Scopes       []string       `json:"scope,omitempty"`
+	Params       []jsonldParam  `json:"param,omitempty"`
+}
+
+// jsonldTokens holds the tokens of a client in the token graph
+type jsonldTokens struct {
+	ID              string          `json:"@id"`
+	Token           string          `json:"token,omitempty"`
+	Accounts        []jsonldAccount `json:"account,omitempty"`
+	SelectedAccount string          `json:"selectedAccount,omitempty"`
+}
+
+type jsonldEndpoint struct {
+	AuthURL  string `json:"authurl"`
+	TokenURL string `json:"tokenurl"`
+}
+
+type jsonldParam struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type jsonldAccount struct {
+	ID    string `json:"@id"`
+	Label string `json:"label"`
+	Token string `json:"token"`
+}
+
+func toJSONLD(b *Bundle) (*jsonldDocument, error) {
+	clients := []jsonldClient{}
+	tokens := []jsonldTokens{}
+	for _, entry := range b.Configs {
+		iri, err := sparqlpersistence.ClientIRI(entry.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		id := iri.String()
+		client := jsonldClient{
+			ID:           id,
+			Types:        []string{"Client"},
+			Identifier:   entry.Identifier,
+			Label:        entry.Label,
+			ClientID:     entry.ClientID,
+			ClientSecret: entry.ClientSecret,
+			RedirectURL:  entry.RedirectURL,
+			Endpoint: jsonldEndpoint{
+				AuthURL:  entry.AuthURL,
+				TokenURL: entry.TokenURL,
+			},
+			Scopes: entry.Scopes,
+		}
+		if entry.Type != "" {
+			client.Types = append(client.Types, entry.Type)
+		}
+		var keys []string
+		for key := range entry.Params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			client.Params = append(client.Params, jsonldParam{Label: key, Value: entry.Params[key]})
+		}
+		clients = append(clients, client)
+
+		if len(entry.Tokens) == 0 {
+			continue
+		}
+		t := jsonldTokens{
+			ID:              id,
+			SelectedAccount: entry.Selected,
+		}
+		var accounts []string
+		for account := range entry.Tokens {
+			accounts = append(accounts, account)
+		}
+		sort.Strings(accounts)
+		for _, account := range accounts {
+			token := string(entry.Tokens[account])
+			if account == oauthenticator.DefaultAccount {
+				t.Token = token
+				continue
+			}
+			t.Accounts = append(t.Accounts, jsonldAccount{
+				ID:    id + "/accounts/" + url.PathEscape(account),
+				Label: account,
+				Token: token,
+			})
+		}
+		tokens = append(tokens, t)
+	}
+
+	configgraph, err := json.Marshal(clients)
+	if err != nil {
+		return nil, err
+	}
+	tokengraph, err := json.Marshal(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonldDocument{
+		Context: jsonldContext,
+		Graph: []jsonldGraph{
+			{ID: ConfigGraph, Graph: configgraph},
+			{ID: sparqlpersistence.DefaultTokenGraph, Graph: tokengraph},
+		},
+	}, nil
+}
+
+func fromJSONLD(document *jsonldDocument) (*Bundle, error) {
+	var clients []jsonldClient
+	var tokens []jsonldTokens
+	for _, graph := range document.Graph {
+		var err error
+		switch graph.ID {
+		case ConfigGraph:
+			err = json.Unmarshal(graph.Graph, &clients)
+		case sparqlpersistence.DefaultTokenGraph:
+			err = json.Unmarshal(graph.Graph, &tokens)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b := &Bundle{}
+	byID := make(map[string]int)
+	for _, client := range clients {
+		entry := Entry{}
+		entry.Identifier = client.Identifier
+		entry.Label = client.Label
+		entry.ClientID = client.ClientID
+		entry.ClientSecret = client.ClientSecret
+		entry.RedirectURL = client.RedirectURL
+		entry.AuthURL = client.Endpoint.AuthURL
+		entry.TokenURL = client.Endpoint.TokenURL
+		entry.Scopes = client.Scopes
+		for _, t := range client.Types {
+			if t != "Client" {
+				entry.Type = t
+			}
+		}
+		for _, param := range client.Params {
+			if entry.Params == nil {
+				entry.Params = make(map[string]string)
+			}
+			entry.Params[param.Label] = param.Value
+		}
+		byID[client.ID] = len(b.Configs)
+		b.Configs = append(b.Configs, entry)
+	}
+	for _, t := range tokens {
+		i, ok := byID[t.ID]
+		if !ok {
+			continue
+		}
+		entry := &b.Configs[i]
+		entry.Tokens = make(map[string]json.RawMessage)
+		if t.Token != "" {
+			entry.Tokens[oauthenticator.DefaultAccount] = json.RawMessage(t.Token)
+		}
+		for _, account := range t.Accounts {
+			entry.Tokens[account.Label] = json.RawMessage(account.Token)
+		}
+		entry.Selected = t.SelectedAccount
+	}
+	return b, nil
+}
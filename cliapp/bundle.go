@@ -0,0 +1,92 @@
+package cliapp
+
+import (
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/bundle"
+)
+
+func (m *MainApp) exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := fs.String("format", string(bundle.JSON), "Format of the file: json or jsonld. JSON-LD files can be loaded into a SPARQL repository")
+	redact := fs.Bool("redact", false, "Leave client secrets and tokens out")
+	rest, err := parse("export", fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	format, err := bundle.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	var options []bundle.Option
+	if *redact {
+		options = append(options, bundle.Redact())
+	}
+	b, err := bundle.Export(m.Provider, options...)
+	if err != nil {
+		return err
+	}
+	if rest[0] == "-" {
+		return bundle.Write(stdout, b, format)
+	}
+	f, err := os.OpenFile(rest[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	err = bundle.Write(f, b, format)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (m *MainApp) importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dryrun := fs.Bool("dryrun", false, "Only print the changes the import would make")
+	conflict := fs.String("conflict", string(bundle.Fail), "What to do when an imported config exists: fail, skip or replace")
+	rest, err := parse("import", fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	provider, ok := m.Provider.(oauthenticator.WritableProvider)
+	if !ok {
+		return errors.New("the source is read-only, import into a single database instead. JSON-LD exports can be loaded into a SPARQL repository directly")
+	}
+	policy, err := bundle.ParsePolicy(*conflict)
+	if err != nil {
+		return err
+	}
+	options := []bundle.Option{bundle.OnConflict(policy)}
+	if *dryrun {
+		options = append(options, bundle.DryRun())
+	}
+
+	var r io.Reader = os.Stdin
+	if rest[0] != "-" {
+		f, err := os.Open(rest[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	b, err := bundle.Read(r)
+	if err != nil {
+		return err
+	}
+	changes, err := bundle.Import(provider, b, options...)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{"ACTION", "ID", "ACCOUNTS"}}
+	for _, change := range changes {
+		rows = append(rows, []string{string(change.Action), change.Identifier, strings.Join(change.Accounts, ",")})
+	}
+	return m.print(rows, changes)
+}
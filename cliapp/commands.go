@@ -0,0 +1,353 @@
+package cliapp
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+type command struct {
+	usage string
+	run   func(m *MainApp, args []string) error
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"list":   {"List the configs and their accounts", (*MainApp).listCommand},
+		"status": {"Show the tokens of all accounts: status [config...]", (*MainApp).statusCommand},
+		"token":  {"Print a valid access token, refreshing it if needed: token [-a account] <config>", (*MainApp).tokenCommand},
+		"login":  {"Log in and store the token: login [-a account] <config>", (*MainApp).loginCommand},
+		"select": {"Select the account used by default: select <config> <account>", (*MainApp).selectCommand},
+		"refresh": {"Refresh the token even if it is still valid: refresh [-a account] <config>",
+			(*MainApp).refreshCommand},
+		"revoke": {"Revoke the token at the server if -url is given, and remove the account: revoke [-url revocation endpoint] [-keep] [-a account] <config>",
+			(*MainApp).revokeCommand},
+		"get": {"Get the URL with the token and print the response body: get [-a account] <config> <url>", (*MainApp).getCommand},
+		"request": {"Send a request with the token: request [-X method] [-H 'Name: value']... [-d data|@file|@-] [-o file] [-i] [-a account] <config> <url>",
+			(*MainApp).requestCommand},
+		"exec": {"Run a command with access tokens in environment variables: exec [-e NAME=config[@account]]... [-onrefresh none|restart|signal] [-signal HUP] [-envfile file] [-margin 1m] [config] [--] <command> [arguments]",
+			(*MainApp).execCommand},
+		"credential": {"Git credential helper returning access tokens as passwords: credential [-m host[/path]=config[@account]]... [-rules file] [-u username] <get|store|erase>",
+			(*MainApp).credentialCommand},
+		"kubernetes": {"Print the token as an ExecCredential for kubectl: kubernetes [-id] [-a account] <config>",
+			(*MainApp).kubernetesCommand},
+		"export": {"Export all configs and tokens: export [-format json|jsonld] [-redact] <file or ->", (*MainApp).exportCommand},
+		"import": {"Import configs and tokens into a database: import [-dryrun] [-conflict fail|skip|replace] <file or ->", (*MainApp).importCommand},
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// parse parses the flags of a command, checking the number of arguments
+func parse(name string, fs *flag.FlagSet, args []string, min, max int) ([]string, error) {
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() < min || fs.NArg() > max {
+		return nil, fmt.Errorf("usage: %s", commands[name].usage)
+	}
+	return fs.Args(), nil
+}
+
+// config looks up a config by identifier, or by label if it is unique
+func (m *MainApp) config(name string) (oauthenticator.Config, error) {
+	c, err := m.Provider.Config(name)
+	if err == nil || !errors.Is(err, oauthenticator.ErrNotFound) {
+		return c, err
+	}
+	configs, lerr := m.Provider.Configs()
+	if lerr != nil {
+		return nil, lerr
+	}
+	var found []oauthenticator.Config
+	for _, c := range configs {
+		if strings.EqualFold(c.Label(), name) {
+			found = append(found, c)
+		}
+	}
+	if len(found) > 1 {
+		return nil, fmt.Errorf("several configs are labelled %s, use the identifier", name)
+	}
+	if len(found) == 0 {
+		return nil, err
+	}
+	return found[0], nil
+}
+
+// account resolves the account given by the flag, the selected one if empty
+func account(c oauthenticator.Config, name string) (string, error) {
+	if name != "" {
+		return name, nil
+	}
+	return c.Accounts().Selected()
+}
+
+type configStatus struct {
+	Identifier string                         `json:"id"`
+	Label      string                         `json:"label"`
+	Type       string                         `json:"type,omitempty"`
+	Accounts   []oauthenticator.AccountStatus `json:"accounts"`
+}
+
+func statuses(configs []oauthenticator.Config) ([]configStatus, error) {
+	result := make([]configStatus, 0, len(configs))
+	for _, c := range configs {
+		accounts, err := oauthenticator.AccountStatuses(c)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Identifier(), err)
+		}
+		result = append(result, configStatus{
+			Identifier: c.Identifier(),
+			Label:      c.Label(),
+			Type:       c.Type(),
+			Accounts:   accounts,
+		})
+	}
+	return result, nil
+}
+
+func (m *MainApp) listCommand(args []string) error {
+	_, err := parse("list", flag.NewFlagSet("list", flag.ExitOnError), args, 0, 0)
+	if err != nil {
+		return err
+	}
+	configs, err := m.Provider.Configs()
+	if err != nil {
+		return err
+	}
+	result, err := statuses(configs)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{"ID", "LABEL", "TYPE", "ACCOUNTS"}}
+	for _, c := range result {
+		var accounts []string
+		for _, a := range c.Accounts {
+			if a.Selected {
+				accounts = append(accounts, "*"+a.Name)
+			} else {
+				accounts = append(accounts, a.Name)
+			}
+		}
+		rows = append(rows, []string{c.Identifier, c.Label, c.Type, strings.Join(accounts, ",")})
+	}
+	return m.print(rows, result)
+}
+
+func (m *MainApp) statusCommand(args []string) error {
+	names, err := parse("status", flag.NewFlagSet("status", flag.ExitOnError), args, 0, len(args))
+	if err != nil {
+		return err
+	}
+	var configs []oauthenticator.Config
+	if len(names) == 0 {
+		configs, err = m.Provider.Configs()
+		if err != nil {
+			return err
+		}
+	}
+	for _, name := range names {
+		c, err := m.config(name)
+		if err != nil {
+			return err
+		}
+		configs = append(configs, c)
+	}
+	result, err := statuses(configs)
+	if err != nil {
+		return err
+	}
+	rows := [][]string{{"ID", "ACCOUNT", "SELECTED", "STATUS", "EXPIRY", "MISSING SCOPES"}}
+	for _, c := range result {
+		for _, a := range c.Accounts {
+			selected := ""
+			if a.Selected {
+				selected = "*"
+			}
+			expiry := ""
+			if a.Expiry != nil {
+				expiry = a.Expiry.Local().Format(time.RFC3339)
+			}
+			rows = append(rows, []string{c.Identifier, a.Name, selected, a.Status, expiry, strings.Join(a.Missing, " ")})
+		}
+	}
+	return m.print(rows, result)
+}
+
+type tokenOutput struct {
+	Account     string     `json:"account"`
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type,omitempty"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+}
+
+func (m *MainApp) printToken(name string, token *oauth2.Token) error {
+	if m.Output == outputJSON {
+		output := &tokenOutput{
+			Account:     name,
+			AccessToken: token.AccessToken,
+			TokenType:   token.Type(),
+		}
+		if !token.Expiry.IsZero() {
+			output.Expiry = &token.Expiry
+		}
+		return m.print(nil, output)
+	}
+	fmt.Fprintln(stdout, token.AccessToken)
+	return nil
+}
+
+// configAccount parses the common arguments of commands working on an account
+func (m *MainApp) configAccount(name string, args []string) (oauthenticator.Config, string, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	accountName := fs.String("a", "", "Account to use, the selected account if empty")
+	rest, err := parse(name, fs, args, 1, 1)
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := m.config(rest[0])
+	if err != nil {
+		return nil, "", err
+	}
+	a, err := account(c, *accountName)
+	return c, a, err
+}
+
+func (m *MainApp) tokenCommand(args []string) error {
+	c, a, err := m.configAccount("token", args)
+	if err != nil {
+		return err
+	}
+	token, err := oauthenticator.RefreshingTokenSource(context.Background(), c.Config(), c.Accounts().Token(a)).Token()
+	if err != nil {
+		return err
+	}
+	return m.printToken(a, token)
+}
+
+func (m *MainApp) refreshCommand(args []string) error {
+	c, a, err := m.configAccount("refresh", args)
+	if err != nil {
+		return err
+	}
+	token, err := oauthenticator.Refresh(context.Background(), c.Config(), c.Accounts().Token(a))
+	if err != nil {
+		return err
+	}
+	if m.Output == outputJSON {
+		return m.printToken(a, token)
+	}
+	fmt.Fprintf(stdout, "Refreshed %s, valid until %s\n", a, token.Expiry.Local().Format(time.RFC3339))
+	return nil
+}
+
+func (m *MainApp) loginCommand(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	accountName := fs.String("a", "", "Account to store the token as, derived from the token if empty")
+	rest, err := parse("login", fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := m.config(rest[0])
+	if err != nil {
+		return err
+	}
+	return Login(c, *accountName)
+}
+
+func (m *MainApp) selectCommand(args []string) error {
+	rest, err := parse("select", flag.NewFlagSet("select", flag.ExitOnError), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	c, err := m.config(rest[0])
+	if err != nil {
+		return err
+	}
+	return c.Accounts().Select(rest[1])
+}
+
+func (m *MainApp) revokeCommand(args []string) error {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	accountName := fs.String("a", "", "Account to revoke, the selected account if empty")
+	endpoint := fs.String("url", "", "Revocation endpoint of the server (RFC 7009), the token is only removed locally if empty")
+	keep := fs.Bool("keep", false, "Keep the account after revoking its token at the server")
+	rest, err := parse("revoke", fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	c, err := m.config(rest[0])
+	if err != nil {
+		return err
+	}
+	a, err := account(c, *accountName)
+	if err != nil {
+		return err
+	}
+	if *endpoint != "" {
+		token, err := c.Accounts().Token(a).Token()
+		if err != nil {
+			return err
+		}
+		if token == nil {
+			return oauthenticator.ErrNoToken
+		}
+		err = revoke(c.Config(), *endpoint, token)
+		if err != nil {
+			return err
+		}
+	}
+	if *keep {
+		return nil
+	}
+	return c.Accounts().Remove(a)
+}
+
+// revoke revokes the refresh token, or the access token if there is none.
+// Revoking a refresh token revokes the access tokens issued with it.
+func revoke(config *oauth2.Config, endpoint string, token *oauth2.Token) error {
+	form := url.Values{}
+	if token.RefreshToken != "" {
+		form.Set("token", token.RefreshToken)
+		form.Set("token_type_hint", "refresh_token")
+	} else {
+		form.Set("token", token.AccessToken)
+		form.Set("token_type_hint", "access_token")
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(config.ClientID), url.QueryEscape(config.ClientSecret))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("revocation failed: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
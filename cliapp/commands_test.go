@@ -0,0 +1,128 @@
+package cliapp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+)
+
+// testApp returns an app over a config of the server with a token of the
+// account "user"
+func testApp(t *testing.T, auth *oauthtest.Server) *MainApp {
+	p := memory.New(oauthenticator.ConfigDefinition{
+		Identifier:  "test",
+		Label:       "Test",
+		ClientID:    "client",
+		AuthURL:     auth.Endpoint().AuthURL,
+		TokenURL:    auth.Endpoint().TokenURL,
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"openid"},
+	})
+	c, err := p.Config("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := c.Config()
+	redirect, err := auth.Authorize(config.AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := config.Exchange(context.Background(), redirect.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = oauthenticator.StoreToken(c.Accounts(), "", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &MainApp{
+		Provider: p,
+		Output:   outputTable,
+	}
+}
+
+// runCommand runs the command, returning its output
+func runCommand(m *MainApp, args ...string) (string, error) {
+	original := stdout
+	defer func() { stdout = original }()
+	buf := &bytes.Buffer{}
+	stdout = buf
+	err := commands[args[0]].run(m, args[1:])
+	return buf.String(), err
+}
+
+func run(t *testing.T, m *MainApp, args ...string) string {
+	out, err := runCommand(m, args...)
+	if err != nil {
+		t.Fatal(args, err)
+	}
+	return out
+}
+
+func TestListAndStatus(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+
+	out := run(t, m, "list")
+	if !strings.Contains(out, "ID") || !strings.Contains(out, "*user") {
+		t.Fatal(out)
+	}
+	out = run(t, m, "status", "Test")
+	if !strings.Contains(out, oauthenticator.StatusValid) {
+		t.Fatal(out)
+	}
+
+	m.Output = outputJSON
+	var result []configStatus
+	err := json.Unmarshal([]byte(run(t, m, "status")), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 || len(result[0].Accounts) != 1 || !result[0].Accounts[0].Selected {
+		t.Fatal(result)
+	}
+}
+
+func TestTokenAndRefresh(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+
+	first := strings.TrimSpace(run(t, m, "token", "test"))
+	if first == "" {
+		t.Fatal("no token printed")
+	}
+	run(t, m, "refresh", "-a", "user", "test")
+	second := strings.TrimSpace(run(t, m, "token", "test"))
+	if second == first {
+		t.Fatal("token not refreshed")
+	}
+
+	out := run(t, m, "get", "test", auth.URL+oauthtest.EndpointUserinfo)
+	if !strings.Contains(out, `"sub"`) {
+		t.Fatal(out)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+
+	run(t, m, "revoke", "-url", auth.URL+oauthtest.EndpointRevoke, "test")
+	if auth.Requests(oauthtest.EndpointRevoke) != 1 {
+		t.Fatal("token not revoked at the server")
+	}
+	c, _ := m.Provider.Config("test")
+	accounts, err := c.Accounts().List()
+	if err != nil || len(accounts) != 0 {
+		t.Fatal(accounts, err)
+	}
+}
@@ -0,0 +1,195 @@
+package cliapp
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+)
+
+// rule maps the URLs of a host, optionally below a path, to a config
+type rule struct {
+	host      string
+	path      string
+	reference string
+}
+
+// rules collects repeated -m flags
+type rules []rule
+
+func (r *rules) String() string {
+	result := make([]string, len(*r))
+	for i, rule := range *r {
+		result[i] = rule.String()
+	}
+	return strings.Join(result, ", ")
+}
+
+func (r *rules) Set(value string) error {
+	rule, err := parseRule(value)
+	if err != nil {
+		return err
+	}
+	*r = append(*r, rule)
+	return nil
+}
+
+func (r rule) String() string {
+	if r.path == "" {
+		return r.host + "=" + r.reference
+	}
+	return r.host + "/" + r.path + "=" + r.reference
+}
+
+// parseRule parses a host[/path]=config[@account] rule. The host may start
+// with *. to match its subdomains.
+func parseRule(value string) (rule, error) {
+	pattern, reference, ok := strings.Cut(strings.TrimSpace(value), "=")
+	if !ok || pattern == "" || reference == "" {
+		return rule{}, fmt.Errorf("expected host[/path]=config[@account]: %s", value)
+	}
+	host, path, _ := strings.Cut(pattern, "/")
+	return rule{
+		host:      strings.ToLower(host),
+		path:      strings.Trim(path, "/"),
+		reference: reference,
+	}, nil
+}
+
+// readRules reads the rules of a file, one per line. Empty lines and lines
+// starting with # are skipped.
+func readRules(path string) (rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var result rules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		err = result.Set(line)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, scanner.Err()
+}
+
+func (r rule) matches(host string, path string) bool {
+	host = strings.ToLower(host)
+	if strings.HasPrefix(r.host, "*.") {
+		if !strings.HasSuffix(host, r.host[1:]) {
+			return false
+		}
+	} else if host != r.host {
+		return false
+	}
+	path = strings.Trim(path, "/")
+	return r.path == "" || path == r.path || strings.HasPrefix(path, r.path+"/")
+}
+
+// match returns the most specific rule matching the host and path
+func (r rules) match(host string, path string) (rule, bool) {
+	var result rule
+	found := false
+	for _, rule := range r {
+		if !rule.matches(host, path) {
+			continue
+		}
+		if !found || len(rule.host)+len(rule.path) > len(result.host)+len(result.path) {
+			result = rule
+			found = true
+		}
+	}
+	return result, found
+}
+
+// readCredential reads the attributes of a credential helper request, ended by
+// an empty line or the end of the input
+func readCredential(r io.Reader) (map[string]string, error) {
+	result := map[string]string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid credential attribute: %s", line)
+		}
+		result[key] = value
+	}
+	return result, scanner.Err()
+}
+
+func (m *MainApp) credentialCommand(args []string) error {
+	fs := flag.NewFlagSet("credential", flag.ExitOnError)
+	var matching rules
+	fs.Var(&matching, "m", "Rule mapping URLs to a config as host[/path]=config[@account], can be repeated. The host may start with *. to match subdomains, paths require credential.useHttpPath")
+	rulesFile := fs.String("rules", "", "File with rules, one per line")
+	username := fs.String("u", "oauth2", "Username returned with the token")
+	rest, err := parse("credential", fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if *rulesFile != "" {
+		more, err := readRules(*rulesFile)
+		if err != nil {
+			return err
+		}
+		matching = append(matching, more...)
+	}
+	attributes, err := readCredential(stdin)
+	if err != nil {
+		return err
+	}
+
+	switch rest[0] {
+	case "get", "erase":
+	case "store":
+		// tokens are stored when they are obtained, not by git
+		return nil
+	default:
+		return fmt.Errorf("unknown credential operation: %s", rest[0])
+	}
+	r, ok := matching.match(attributes["host"], attributes["path"])
+	if !ok || attributes["protocol"] != "https" {
+		// git tries the next helper
+		return nil
+	}
+	b, err := m.resolve(attributes["host"], r.reference)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	if rest[0] == "erase" {
+		// the token was rejected, the next one is refreshed even if it
+		// did not expire yet
+		_, err = oauthenticator.Refresh(ctx, b.config, b.tp)
+		if err != nil {
+			log.Println(err)
+		}
+		return nil
+	}
+	token, err := oauthenticator.RefreshingTokenSource(ctx, b.config, b.tp).Token()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "username=%s\npassword=%s\n", *username, token.AccessToken)
+	if !token.Expiry.IsZero() {
+		fmt.Fprintf(stdout, "password_expiry_utc=%d\n", token.Expiry.Unix())
+	}
+	return nil
+}
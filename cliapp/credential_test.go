@@ -0,0 +1,75 @@
+package cliapp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+)
+
+// runCredential runs the credential command with the attributes as input
+func runCredential(t *testing.T, m *MainApp, input string, args ...string) string {
+	original := stdin
+	defer func() { stdin = original }()
+	stdin = strings.NewReader(input)
+	return run(t, m, append([]string{"credential"}, args...)...)
+}
+
+func TestRuleMatch(t *testing.T) {
+	var r rules
+	for _, value := range []string{"git.example.com=a", "git.example.com/org=b", "*.example.com=c"} {
+		err := r.Set(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []struct {
+		host, path, expected string
+	}{
+		{"git.example.com", "", "a"},
+		{"git.example.com", "other/repo.git", "a"},
+		{"git.example.com", "org/repo.git", "b"},
+		{"git.example.com", "organization/repo.git", "a"},
+		{"GIT.example.com", "org", "b"},
+		{"other.example.com", "org/repo.git", "c"},
+		{"example.com", "", ""},
+	} {
+		found, ok := r.match(c.host, c.path)
+		if found.reference != c.expected || ok != (c.expected != "") {
+			t.Error(c.host, c.path, found)
+		}
+	}
+}
+
+func TestCredential(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+
+	token := strings.TrimSpace(run(t, m, "token", "test"))
+	out := runCredential(t, m, "protocol=https\nhost=git.example.com\npath=org/repo.git\n\n", "-m", "git.example.com/org=Test@user", "get")
+	if !strings.Contains(out, "username=oauth2\n") || !strings.Contains(out, "password="+token+"\n") || !strings.Contains(out, "password_expiry_utc=") {
+		t.Fatal(out)
+	}
+
+	// unknown hosts are left to other helpers
+	out = runCredential(t, m, "protocol=https\nhost=other.example.com\n", "-m", "git.example.com=test", "get")
+	if out != "" {
+		t.Fatal(out)
+	}
+	out = runCredential(t, m, "protocol=http\nhost=git.example.com\n", "-m", "git.example.com=test", "get")
+	if out != "" {
+		t.Fatal(out)
+	}
+
+	// a rejected token is refreshed
+	requests := auth.Requests(oauthtest.EndpointToken)
+	runCredential(t, m, "protocol=https\nhost=git.example.com\nusername=oauth2\npassword="+token+"\n", "-m", "git.example.com=test", "erase")
+	if auth.Requests(oauthtest.EndpointToken) != requests+1 {
+		t.Fatal("token not refreshed")
+	}
+	out = runCredential(t, m, "protocol=https\nhost=git.example.com\n", "-m", "git.example.com=test", "-u", "x-access-token", "get")
+	if !strings.Contains(out, "username=x-access-token\n") || strings.Contains(out, token) {
+		t.Fatal(out)
+	}
+}
@@ -0,0 +1,166 @@
+package cliapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/app"
+)
+
+// errCredentialsNotFound is recognized by docker as a missing credential
+var errCredentialsNotFound = errors.New("credentials not found in native keychain")
+
+// dockerCredential is the credential format of docker credential helpers
+type dockerCredential struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+// DockerHelper is a docker credential helper returning access tokens of the
+// configs mapped to registries. As docker starts it without flags, they can
+// also be given as OAUTHENTICATOR_<FLAG> environment variables.
+type DockerHelper struct {
+	app.Sources
+	Rules     rules
+	RulesFile string
+	Username  string
+
+	Provider oauthenticator.Provider
+	action   string
+}
+
+func (d *DockerHelper) InitFlags() {
+	d.Sources.InitFlags()
+	flag.Var(&d.Rules, "m", "Rule mapping registries to a config as host[/path]=config[@account], can be repeated. The host may start with *. to match subdomains")
+	flag.StringVar(&d.RulesFile, "rules", "", "File with rules, one per line")
+	flag.StringVar(&d.Username, "u", "oauth2", "Username returned with the token")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] <get|store|erase|list>\n\nFlags, also read from OAUTHENTICATOR_<FLAG> environment variables:\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+}
+
+func (d *DockerHelper) ParseFlags() {
+	err := app.FlagsFromEnv("OAUTHENTICATOR")
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.Parse()
+	d.Sources.Check()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		log.Fatal("No action given")
+	}
+	d.action = flag.Arg(0)
+	if d.RulesFile != "" {
+		more, err := readRules(d.RulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		d.Rules = append(d.Rules, more...)
+	}
+}
+
+func (d *DockerHelper) Init() {
+	d.Provider = d.Sources.Provider()
+}
+
+func (d *DockerHelper) Stop() {
+	d.Sources.Close()
+}
+
+func (d *DockerHelper) Start() {
+	err := d.run(d.action, stdin)
+	if err != nil {
+		// docker reads the error from the standard output
+		fmt.Fprintln(stdout, err)
+		d.Stop()
+		os.Exit(1)
+	}
+}
+
+func (d *DockerHelper) run(action string, in io.Reader) error {
+	switch action {
+	case "get":
+		serverURL, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		return d.get(strings.TrimSpace(string(serverURL)))
+	case "store":
+		var credential dockerCredential
+		// tokens are stored when they are obtained, not by docker. Other
+		// registries are accepted too, docker would fail their login
+		// otherwise, get does not find their credentials.
+		return json.NewDecoder(in).Decode(&credential)
+	case "erase":
+		// logging out keeps the tokens, they are removed with the revoke
+		// command
+		_, err := io.Copy(io.Discard, in)
+		return err
+	case "list":
+		return d.list()
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+// match returns the rule of a registry given as a host or as a URL
+func (d *DockerHelper) match(serverURL string) (rule, bool) {
+	if !strings.Contains(serverURL, "://") {
+		serverURL = "https://" + serverURL
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return rule{}, false
+	}
+	return d.Rules.match(u.Host, u.Path)
+}
+
+func (d *DockerHelper) get(serverURL string) error {
+	r, ok := d.match(serverURL)
+	if !ok {
+		return errCredentialsNotFound
+	}
+	m := &MainApp{Provider: d.Provider}
+	b, err := m.resolve(serverURL, r.reference)
+	if err != nil {
+		return err
+	}
+	token, err := oauthenticator.RefreshingTokenSource(context.Background(), b.config, b.tp).Token()
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(stdout).Encode(&dockerCredential{
+		ServerURL: serverURL,
+		Username:  d.Username,
+		Secret:    token.AccessToken,
+	})
+}
+
+// list lists the registries of the rules, except the ones matching subdomains
+func (d *DockerHelper) list() error {
+	result := map[string]string{}
+	for _, r := range d.Rules {
+		if strings.HasPrefix(r.host, "*.") {
+			continue
+		}
+		serverURL := r.host
+		if r.path != "" {
+			serverURL += "/" + r.path
+		}
+		result[serverURL] = d.Username
+	}
+	return json.NewEncoder(stdout).Encode(result)
+}
@@ -0,0 +1,70 @@
+package cliapp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+)
+
+func TestDockerHelper(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+	d := &DockerHelper{Provider: m.Provider, Username: "oauth2"}
+	err := d.Rules.Set("registry.example.com=Test@user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := strings.TrimSpace(run(t, m, "token", "test"))
+
+	original := stdout
+	defer func() { stdout = original }()
+	for _, serverURL := range []string{"registry.example.com", "https://registry.example.com/v2/"} {
+		buf := &bytes.Buffer{}
+		stdout = buf
+		err = d.run("get", strings.NewReader(serverURL+"\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var credential dockerCredential
+		err = json.Unmarshal(buf.Bytes(), &credential)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if credential.ServerURL != serverURL || credential.Username != "oauth2" || credential.Secret != token {
+			t.Fatal(credential)
+		}
+	}
+
+	err = d.run("get", strings.NewReader("other.example.com"))
+	if !errors.Is(err, errCredentialsNotFound) {
+		t.Fatal(err)
+	}
+	err = d.run("store", strings.NewReader(`{"ServerURL":"registry.example.com","Username":"u","Secret":"s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// docker fails logins to unmapped registries if storing fails
+	err = d.run("store", strings.NewReader(`{"ServerURL":"other.example.com","Username":"u","Secret":"s"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = d.get("other.example.com")
+	if err != errCredentialsNotFound {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	stdout = buf
+	err = d.run("list", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(buf.String()) != `{"registry.example.com":"oauth2"}` {
+		t.Fatal(buf.String())
+	}
+}
@@ -0,0 +1,276 @@
+package cliapp
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// What to do with the child process of the exec command when tokens are
+// refreshed
+const (
+	onRefreshNone    = "none"
+	onRefreshRestart = "restart"
+	onRefreshSignal  = "signal"
+)
+
+// exitError makes the CLI exit with the given code
+type exitError struct {
+	code int
+}
+
+func (e *exitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
+
+// variables collects repeated -e flags
+type variables []string
+
+func (v *variables) String() string {
+	return strings.Join(*v, ", ")
+}
+
+func (v *variables) Set(value string) error {
+	name, config, ok := strings.Cut(value, "=")
+	if !ok || name == "" || config == "" {
+		return fmt.Errorf("expected NAME=config[@account]: %s", value)
+	}
+	*v = append(*v, value)
+	return nil
+}
+
+// binding is an environment variable holding the token of an account
+type binding struct {
+	name   string
+	config *oauth2.Config
+	tp     oauthenticator.TokenPersistence
+	token  *oauth2.Token
+	// failed is set if the token could not be refreshed, it is not tried again
+	failed bool
+}
+
+// resolve looks up the config and account of a config[@account] reference.
+// The config is taken as a whole first, as identifiers may contain @.
+func (m *MainApp) resolve(name string, reference string) (*binding, error) {
+	c, err := m.config(reference)
+	accountName := ""
+	if errors.Is(err, oauthenticator.ErrNotFound) {
+		if i := strings.LastIndex(reference, "@"); i >= 0 {
+			c, err = m.config(reference[:i])
+			accountName = reference[i+1:]
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	a, err := account(c, accountName)
+	if err != nil {
+		return nil, err
+	}
+	return &binding{
+		name:   name,
+		config: c.Config(),
+		tp:     c.Accounts().Token(a),
+	}, nil
+}
+
+func (m *MainApp) execCommand(args []string) error {
+	fs := flag.NewFlagSet("exec", flag.ExitOnError)
+	var vars variables
+	fs.Var(&vars, "e", "Environment variable to set to the access token as NAME=config[@account], can be repeated. Without it, the first argument is the config exposed as ACCESS_TOKEN")
+	onRefresh := fs.String("onrefresh", onRefreshNone, "What to do with the command when tokens are refreshed before expiry: none, restart or signal")
+	signalName := fs.String("signal", "HUP", "Signal sent to the command with -onrefresh signal")
+	envFile := fs.String("envfile", "", "File to write the variables to as NAME=value lines, rewritten when tokens are refreshed")
+	margin := fs.Duration("margin", time.Minute, "Time before expiry to refresh tokens at")
+	rest, err := parse("exec", fs, args, 1, len(args))
+	if err != nil {
+		return err
+	}
+	if len(vars) == 0 {
+		if len(rest) < 2 {
+			return fmt.Errorf("usage: %s", commands["exec"].usage)
+		}
+		vars = variables{"ACCESS_TOKEN=" + rest[0]}
+		rest = rest[1:]
+	}
+	switch *onRefresh {
+	case onRefreshNone, onRefreshRestart, onRefreshSignal:
+	default:
+		return fmt.Errorf("unknown -onrefresh action: %s", *onRefresh)
+	}
+	var sig os.Signal
+	if *onRefresh == onRefreshSignal {
+		sig, err = parseSignal(*signalName)
+		if err != nil {
+			return err
+		}
+	}
+
+	bindings := make([]*binding, len(vars))
+	for i, v := range vars {
+		name, reference, _ := strings.Cut(v, "=")
+		bindings[i], err = m.resolve(name, reference)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx := context.Background()
+	for {
+		for _, b := range bindings {
+			b.token, err = oauthenticator.RefreshingTokenSource(ctx, b.config, b.tp).Token()
+			if err != nil {
+				return fmt.Errorf("%s: %w", b.name, err)
+			}
+		}
+		err = writeEnvFile(*envFile, bindings)
+		if err != nil {
+			return err
+		}
+		cmd := exec.Command(rest[0], rest[1:]...)
+		cmd.Env = append(os.Environ(), environment(bindings)...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = stdout
+		cmd.Stderr = os.Stderr
+		err = cmd.Start()
+		if err != nil {
+			return err
+		}
+		m.setChild(cmd.Process)
+		done := make(chan error, 1)
+		go func() {
+			done <- cmd.Wait()
+		}()
+
+		restart, err := m.watch(ctx, bindings, done, cmd.Process, *onRefresh, sig, *envFile, *margin)
+		if err != nil || !restart {
+			return err
+		}
+	}
+}
+
+func (m *MainApp) setChild(process *os.Process) {
+	m.childLock.Lock()
+	defer m.childLock.Unlock()
+	m.child = process
+}
+
+// watch refreshes the tokens before they expire until the command exits. It
+// returns true if the command was stopped to be restarted.
+func (m *MainApp) watch(ctx context.Context, bindings []*binding, done chan error, process *os.Process, onRefresh string, sig os.Signal, envFile string, margin time.Duration) (bool, error) {
+	for {
+		var refresh <-chan time.Time
+		if onRefresh != onRefreshNone {
+			if wait, ok := nextRefresh(bindings, margin); ok {
+				refresh = time.After(wait)
+			}
+		}
+		select {
+		case err := <-done:
+			m.setChild(nil)
+			var exit *exec.ExitError
+			if errors.As(err, &exit) {
+				return false, &exitError{code: exit.ExitCode()}
+			}
+			return false, err
+		case <-refresh:
+		}
+
+		refreshed := false
+		for _, b := range bindings {
+			if b.failed || b.token.Expiry.IsZero() || time.Until(b.token.Expiry) > margin {
+				continue
+			}
+			token, err := oauthenticator.Refresh(ctx, b.config, b.tp)
+			if err != nil {
+				// the command keeps running with the old token
+				fmt.Fprintf(os.Stderr, "%s: %v\n", b.name, err)
+				b.failed = true
+				continue
+			}
+			b.token = token
+			refreshed = true
+		}
+		if !refreshed {
+			continue
+		}
+		err := writeEnvFile(envFile, bindings)
+		if err != nil {
+			return false, err
+		}
+		if onRefresh == onRefreshRestart {
+			err = terminate(process)
+			if err != nil {
+				return false, err
+			}
+			<-done
+			return true, nil
+		}
+		err = process.Signal(sig)
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// minRefreshWait is the shortest time between refreshes, so tokens issued
+// already expired are not refreshed in a loop
+const minRefreshWait = time.Second
+
+// nextRefresh returns the time until the first token has to be refreshed.
+// Tokens living shorter than the margin are refreshed at half of their
+// remaining lifetime, but not sooner than minRefreshWait.
+func nextRefresh(bindings []*binding, margin time.Duration) (time.Duration, bool) {
+	var result time.Duration
+	found := false
+	for _, b := range bindings {
+		if b.failed || b.token.Expiry.IsZero() || b.token.RefreshToken == "" {
+			continue
+		}
+		remaining := time.Until(b.token.Expiry)
+		wait := remaining - margin
+		if wait < remaining/2 {
+			wait = remaining / 2
+		}
+		if wait < minRefreshWait {
+			wait = minRefreshWait
+		}
+		if !found || wait < result {
+			result = wait
+			found = true
+		}
+	}
+	return result, found
+}
+
+func environment(bindings []*binding) []string {
+	result := make([]string, len(bindings))
+	for i, b := range bindings {
+		result[i] = b.name + "=" + b.token.AccessToken
+	}
+	sort.Strings(result)
+	return result
+}
+
+func writeEnvFile(path string, bindings []*binding) error {
+	if path == "" {
+		return nil
+	}
+	data := strings.Join(environment(bindings), "\n") + "\n"
+	// replace the file at once, so readers do not see partial content
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, []byte(data), 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
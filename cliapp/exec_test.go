@@ -0,0 +1,85 @@
+package cliapp
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"golang.org/x/oauth2"
+)
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+	envFile := filepath.Join(t.TempDir(), "env")
+
+	out, err := runCommand(m, "exec", "-e", "TOKEN=Test@user", "-envfile", envFile, "--", "sh", "-c", `echo "$TOKEN"; exit 3`)
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != 3 {
+		t.Fatal(err)
+	}
+	token := strings.TrimSpace(out)
+	if token == "" {
+		t.Fatal("no token passed")
+	}
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "TOKEN="+token+"\n" {
+		t.Fatal(string(data))
+	}
+
+	out = run(t, m, "exec", "test", "sh", "-c", `echo "$ACCESS_TOKEN"`)
+	if strings.TrimSpace(out) != token {
+		t.Fatal(out)
+	}
+}
+
+func TestExecRestart(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires sh")
+	}
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	auth.AccessTokenLifetime = 3 * time.Second
+	m := testApp(t, auth)
+	marker := filepath.Join(t.TempDir(), "marker")
+
+	// the first run waits to be restarted, the second one exits
+	script := `echo "$ACCESS_TOKEN"; if [ -f "$0" ]; then exit 3; fi; touch "$0"; exec sleep 10`
+	start := time.Now()
+	out, err := runCommand(m, "exec", "-onrefresh", "restart", "-margin", "2s", "test", "sh", "-c", script, marker)
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != 3 {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatal("not restarted before expiry")
+	}
+	tokens := strings.Fields(out)
+	if len(tokens) != 2 || tokens[0] == tokens[1] {
+		t.Fatal(out)
+	}
+}
+
+func TestNextRefreshExpired(t *testing.T) {
+	// a token issued already expired is not refreshed right away again
+	wait, ok := nextRefresh([]*binding{{token: &oauth2.Token{
+		AccessToken:  "expired",
+		RefreshToken: "refresh",
+		Expiry:       time.Now().Add(-time.Minute),
+	}}}, time.Minute)
+	if !ok || wait < minRefreshWait {
+		t.Fatal(wait, ok)
+	}
+}
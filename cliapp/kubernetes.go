@@ -0,0 +1,112 @@
+package cliapp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+)
+
+// Versions of the client.authentication.k8s.io API
+const (
+	execCredentialV1      = "client.authentication.k8s.io/v1"
+	execCredentialV1beta1 = "client.authentication.k8s.io/v1beta1"
+)
+
+// idTokenMargin is the time before expiry an id_token is refreshed at, so
+// that it does not expire while kubectl uses it
+const idTokenMargin = 10 * time.Second
+
+type execCredential struct {
+	APIVersion string                `json:"apiVersion"`
+	Kind       string                `json:"kind"`
+	Status     *execCredentialStatus `json:"status,omitempty"`
+}
+
+type execCredentialStatus struct {
+	Token               string `json:"token"`
+	ExpirationTimestamp string `json:"expirationTimestamp,omitempty"`
+}
+
+// execAPIVersion returns the API version kubectl expects, as given in the
+// KUBERNETES_EXEC_INFO environment variable
+func execAPIVersion() (string, error) {
+	info := os.Getenv("KUBERNETES_EXEC_INFO")
+	if info == "" {
+		return execCredentialV1, nil
+	}
+	var request execCredential
+	err := json.Unmarshal([]byte(info), &request)
+	if err != nil {
+		return "", fmt.Errorf("invalid KUBERNETES_EXEC_INFO: %w", err)
+	}
+	switch request.APIVersion {
+	case execCredentialV1, execCredentialV1beta1:
+		return request.APIVersion, nil
+	default:
+		return "", fmt.Errorf("unsupported API version: %s", request.APIVersion)
+	}
+}
+
+func (m *MainApp) kubernetesCommand(args []string) error {
+	fs := flag.NewFlagSet("kubernetes", flag.ExitOnError)
+	accountName := fs.String("a", "", "Account to use, the selected account if empty")
+	useID := fs.Bool("id", false, "Return the id_token instead of the access token, as required by OIDC authentication of the API server")
+	rest, err := parse("kubernetes", fs, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	version, err := execAPIVersion()
+	if err != nil {
+		return err
+	}
+	c, err := m.config(rest[0])
+	if err != nil {
+		return err
+	}
+	a, err := account(c, *accountName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	config := c.Config()
+	tp := c.Accounts().Token(a)
+	token, err := oauthenticator.RefreshingTokenSource(ctx, config, tp).Token()
+	if err != nil {
+		return err
+	}
+
+	status := &execCredentialStatus{
+		Token: token.AccessToken,
+	}
+	expiry := token.Expiry
+	if *useID {
+		idtoken, idexpiry, ok := oauthenticator.IDToken(token)
+		if !ok || (!idexpiry.IsZero() && time.Until(idexpiry) < idTokenMargin) {
+			// the id_token expires independently of the access token
+			token, err = oauthenticator.Refresh(ctx, config, tp)
+			if err != nil {
+				return err
+			}
+			idtoken, idexpiry, ok = oauthenticator.IDToken(token)
+		}
+		if !ok {
+			return errors.New("no id_token was issued with the token, the openid scope may be missing")
+		}
+		status.Token = idtoken
+		expiry = idexpiry
+	}
+	if !expiry.IsZero() {
+		status.ExpirationTimestamp = expiry.UTC().Format(time.RFC3339)
+	}
+	return json.NewEncoder(stdout).Encode(&execCredential{
+		APIVersion: version,
+		Kind:       "ExecCredential",
+		Status:     status,
+	})
+}
@@ -0,0 +1,46 @@
+package cliapp
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+)
+
+func TestKubernetes(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+	token := strings.TrimSpace(run(t, m, "token", "test"))
+
+	t.Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential","spec":{"interactive":false}}`)
+	var credential execCredential
+	err := json.Unmarshal([]byte(run(t, m, "kubernetes", "test")), &credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.APIVersion != execCredentialV1beta1 || credential.Kind != "ExecCredential" || credential.Status.Token != token {
+		t.Fatal(credential)
+	}
+	expiry, err := time.Parse(time.RFC3339, credential.Status.ExpirationTimestamp)
+	if err != nil || expiry.Before(time.Now()) {
+		t.Fatal(credential.Status.ExpirationTimestamp, err)
+	}
+
+	t.Setenv("KUBERNETES_EXEC_INFO", "")
+	err = json.Unmarshal([]byte(run(t, m, "kubernetes", "-id", "test")), &credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credential.APIVersion != execCredentialV1 || strings.Count(credential.Status.Token, ".") != 2 {
+		t.Fatal(credential)
+	}
+
+	t.Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v2"}`)
+	_, err = runCommand(m, "kubernetes", "test")
+	if err == nil {
+		t.Fatal("unknown version accepted")
+	}
+}
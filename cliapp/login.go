@@ -0,0 +1,151 @@
+package cliapp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/google/uuid"
+)
+
+// openURL presents the authorization URL to the user
+var openURL = func(authURL string) {
+	fmt.Fprintf(os.Stderr, "Open the following URL in a browser:\n%s\n", authURL)
+}
+
+// Login runs the authorization code flow of the config and stores the token
+// as the given account. If the redirect URL of the config points to the local
+// host, the redirect is received by a temporary listener, otherwise the user
+// has to paste the URL the browser was redirected to.
+func Login(c oauthenticator.Config, account string) error {
+	config := c.Config()
+	state := uuid.NewString()
+	redirect, err := url.Parse(config.RedirectURL)
+	if err != nil {
+		return err
+	}
+	wait := readRedirect
+	if isLoopback(redirect.Hostname()) {
+		// listen before the user could be redirected
+		wait, err = receiveRedirect(redirect)
+		if err != nil {
+			return err
+		}
+	}
+	openURL(config.AuthCodeURL(state, c.Options()...))
+	query, err := wait()
+	if err != nil {
+		return err
+	}
+
+	if query.Has("error") {
+		return fmt.Errorf("%s: %s", query.Get("error"), query.Get("error_description"))
+	}
+	if query.Get("state") != state {
+		return errors.New("invalid state")
+	}
+	token, err := config.Exchange(context.Background(), query.Get("code"), c.Options()...)
+	if err != nil {
+		return err
+	}
+	account, err = oauthenticator.StoreToken(c.Accounts(), account, token)
+	if errors.Is(err, oauthenticator.ErrAccountRequired) {
+		return fmt.Errorf("%w, give it with -a", err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Logged in as %s\n", account)
+	return nil
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loginTimeout is the time the user has to log in if the redirect is received
+// by a listener
+var loginTimeout = 5 * time.Minute
+
+// redirectResult is the query of the received redirect or the error of the
+// listener
+type redirectResult struct {
+	query url.Values
+	err   error
+}
+
+// receiveRedirect starts listening on the redirect URL, the returned function
+// waits for a single request and returns its query
+func receiveRedirect(redirect *url.URL) (func() (url.Values, error), error) {
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return nil, err
+	}
+	result := make(chan redirectResult, 1)
+	report := func(r redirectResult) {
+		select {
+		case result <- r:
+		default:
+		}
+	}
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != redirect.Path {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprint(w, "Login finished, this window can be closed.")
+			report(redirectResult{query: r.URL.Query()})
+		}),
+	}
+	go func() {
+		err := server.Serve(listener)
+		if err != http.ErrServerClosed {
+			report(redirectResult{err: err})
+		}
+	}()
+	return func() (url.Values, error) {
+		timer := time.NewTimer(loginTimeout)
+		defer timer.Stop()
+		var r redirectResult
+		select {
+		case r = <-result:
+		case <-timer.C:
+			r.err = errors.New("login timed out")
+		}
+		// the response is sent before the handler returns, shutting down
+		// waits for it
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+		return r.query, r.err
+	}, nil
+}
+
+// readRedirect reads the URL the browser was redirected to from the standard input
+func readRedirect() (url.Values, error) {
+	fmt.Fprint(os.Stderr, "Paste the URL the browser was redirected to: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	redirected, err := url.Parse(strings.TrimSpace(line))
+	if err != nil {
+		return nil, err
+	}
+	return redirected.Query(), nil
+}
@@ -0,0 +1,127 @@
+package cliapp
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"github.com/balazsgrill/oauthenticator/persistence/file"
+)
+
+// browse replaces openURL with a browser approving the authorization
+func browse(t *testing.T, auth *oauthtest.Server) {
+	original := openURL
+	t.Cleanup(func() { openURL = original })
+	openURL = func(authURL string) {
+		go func() {
+			redirect, err := auth.Authorize(authURL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp, err := http.Get(redirect.String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil || !strings.HasPrefix(string(body), "Login finished") {
+				t.Error(string(body), err)
+			}
+		}()
+	}
+}
+
+func loopbackConfig(t *testing.T, auth *oauthtest.Server) oauthenticator.Config {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirectURL := "http://" + listener.Addr().String() + "/callback"
+	listener.Close()
+
+	dir := t.TempDir()
+	data, err := json.Marshal(&file.Configdata{
+		ClientID: "client",
+		AuthURL:  auth.Endpoint().AuthURL,
+		TokenURL: auth.Endpoint().TokenURL,
+		Scopes:   []string{"openid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/test.json", data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := file.NewDirectory(dir, redirectURL).Config(dir + "/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLogin(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	browse(t, auth)
+	c := loopbackConfig(t, auth)
+
+	err := Login(c, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected, err := c.Accounts().Selected()
+	if err != nil || selected != "user" {
+		t.Fatal(selected, err)
+	}
+	token, err := c.Token().Token()
+	if err != nil || token == nil || token.AccessToken == "" {
+		t.Fatal(token, err)
+	}
+}
+
+func TestLoginDenied(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	browse(t, auth)
+	c := loopbackConfig(t, auth)
+
+	auth.FailNext(oauthtest.EndpointAuthorize, oauthtest.Error{Code: "access_denied"})
+	err := Login(c, "work")
+	if err == nil {
+		t.Fatal("denied login succeeded")
+	}
+	names, _ := c.Accounts().List()
+	if len(names) != 0 {
+		t.Fatal(names)
+	}
+}
+
+func TestLoginTimeout(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	c := loopbackConfig(t, auth)
+	original, originalTimeout := openURL, loginTimeout
+	t.Cleanup(func() { openURL, loginTimeout = original, originalTimeout })
+	openURL = func(string) {}
+	loginTimeout = 100 * time.Millisecond
+
+	err := Login(c, "")
+	if err == nil {
+		t.Fatal("login without redirect succeeded")
+	}
+	// the listener is closed
+	_, err = http.Get(c.Config().RedirectURL)
+	if err == nil {
+		t.Fatal("listener still open")
+	}
+}
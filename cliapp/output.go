@@ -0,0 +1,39 @@
+package cliapp
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+// stdout receives the output of commands
+var stdout io.Writer = os.Stdout
+
+// stdin is the input of commands reading data
+var stdin io.Reader = os.Stdin
+
+// print writes the rows as a table, or v as JSON depending on the output
+// format
+func (m *MainApp) print(rows [][]string, v interface{}) error {
+	if m.Output == outputJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(v)
+	}
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	for _, row := range rows {
+		_, err := w.Write([]byte(strings.Join(row, "\t") + "\n"))
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
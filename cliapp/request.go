@@ -0,0 +1,205 @@
+package cliapp
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// headers collects repeated -H flags
+type headers []string
+
+func (h *headers) String() string {
+	return strings.Join(*h, ", ")
+}
+
+func (h *headers) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("header without colon: %s", value)
+	}
+	*h = append(*h, value)
+	return nil
+}
+
+// request is an HTTP request of the request command
+type request struct {
+	method  string
+	url     string
+	headers headers
+	body    []byte
+	output  string
+	include bool
+}
+
+func (m *MainApp) requestCommand(args []string) error {
+	fs := flag.NewFlagSet("request", flag.ExitOnError)
+	r := &request{}
+	accountName := fs.String("a", "", "Account to use, the selected account if empty")
+	fs.StringVar(&r.method, "X", "", "Request method, GET or POST if data is given by default")
+	fs.Var(&r.headers, "H", "Request header as 'Name: value', can be repeated")
+	data := fs.String("d", "", "Request body, read from a file if starts with @, from standard input if @-")
+	fs.StringVar(&r.output, "o", "", "Write the response body to the file instead of standard output")
+	fs.BoolVar(&r.include, "i", false, "Include the response status and headers in the output")
+	rest, err := parse("request", fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	r.url = rest[1]
+	if *data != "" {
+		r.body, err = readData(*data)
+		if err != nil {
+			return err
+		}
+	}
+	if r.method == "" {
+		r.method = http.MethodGet
+		if r.body != nil {
+			r.method = http.MethodPost
+		}
+	}
+	return m.send(rest[0], *accountName, r)
+}
+
+func (m *MainApp) getCommand(args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	accountName := fs.String("a", "", "Account to use, the selected account if empty")
+	rest, err := parse("get", fs, args, 2, 2)
+	if err != nil {
+		return err
+	}
+	return m.send(rest[0], *accountName, &request{
+		method: http.MethodGet,
+		url:    rest[1],
+	})
+}
+
+// readData reads the request body given by the -d flag
+func readData(data string) ([]byte, error) {
+	if !strings.HasPrefix(data, "@") {
+		return []byte(data), nil
+	}
+	path := strings.TrimPrefix(data, "@")
+	if path == "-" {
+		return io.ReadAll(stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// send sends the request with the token of the account. If the server
+// rejects the token, it is refreshed and the request is sent once more.
+func (m *MainApp) send(name string, accountName string, r *request) error {
+	c, err := m.config(name)
+	if err != nil {
+		return err
+	}
+	a, err := account(c, accountName)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	config := c.Config()
+	tp := c.Accounts().Token(a)
+	client := &http.Client{
+		// the token source is not cached, so refreshed tokens are used
+		Transport: &oauth2.Transport{
+			Source: oauthenticator.RefreshingTokenSource(ctx, config, tp),
+		},
+	}
+
+	resp, err := r.do(client)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		_, err = oauthenticator.Refresh(ctx, config, tp)
+		if err != nil {
+			return fmt.Errorf("%s, refreshing the token failed: %w", resp.Status, err)
+		}
+		resp, err = r.do(client)
+		if err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+	return r.write(resp)
+}
+
+func (r *request) do(client *http.Client) (*http.Response, error) {
+	var body io.Reader
+	if r.body != nil {
+		body = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequest(r.method, r.url, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, header := range r.headers {
+		name, value, _ := strings.Cut(header, ":")
+		req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	if r.body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return client.Do(req)
+}
+
+// write writes the response to the output, returning an error for HTTP error
+// statuses
+func (r *request) write(resp *http.Response) error {
+	out := stdout
+	if r.output != "" {
+		f, err := os.Create(r.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if r.include {
+		err := writeHead(out, resp)
+		if err != nil {
+			return err
+		}
+	}
+	_, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// writeHead writes the status line and the headers of the response
+func writeHead(w io.Writer, resp *http.Response) error {
+	_, err := fmt.Fprintf(w, "%s %s\n", resp.Proto, resp.Status)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range resp.Header[name] {
+			_, err = fmt.Fprintf(w, "%s: %s\n", name, value)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
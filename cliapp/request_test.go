@@ -0,0 +1,84 @@
+package cliapp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+)
+
+func TestRequestRetry(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+
+	auth.ExpireAccessTokens()
+	requests := auth.Requests(oauthtest.EndpointToken)
+	out := run(t, m, "get", "test", auth.URL+oauthtest.EndpointUserinfo)
+	if !strings.Contains(out, `"sub"`) {
+		t.Fatal(out)
+	}
+	if auth.Requests(oauthtest.EndpointToken) != requests+1 {
+		t.Fatal("token not refreshed")
+	}
+
+	// the retry is only done once
+	auth.RevokeAll()
+	_, err := runCommand(m, "get", "test", auth.URL+oauthtest.EndpointUserinfo)
+	if err == nil {
+		t.Fatal("revoked token accepted")
+	}
+}
+
+func TestRequest(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	m := testApp(t, auth)
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Echo", r.Header.Get("X-Test"))
+		fmt.Fprintf(w, "%s %s", r.Method, body)
+	}))
+	defer echo.Close()
+
+	data := t.TempDir() + "/data"
+	err := os.WriteFile(data, []byte("payload"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := run(t, m, "request", "-X", "PUT", "-H", "X-Test: header", "-d", "@"+data, "-i", "test", echo.URL)
+	if !strings.Contains(out, "200 OK") || !strings.Contains(out, "X-Echo: header") || !strings.HasSuffix(out, "PUT payload") {
+		t.Fatal(out)
+	}
+
+	output := t.TempDir() + "/output"
+	out = run(t, m, "request", "-d", "form=1", "-o", output, "test", echo.URL)
+	written, _ := os.ReadFile(output)
+	if out != "" || string(written) != "POST form=1" {
+		t.Fatal(out, string(written))
+	}
+
+	out = run(t, m, "request", "-H", "X-Test: header", "-i", "-o", output, "test", echo.URL)
+	written, _ = os.ReadFile(output)
+	if out != "" || !strings.Contains(string(written), "X-Echo: header") || !strings.HasSuffix(string(written), "GET ") {
+		t.Fatal(out, string(written))
+	}
+
+	_, err = runCommand(m, "request", "test", echo.URL+"/missing")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,31 @@
+//go:build !windows
+
+package cliapp
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+var signals = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+func parseSignal(name string) (os.Signal, error) {
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal: %s", name)
+	}
+	return sig, nil
+}
+
+// terminate asks the process to exit
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,20 @@
+package cliapp
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+// parseSignal accepts KILL only, other signals can not be sent on Windows
+func parseSignal(name string) (os.Signal, error) {
+	if strings.TrimPrefix(strings.ToUpper(name), "SIG") == "KILL" {
+		return os.Kill, nil
+	}
+	return nil, errors.New("only KILL can be sent on Windows")
+}
+
+// terminate kills the process
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
@@ -2,7 +2,12 @@ package client
 
 import (
 	"context"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/balazsgrill/oauthenticator"
 	"golang.org/x/oauth2"
@@ -10,28 +15,166 @@ import (
 
 type Oauth2Client struct {
 	client          *http.Client
+	once            sync.Once
 	oauth           *oauth2.Config
 	TokenPersitence oauthenticator.TokenPersistence
+
+	transport http.RoundTripper
+	timeout   time.Duration
+	userAgent string
+	retries   int
+	backoff   time.Duration
+
+	// remote gets the tokens from a server instead of the persistence
+	remote *remoteSource
+	tokens *tokenTransport
+}
+
+type Option func(*Oauth2Client)
+
+// Transport sets the transport requests are sent with, http.DefaultTransport
+// by default
+func Transport(transport http.RoundTripper) Option {
+	return func(ms *Oauth2Client) {
+		ms.transport = transport
+	}
+}
+
+// Timeout limits the time of requests including reading the response body
+func Timeout(timeout time.Duration) Option {
+	return func(ms *Oauth2Client) {
+		ms.timeout = timeout
+	}
 }
 
-func New(oauth *oauth2.Config, tokenPersistence oauthenticator.TokenPersistence) *Oauth2Client {
-	return &Oauth2Client{
+// UserAgent sets the User-Agent header of requests that do not set one
+func UserAgent(userAgent string) Option {
+	return func(ms *Oauth2Client) {
+		ms.userAgent = userAgent
+	}
+}
+
+// Retry sends requests again up to the given times if the server responds
+// with 429 Too Many Requests or 503 Service Unavailable, or with another 5xx
+// status to a request of an idempotent method such as GET, PUT or DELETE. It
+// waits as long as the server asks with Retry-After, or backoff doubled with
+// each retry otherwise. Requests with bodies are only retried if they have
+// GetBody set.
+func Retry(retries int, backoff time.Duration) Option {
+	return func(ms *Oauth2Client) {
+		ms.retries = retries
+		ms.backoff = backoff
+	}
+}
+
+func New(oauth *oauth2.Config, tokenPersistence oauthenticator.TokenPersistence, options ...Option) *Oauth2Client {
+	ms := &Oauth2Client{
 		oauth:           oauth,
 		TokenPersitence: tokenPersistence,
 	}
+	for _, option := range options {
+		option(ms)
+	}
+	return ms
 }
 
 func (ms *Oauth2Client) GetClient() *http.Client {
-	if ms.client == nil {
-		// reset default client to prevent settings to be overwritten by other previously created http clients
-		http.DefaultClient = &http.Client{}
+	ms.once.Do(func() {
+		var base http.RoundTripper = ms.transport
+		if ms.userAgent != "" {
+			base = &userAgentTransport{
+				base:      base,
+				userAgent: ms.userAgent,
+			}
+		}
+		if ms.retries > 0 {
+			base = &retryTransport{
+				base:    base,
+				retries: ms.retries,
+				backoff: ms.backoff,
+			}
+		}
+		// tokens are requested with the same transport, timeout and retries,
+		// but without the token
+		tokenClient := &http.Client{
+			Transport: base,
+			Timeout:   ms.timeout,
+		}
+		ms.tokens = &tokenTransport{
+			base: base,
+		}
+		if ms.remote != nil {
+			ms.remote.client = tokenClient
+			ms.tokens.source = ms.remote
+			ms.tokens.renew = ms.remote.renew
+		} else {
+			ctx := context.WithValue(context.Background(), oauth2.HTTPClient, tokenClient)
+			stored := &storedSource{
+				ctx:    ctx,
+				config: ms.oauth,
+				tp:     ms.TokenPersitence,
+			}
+			ms.tokens.source = stored
+			ms.tokens.renew = stored.renew
+		}
+		ms.client = &http.Client{
+			// rejected tokens are renewed and the request is sent again
+			Transport: ms.tokens,
+			Timeout:   ms.timeout,
+		}
+	})
+	return ms.client
+}
 
-		ms.client = oauth2.NewClient(context.Background(), ms.TokenPersitence)
+// TokenSource returns the source of the tokens requests are sent with
+func (ms *Oauth2Client) TokenSource() oauth2.TokenSource {
+	ms.GetClient()
+	return ms.tokens
+}
+
+// Do sends the request with the token, in the context of the request
+func (ms *Oauth2Client) Do(req *http.Request) (*http.Response, error) {
+	return ms.GetClient().Do(req)
+}
+
+func (ms *Oauth2Client) send(ctx context.Context, method string, url string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
 	}
-	return ms.client
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return ms.Do(req)
+}
+
+// Get sends a GET request with the token, without a context. Use GetContext
+// to cancel the request.
+func (ms *Oauth2Client) Get(url string) (*http.Response, error) {
+	return ms.GetContext(context.Background(), url)
+}
+
+func (ms *Oauth2Client) GetContext(ctx context.Context, url string) (*http.Response, error) {
+	return ms.send(ctx, http.MethodGet, url, "", nil)
+}
+
+func (ms *Oauth2Client) PostContext(ctx context.Context, url string, contentType string, body io.Reader) (*http.Response, error) {
+	return ms.send(ctx, http.MethodPost, url, contentType, body)
+}
+
+// PostFormContext posts the URL encoded data
+func (ms *Oauth2Client) PostFormContext(ctx context.Context, url string, data url.Values) (*http.Response, error) {
+	return ms.PostContext(ctx, url, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
+func (ms *Oauth2Client) PutContext(ctx context.Context, url string, contentType string, body io.Reader) (*http.Response, error) {
+	return ms.send(ctx, http.MethodPut, url, contentType, body)
+}
+
+func (ms *Oauth2Client) PatchContext(ctx context.Context, url string, contentType string, body io.Reader) (*http.Response, error) {
+	return ms.send(ctx, http.MethodPatch, url, contentType, body)
 }
 
-func (ms *Oauth2Client) Get(request string) (resp *http.Response, err error) {
-	client := ms.GetClient()
-	return client.Get(request)
+func (ms *Oauth2Client) DeleteContext(ctx context.Context, url string) (*http.Response, error) {
+	return ms.send(ctx, http.MethodDelete, url, "", nil)
 }
@@ -0,0 +1,180 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/client"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"github.com/balazsgrill/oauthenticator/persistence/file"
+)
+
+// login returns a config of the server with a stored token
+func login(t *testing.T, auth *oauthtest.Server) oauthenticator.Config {
+	dir := t.TempDir()
+	data, err := json.Marshal(&file.Configdata{
+		ClientID: "client",
+		AuthURL:  auth.Endpoint().AuthURL,
+		TokenURL: auth.Endpoint().TokenURL,
+		Scopes:   []string{"profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/test.json", data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := file.NewDirectory(dir, "http://localhost/callback").Config(dir + "/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := auth.Authorize(c.Config().AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Config().Exchange(context.Background(), redirect.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token().SetToken(token)
+	return c
+}
+
+func TestGet(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	c := login(t, auth)
+
+	oc := client.New(c.Config(), c.Token())
+	resp, err := oc.Get(auth.URL + oauthtest.EndpointUserinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+
+	auth.RevokeAll()
+	resp, err = oc.Get(auth.URL + oauthtest.EndpointUserinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatal(resp.Status)
+	}
+}
+
+func TestMethods(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	c := login(t, auth)
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/slow" {
+			<-r.Context().Done()
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.Header.Get("User-Agent"), r.Header.Get("Content-Type"), body)
+	}))
+	defer api.Close()
+	oc := client.New(c.Config(), c.Token(), client.UserAgent("test/1.0"), client.Timeout(time.Second))
+	ctx := context.Background()
+
+	check := func(resp *http.Response, err error, expected string) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != expected {
+			t.Fatalf("expected %q, got %q", expected, body)
+		}
+	}
+	resp, err := oc.GetContext(ctx, api.URL)
+	check(resp, err, "GET test/1.0  ")
+	resp, err = oc.PostContext(ctx, api.URL, "text/plain", strings.NewReader("body"))
+	check(resp, err, "POST test/1.0 text/plain body")
+	resp, err = oc.PostFormContext(ctx, api.URL, url.Values{"a": {"b"}})
+	check(resp, err, "POST test/1.0 application/x-www-form-urlencoded a=b")
+	resp, err = oc.PutContext(ctx, api.URL, "text/plain", strings.NewReader("put"))
+	check(resp, err, "PUT test/1.0 text/plain put")
+	resp, err = oc.PatchContext(ctx, api.URL, "text/plain", strings.NewReader("patch"))
+	check(resp, err, "PATCH test/1.0 text/plain patch")
+	resp, err = oc.DeleteContext(ctx, api.URL)
+	check(resp, err, "DELETE test/1.0  ")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "custom")
+	resp, err = oc.Do(req)
+	check(resp, err, "GET custom  ")
+
+	cancelled, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = oc.GetContext(cancelled, api.URL+"/slow")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal(err)
+	}
+}
+
+// countingTransport counts the requests sent to each path
+type countingTransport struct {
+	lock     sync.Mutex
+	requests map[string]int
+}
+
+func (c *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.lock.Lock()
+	c.requests[req.URL.Path]++
+	c.lock.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestTransport(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	c := login(t, auth)
+	transport := &countingTransport{requests: map[string]int{}}
+	oc := client.New(c.Config(), c.Token(), client.Transport(transport))
+
+	token, err := c.Token().Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Expiry = time.Now().Add(-time.Minute)
+	c.Token().SetToken(token)
+	resp, err := oc.Get(auth.URL + oauthtest.EndpointUserinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+	// the token is refreshed with the transport too
+	if transport.requests[oauthtest.EndpointToken] != 1 || transport.requests[oauthtest.EndpointUserinfo] != 1 {
+		t.Fatal(transport.requests)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// remoteMargin is the time before expiry a token is requested again from the
+// server at, at most half of its lifetime
+const remoteMargin = time.Minute
+
+// remoteSource gets the tokens of a config from the token API of an
+// oauthenticator server, caching them until they are about to expire
+type remoteSource struct {
+	endpoint string
+	apiKey   string
+	id       string
+	account  string
+	client   *http.Client
+
+	lock    sync.Mutex
+	token   *oauth2.Token
+	renewAt time.Time
+}
+
+// NewRemote returns a client getting the tokens of the config from an
+// oauthenticator server started with API keys. The selected account is used
+// if account is empty.
+func NewRemote(serverURL string, apiKey string, id string, account string, options ...Option) *Oauth2Client {
+	ms := New(nil, nil, options...)
+	ms.remote = &remoteSource{
+		endpoint: strings.TrimSuffix(serverURL, "/") + "/api/token",
+		apiKey:   apiKey,
+		id:       id,
+		account:  account,
+		client:   http.DefaultClient,
+	}
+	return ms
+}
+
+func (s *remoteSource) Token() (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token != nil && (s.token.Expiry.IsZero() || time.Now().Before(s.renewAt)) {
+		return s.token, nil
+	}
+	return s.fetch("")
+}
+
+// renew asks the server to refresh the rejected token
+func (s *remoteSource) renew(rejected *oauth2.Token) (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.fetch(rejected.AccessToken)
+}
+
+func (s *remoteSource) fetch(rejected string) (*oauth2.Token, error) {
+	form := url.Values{}
+	form.Set("id", s.id)
+	if s.account != "" {
+		form.Set("account", s.account)
+	}
+	if rejected != "" {
+		form.Set("rejected", rejected)
+	}
+	req, err := http.NewRequest(http.MethodPost, s.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var result struct {
+			Error string `json:"error"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(body, &result) != nil || result.Error == "" {
+			result.Error = strings.TrimSpace(string(body))
+		}
+		return nil, fmt.Errorf("token request failed: %s %s", resp.Status, result.Error)
+	}
+	token := &oauth2.Token{}
+	err = json.NewDecoder(resp.Body).Decode(token)
+	if err != nil {
+		return nil, err
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed: no access token returned")
+	}
+	margin := time.Until(token.Expiry) / 2
+	if margin > remoteMargin {
+		margin = remoteMargin
+	}
+	s.token = token
+	s.renewAt = token.Expiry.Add(-margin)
+	return token, nil
+}
@@ -0,0 +1,101 @@
+package client_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/client"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+	"github.com/balazsgrill/oauthenticator/server"
+)
+
+func TestRemote(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	provider := memory.New(oauthenticator.ConfigDefinition{
+		Identifier:  "test",
+		Label:       "Test",
+		ClientID:    "client",
+		AuthURL:     auth.Endpoint().AuthURL,
+		TokenURL:    auth.Endpoint().TokenURL,
+		RedirectURL: "http://localhost/callback",
+		Scopes:      []string{"profile"},
+	})
+	c, err := provider.Config("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	redirect, err := auth.Authorize(c.Config().AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Config().Exchange(context.Background(), redirect.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = oauthenticator.StoreToken(c.Accounts(), "user", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	server.InitializeServer(mux, provider, nil, server.APIKeys("key"))
+	var lock sync.Mutex
+	tokenRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/token" {
+			lock.Lock()
+			tokenRequests++
+			lock.Unlock()
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+	ctx := context.Background()
+
+	oc := client.NewRemote(ts.URL, "key", "test", "")
+	for i := 0; i < 2; i++ {
+		resp, err := oc.GetContext(ctx, auth.URL+oauthtest.EndpointUserinfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatal(resp.Status)
+		}
+	}
+	// the token is cached until it is about to expire
+	if tokenRequests != 1 {
+		t.Fatal(tokenRequests)
+	}
+	remote, err := oc.TokenSource().Token()
+	if err != nil || remote.AccessToken != token.AccessToken {
+		t.Fatal(remote, err)
+	}
+
+	// rejected tokens are refreshed by the server
+	auth.ExpireAccessTokens()
+	resp, err := oc.GetContext(ctx, auth.URL+oauthtest.EndpointUserinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || tokenRequests != 2 {
+		t.Fatal(resp.Status, tokenRequests)
+	}
+	stored, err := c.Token().Token()
+	if err != nil || stored.AccessToken == token.AccessToken {
+		t.Fatal("refreshed token not stored by the server")
+	}
+
+	_, err = client.NewRemote(ts.URL, "wrong", "test", "").GetContext(ctx, auth.URL+oauthtest.EndpointUserinfo)
+	if err == nil || !strings.Contains(err.Error(), "invalid API key") {
+		t.Fatal(err)
+	}
+}
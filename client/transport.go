@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// userAgentTransport sets the User-Agent header of requests without one
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("User-Agent") != "" {
+		return base.RoundTrip(req)
+	}
+	// requests must not be modified by transports
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return base.RoundTrip(req)
+}
+
+// tokenTransport authorizes requests with the token of the source. If the
+// token is rejected before it expires, it is renewed and the request is sent
+// again. Tokens are cached by the source, so it decides when to renew them.
+type tokenTransport struct {
+	base   http.RoundTripper
+	source oauth2.TokenSource
+	// renew replaces a token rejected by the server
+	renew func(rejected *oauth2.Token) (*oauth2.Token, error)
+	lock  sync.Mutex
+}
+
+// Token returns the token in use
+func (t *tokenTransport) Token() (*oauth2.Token, error) {
+	return t.source.Token()
+}
+
+// refresh replaces the rejected token, unless it was replaced already
+func (t *tokenTransport) refresh(rejected *oauth2.Token) (*oauth2.Token, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	current, err := t.source.Token()
+	if err == nil && current.AccessToken != rejected.AccessToken {
+		return current, nil
+	}
+	return t.renew(rejected)
+}
+
+// storedSource gets the tokens of the persistence, refreshing them once
+// expired, and caches them while they are valid
+type storedSource struct {
+	ctx    context.Context
+	config *oauth2.Config
+	tp     oauthenticator.TokenPersistence
+
+	lock  sync.Mutex
+	token *oauth2.Token
+}
+
+func (s *storedSource) Token() (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.token.Valid() {
+		return s.token, nil
+	}
+	token, err := oauthenticator.RefreshingTokenSource(s.ctx, s.config, s.tp).Token()
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+// renew replaces the rejected token. A token stored by others in the meantime
+// is taken, otherwise it is refreshed.
+func (s *storedSource) renew(rejected *oauth2.Token) (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stored, err := s.tp.Token()
+	if err != nil || !stored.Valid() || stored.AccessToken == rejected.AccessToken {
+		stored, err = oauthenticator.Refresh(s.ctx, s.config, s.tp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.token = stored
+	return stored, nil
+}
+
+func (t *tokenTransport) send(req *http.Request, token *oauth2.Token) (*http.Response, error) {
+	// requests must not be modified by transports
+	req = req.Clone(req.Context())
+	token.SetAuthHeader(req)
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.send(req, token)
+	if err != nil || !rejected(resp) || !replayable(req) {
+		return resp, err
+	}
+	refreshed, err := t.refresh(token)
+	if err != nil {
+		// the rejection is more telling than the failed refresh
+		return resp, nil
+	}
+	discard(resp)
+	req, err = rewind(req)
+	if err != nil {
+		return nil, err
+	}
+	return t.send(req, refreshed)
+}
+
+// rejected tells if the server did not accept the token
+func rejected(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusUnauthorized ||
+		strings.Contains(resp.Header.Get("WWW-Authenticate"), `error="invalid_token"`)
+}
+
+// maxRetryAfter is the longest wait requested by a server that is honored,
+// the response is returned if it asks for more
+const maxRetryAfter = time.Minute
+
+// retryTransport sends requests again after a backoff, if the server is
+// overloaded or fails. The backoff doubles with each retry, unless the
+// server tells how long to wait with Retry-After.
+type retryTransport struct {
+	base    http.RoundTripper
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	backoff := t.backoff
+	for retry := 0; ; retry++ {
+		resp, err := base.RoundTrip(req)
+		if err != nil || retry >= t.retries || !replayable(req) || !retryable(req, resp) {
+			return resp, err
+		}
+		wait, ok := retryAfter(resp, time.Now())
+		if !ok {
+			wait = backoff
+		}
+		if wait > maxRetryAfter {
+			return resp, nil
+		}
+		discard(resp)
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		req, err = rewind(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryAfter returns the wait requested by the Retry-After header, given in
+// seconds or as a date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if date.Before(now) {
+		return 0, true
+	}
+	return date.Sub(now), true
+}
+
+// retryable tells if the response allows sending the request again. Servers
+// respond with 429 and 503 before processing the request, other server errors
+// may come after it had an effect, so they are only retried for idempotent
+// methods.
+func retryable(req *http.Request, resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	}
+	if resp.StatusCode < 500 {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// replayable tells if the body of the request can be sent again
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// rewind returns a copy of the request with a fresh body
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
+
+// discard reads a bit of the body of a response that is not returned, so the
+// connection can be reused
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+}
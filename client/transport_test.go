@@ -0,0 +1,152 @@
+package client_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator/client"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+)
+
+func TestRecover(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	c := login(t, auth)
+	oc := client.New(c.Config(), c.Token())
+	ctx := context.Background()
+	before, err := c.Token().Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the token is rejected before its expiry
+	auth.ExpireAccessTokens()
+	requests := auth.Requests(oauthtest.EndpointToken)
+	resp, err := oc.GetContext(ctx, auth.URL+oauthtest.EndpointUserinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+	if auth.Requests(oauthtest.EndpointToken) != requests+1 {
+		t.Fatal("token not refreshed")
+	}
+	after, err := c.Token().Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.AccessToken == before.AccessToken {
+		t.Fatal("refreshed token not stored")
+	}
+
+	// the body is sent again
+	var lock sync.Mutex
+	var bodies []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+	resp, err = oc.PostContext(ctx, api.URL, "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || strings.Join(bodies, ",") != "body,body" {
+		t.Fatal(resp.Status, bodies)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	c := login(t, auth)
+	var lock sync.Mutex
+	requests := map[string]int{}
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		lock.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		lock.Unlock()
+		switch {
+		case r.URL.Path == "/busy" && count < 3:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/failing" && count < 2:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.URL.Path == "/broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/limited":
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write(body)
+		}
+	}))
+	defer api.Close()
+	ctx := context.Background()
+
+	oc := client.New(c.Config(), c.Token(), client.Retry(3, 10*time.Millisecond))
+	resp, err := oc.PostContext(ctx, api.URL+"/busy", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "body" || requests["/busy"] != 3 {
+		t.Fatal(resp.Status, string(body), requests)
+	}
+	resp, err = oc.GetContext(ctx, api.URL+"/failing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests["/failing"] != 2 {
+		t.Fatal(resp.Status, requests)
+	}
+
+	// waits longer than a minute are left to the caller
+	resp, err = oc.GetContext(ctx, api.URL+"/limited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || requests["/limited"] != 1 {
+		t.Fatal(resp.Status, requests)
+	}
+
+	// other server errors may come after a POST had an effect
+	resp, err = oc.PostContext(ctx, api.URL+"/broken", "text/plain", strings.NewReader("body"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || requests["/broken"] != 1 {
+		t.Fatal(resp.Status, requests)
+	}
+
+	// requests are not retried by default
+	resp, err = client.New(c.Config(), c.Token()).GetContext(ctx, api.URL+"/broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || requests["/broken"] != 2 {
+		t.Fatal(resp.Status, requests)
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/balazsgrill/oauthenticator/app"
+	cliapp "github.com/balazsgrill/oauthenticator/cliapp"
+)
+
+func main() {
+	app.Main(&cliapp.DockerHelper{})
+}
@@ -0,0 +1,63 @@
+package oauthenticator
+
+import (
+	"net/url"
+
+	"golang.org/x/oauth2"
+)
+
+// ConfigDefinition describes a config independently of the backend storing it
+type ConfigDefinition struct {
+	Identifier   string            `json:"identifier"`
+	Type         string            `json:"type,omitempty"`
+	Label        string            `json:"label"`
+	ClientID     string            `json:"clientid"`
+	ClientSecret string            `json:"clientsecret"`
+	AuthURL      string            `json:"authurl"`
+	TokenURL     string            `json:"tokenurl"`
+	RedirectURL  string            `json:"redirecturl,omitempty"`
+	Scopes       []string          `json:"scopes,omitempty"`
+	Params       map[string]string `json:"params,omitempty"`
+}
+
+// Definition returns the definition of a config
+func Definition(c Config) ConfigDefinition {
+	config := c.Config()
+	return ConfigDefinition{
+		Identifier:   c.Identifier(),
+		Type:         c.Type(),
+		Label:        c.Label(),
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		AuthURL:      config.Endpoint.AuthURL,
+		TokenURL:     config.Endpoint.TokenURL,
+		RedirectURL:  config.RedirectURL,
+		Scopes:       config.Scopes,
+		Params:       AuthParams(c.Options()),
+	}
+}
+
+// AuthParams returns the parameters the options add to the authorization URL
+func AuthParams(options []oauth2.AuthCodeOption) map[string]string {
+	if len(options) == 0 {
+		return nil
+	}
+	config := &oauth2.Config{}
+	base, err := url.Parse(config.AuthCodeURL(""))
+	if err != nil {
+		return nil
+	}
+	extended, err := url.Parse(config.AuthCodeURL("", options...))
+	if err != nil {
+		return nil
+	}
+	defaults := base.Query()
+	result := make(map[string]string)
+	for key, values := range extended.Query() {
+		value := values[0]
+		if !defaults.Has(key) || defaults.Get(key) != value {
+			result[key] = value
+		}
+	}
+	return result
+}
@@ -1,15 +1,35 @@
 package oauthenticator
 
 import (
+	"errors"
+
 	"golang.org/x/oauth2"
 )
 
+// DefaultAccount is the name of the account holding tokens that were not
+// associated with a named account.
+const DefaultAccount = "default"
+
+// ErrNotFound is returned (possibly wrapped) by Provider.Config for unknown
+// identifiers.
+var ErrNotFound = errors.New("config not found")
+
 type TokenPersistence interface {
 	oauth2.TokenSource
 
 	SetToken(*oauth2.Token)
 }
 
+// Accounts holds the named tokens of a single config. One of the accounts is
+// selected, its token is the one returned by Config.Token().
+type Accounts interface {
+	List() ([]string, error)
+	Token(account string) TokenPersistence
+	Selected() (string, error)
+	Select(account string) error
+	Remove(account string) error
+}
+
 type Config interface {
 	Type() string
 	Identifier() string
@@ -17,11 +37,30 @@ type Config interface {
 	Config() *oauth2.Config
 	Endpoint() oauth2.Endpoint
 	Token() TokenPersistence
+	Accounts() Accounts
 	Options() []oauth2.AuthCodeOption
 }
 
+// Provider lists configs. Identifiers returned by Config.Identifier() can be
+// looked up with Config(identifier).
 type Provider interface {
 	Configs() ([]Config, error)
 	ConfigsOfType(ctype string) ([]Config, error)
 	Config(identifier string) (Config, error)
 }
+
+// TokenStore keeps tokens by config identifier, for providers that do not
+// store tokens themselves.
+type TokenStore interface {
+	Accounts(identifier string) Accounts
+}
+
+// WritableProvider is a Provider that can store configs. PutConfig creates or
+// replaces the config with the identifier of the definition, keeping its
+// tokens. RemoveConfig removes the config together with its tokens.
+type WritableProvider interface {
+	Provider
+
+	PutConfig(definition ConfigDefinition) (Config, error)
+	RemoveConfig(identifier string) error
+}
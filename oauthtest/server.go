@@ -0,0 +1,715 @@
+// Package oauthtest provides a local OAuth 2 authorization server for tests
+// and demos. It approves every authorization request without user
+// interaction, and can be scripted to fail requests or to expire tokens.
+package oauthtest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// Paths of the endpoints served
+const (
+	EndpointAuthorize  = "/authorize"
+	EndpointToken      = "/token"
+	EndpointRevoke     = "/revoke"
+	EndpointIntrospect = "/introspect"
+	EndpointDevice     = "/device"
+	EndpointUserinfo   = "/userinfo"
+	EndpointJWKS       = "/jwks"
+	EndpointDiscovery  = "/.well-known/openid-configuration"
+)
+
+// DeviceGrantType is the grant type of the device authorization grant (RFC 8628)
+const DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Client is a registered client
+type Client struct {
+	ID           string
+	Secret       string
+	RedirectURIs []string
+}
+
+// Error is an OAuth 2 error response
+type Error struct {
+	// Status is the HTTP status of the response, 400 if not set
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+type grant struct {
+	clientID      string
+	subject       string
+	scopes        []string
+	redirectURI   string
+	nonce         string
+	challenge     string
+	challengeType string
+	expiry        time.Time
+}
+
+func (g *grant) expired() bool {
+	return !g.expiry.IsZero() && time.Now().After(g.expiry)
+}
+
+type deviceGrant struct {
+	grant
+	userCode string
+	approved bool
+	denied   bool
+}
+
+// Server is a local authorization server. The exported fields may be changed
+// between requests.
+type Server struct {
+	*httptest.Server
+
+	// AccessTokenLifetime is the lifetime of issued access tokens, they do not
+	// expire if it is zero
+	AccessTokenLifetime time.Duration
+	// RefreshTokenLifetime is the lifetime of issued refresh tokens, they do
+	// not expire if it is zero
+	RefreshTokenLifetime time.Duration
+	// IssueRefreshTokens controls whether refresh tokens are issued
+	IssueRefreshTokens bool
+	// RotateRefreshTokens invalidates refresh tokens once used
+	RotateRefreshTokens bool
+	// AutoApproveDevice approves device authorizations without calling ApproveDevice
+	AutoApproveDevice bool
+	// Subject is the user logging in, unless given by the login_hint parameter
+	Subject string
+
+	lock          sync.Mutex
+	key           *rsa.PrivateKey
+	clients       map[string]Client
+	codes         map[string]*grant
+	accessTokens  map[string]*grant
+	refreshTokens map[string]*grant
+	devices       map[string]*deviceGrant
+	failures      map[string][]Error
+	requests      map[string]int
+}
+
+// NewServer starts an authorization server. Until clients are registered with
+// AddClient, any client is accepted. It has to be closed after use.
+func NewServer() *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		AccessTokenLifetime: time.Hour,
+		IssueRefreshTokens:  true,
+		AutoApproveDevice:   true,
+		Subject:             "user",
+		key:                 key,
+		clients:             make(map[string]Client),
+		codes:               make(map[string]*grant),
+		accessTokens:        make(map[string]*grant),
+		refreshTokens:       make(map[string]*grant),
+		devices:             make(map[string]*deviceGrant),
+		failures:            make(map[string][]Error),
+		requests:            make(map[string]int),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(EndpointAuthorize, s.count(EndpointAuthorize, s.authorize))
+	mux.HandleFunc(EndpointToken, s.count(EndpointToken, s.token))
+	mux.HandleFunc(EndpointRevoke, s.count(EndpointRevoke, s.revoke))
+	mux.HandleFunc(EndpointIntrospect, s.count(EndpointIntrospect, s.introspect))
+	mux.HandleFunc(EndpointDevice, s.count(EndpointDevice, s.device))
+	mux.HandleFunc(EndpointUserinfo, s.count(EndpointUserinfo, s.userinfo))
+	mux.HandleFunc(EndpointJWKS, s.count(EndpointJWKS, s.jwks))
+	mux.HandleFunc(EndpointDiscovery, s.count(EndpointDiscovery, s.discovery))
+	mux.HandleFunc("/.well-known/oauth-authorization-server", s.count(EndpointDiscovery, s.discovery))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AddClient registers a client. Once a client is registered, requests of
+// unknown clients are rejected.
+func (s *Server) AddClient(c Client) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clients[c.ID] = c
+}
+
+// FailNext makes the next request to the endpoint fail with the given error.
+// Several failures can be queued.
+func (s *Server) FailNext(endpoint string, err Error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.failures[endpoint] = append(s.failures[endpoint], err)
+}
+
+// Requests returns the number of requests served by the endpoint
+func (s *Server) Requests(endpoint string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.requests[endpoint]
+}
+
+// Endpoint returns the authorization and token URLs of the server. The auth
+// style is fixed so that scripted token failures are not retried.
+func (s *Server) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:   s.URL + EndpointAuthorize,
+		TokenURL:  s.URL + EndpointToken,
+		AuthStyle: oauth2.AuthStyleInHeader,
+	}
+}
+
+// Config returns a client config for the server
+func (s *Server) Config(clientID, clientSecret, redirectURL string, scopes ...string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Endpoint:     s.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+	}
+}
+
+// RevokeAll invalidates all issued access and refresh tokens
+func (s *Server) RevokeAll() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.accessTokens = make(map[string]*grant)
+	s.refreshTokens = make(map[string]*grant)
+}
+
+// ExpireAccessTokens invalidates all issued access tokens, refresh tokens
+// stay valid
+func (s *Server) ExpireAccessTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.accessTokens = make(map[string]*grant)
+}
+
+// ApproveDevice approves a pending device authorization identified by the
+// user code, logging in the given subject
+func (s *Server) ApproveDevice(userCode string, subject string) error {
+	return s.decideDevice(userCode, func(d *deviceGrant) {
+		d.approved = true
+		d.subject = subject
+	})
+}
+
+// DenyDevice denies a pending device authorization identified by the user code
+func (s *Server) DenyDevice(userCode string) error {
+	return s.decideDevice(userCode, func(d *deviceGrant) {
+		d.denied = true
+	})
+}
+
+func (s *Server) decideDevice(userCode string, decide func(*deviceGrant)) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, d := range s.devices {
+		if d.userCode == userCode {
+			decide(d)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown user code: %s", userCode)
+}
+
+// Authorize performs the browser part of the authorization code flow: it
+// requests the authorization URL and returns the URL it redirects to, without
+// following it.
+func (s *Server) Authorize(authURL string) (*url.URL, error) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, fmt.Errorf("authorization failed: %s", resp.Status)
+	}
+	return resp.Location()
+}
+
+func (s *Server) count(endpoint string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests[endpoint]++
+		s.lock.Unlock()
+		handler(w, r)
+	}
+}
+
+// nextFailure returns the next scripted failure of an endpoint
+func (s *Server) nextFailure(endpoint string) (Error, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	queue := s.failures[endpoint]
+	if len(queue) == 0 {
+		return Error{}, false
+	}
+	s.failures[endpoint] = queue[1:]
+	return queue[0], true
+}
+
+func randomString() string {
+	data := make([]byte, 24)
+	_, err := rand.Read(data)
+	if err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, e Error) {
+	status := e.Status
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+	body := map[string]string{"error": e.Code}
+	if e.Description != "" {
+		body["error_description"] = e.Description
+	}
+	writeJSON(w, status, body)
+}
+
+// authenticateClient checks the client credentials of a request, given
+// either with basic authentication or as form parameters
+func (s *Server) authenticateClient(r *http.Request) (string, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.clients) == 0 {
+		if id == "" {
+			return "", Error{Status: http.StatusUnauthorized, Code: "invalid_client", Description: "client is not authenticated"}
+		}
+		return id, nil
+	}
+	c, known := s.clients[id]
+	if !known || c.Secret != secret {
+		return "", Error{Status: http.StatusUnauthorized, Code: "invalid_client", Description: "client authentication failed"}
+	}
+	return id, nil
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	clientID := query.Get("client_id")
+	redirectURI := query.Get("redirect_uri")
+
+	s.lock.Lock()
+	c, known := s.clients[clientID]
+	checkClient := len(s.clients) > 0
+	s.lock.Unlock()
+	if checkClient {
+		if !known {
+			http.Error(w, "unknown client", http.StatusBadRequest)
+			return
+		}
+		if redirectURI == "" && len(c.RedirectURIs) > 0 {
+			redirectURI = c.RedirectURIs[0]
+		}
+		registered := false
+		for _, uri := range c.RedirectURIs {
+			registered = registered || uri == redirectURI
+		}
+		if !registered {
+			http.Error(w, "redirect URI is not registered", http.StatusBadRequest)
+			return
+		}
+	}
+	target, err := url.Parse(redirectURI)
+	if err != nil || redirectURI == "" {
+		http.Error(w, "invalid redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	if state := query.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	if e, fail := s.nextFailure(EndpointAuthorize); fail {
+		params.Set("error", e.Code)
+		if e.Description != "" {
+			params.Set("error_description", e.Description)
+		}
+	} else if query.Get("response_type") != "code" {
+		params.Set("error", "unsupported_response_type")
+	} else {
+		subject := query.Get("login_hint")
+		if subject == "" {
+			subject = s.Subject
+		}
+		code := randomString()
+		s.lock.Lock()
+		s.codes[code] = &grant{
+			clientID:      clientID,
+			subject:       subject,
+			scopes:        strings.Fields(query.Get("scope")),
+			redirectURI:   query.Get("redirect_uri"),
+			nonce:         query.Get("nonce"),
+			challenge:     query.Get("code_challenge"),
+			challengeType: query.Get("code_challenge_method"),
+			expiry:        time.Now().Add(time.Minute),
+		}
+		s.lock.Unlock()
+		params.Set("code", code)
+	}
+
+	redirect := *target
+	q := redirect.Query()
+	for key, values := range params {
+		q[key] = values
+	}
+	redirect.RawQuery = q.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, Error{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if e, fail := s.nextFailure(EndpointToken); fail {
+		writeError(w, e)
+		return
+	}
+	clientID, err := s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err.(Error))
+		return
+	}
+
+	var g *grant
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		g, err = s.redeemCode(clientID, r.PostForm)
+	case "refresh_token":
+		g, err = s.redeemRefreshToken(clientID, r.PostForm)
+	case DeviceGrantType:
+		g, err = s.redeemDeviceCode(clientID, r.PostForm)
+	case "client_credentials":
+		g = &grant{
+			clientID: clientID,
+			subject:  clientID,
+			scopes:   strings.Fields(r.PostForm.Get("scope")),
+		}
+	default:
+		err = Error{Code: "unsupported_grant_type"}
+	}
+	if err != nil {
+		writeError(w, err.(Error))
+		return
+	}
+
+	response, err := s.issue(g)
+	if err != nil {
+		writeError(w, Error{Status: http.StatusInternalServerError, Code: "server_error", Description: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) redeemCode(clientID string, form url.Values) (*grant, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	code := form.Get("code")
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	if !ok || g.expired() || g.clientID != clientID {
+		return nil, Error{Code: "invalid_grant", Description: "invalid authorization code"}
+	}
+	if g.redirectURI != form.Get("redirect_uri") {
+		return nil, Error{Code: "invalid_grant", Description: "redirect URI mismatch"}
+	}
+	if g.challenge != "" {
+		verifier := form.Get("code_verifier")
+		if g.challengeType == "S256" {
+			digest := sha256.Sum256([]byte(verifier))
+			verifier = base64.RawURLEncoding.EncodeToString(digest[:])
+		}
+		if verifier != g.challenge {
+			return nil, Error{Code: "invalid_grant", Description: "code verifier mismatch"}
+		}
+	}
+	return g, nil
+}
+
+func (s *Server) redeemRefreshToken(clientID string, form url.Values) (*grant, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	refreshToken := form.Get("refresh_token")
+	g, ok := s.refreshTokens[refreshToken]
+	if !ok || g.expired() || g.clientID != clientID {
+		return nil, Error{Code: "invalid_grant", Description: "invalid refresh token"}
+	}
+	if s.RotateRefreshTokens {
+		delete(s.refreshTokens, refreshToken)
+	}
+	result := *g
+	if scope := form.Get("scope"); scope != "" {
+		result.scopes = strings.Fields(scope)
+	}
+	return &result, nil
+}
+
+func (s *Server) redeemDeviceCode(clientID string, form url.Values) (*grant, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deviceCode := form.Get("device_code")
+	d, ok := s.devices[deviceCode]
+	switch {
+	case !ok || d.clientID != clientID:
+		return nil, Error{Code: "invalid_grant", Description: "invalid device code"}
+	case d.expired():
+		delete(s.devices, deviceCode)
+		return nil, Error{Code: "expired_token"}
+	case d.denied:
+		delete(s.devices, deviceCode)
+		return nil, Error{Code: "access_denied"}
+	case !d.approved && !s.AutoApproveDevice:
+		return nil, Error{Code: "authorization_pending"}
+	}
+	delete(s.devices, deviceCode)
+	return &d.grant, nil
+}
+
+// issue creates the token response of a grant
+func (s *Server) issue(g *grant) (map[string]interface{}, error) {
+	now := time.Now()
+	accessToken := randomString()
+	access := *g
+	access.expiry = time.Time{}
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+	}
+	if s.AccessTokenLifetime > 0 {
+		access.expiry = now.Add(s.AccessTokenLifetime)
+		response["expires_in"] = int(s.AccessTokenLifetime.Seconds())
+	}
+	if len(g.scopes) > 0 {
+		response["scope"] = strings.Join(g.scopes, " ")
+	}
+	for _, scope := range g.scopes {
+		if scope != "openid" {
+			continue
+		}
+		claims := map[string]interface{}{
+			"iss": s.URL,
+			"sub": g.subject,
+			"aud": g.clientID,
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}
+		if g.nonce != "" {
+			claims["nonce"] = g.nonce
+		}
+		idtoken, err := signJWT(s.key, claims)
+		if err != nil {
+			return nil, err
+		}
+		response["id_token"] = idtoken
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.accessTokens[accessToken] = &access
+	if s.IssueRefreshTokens {
+		refreshToken := randomString()
+		refresh := *g
+		refresh.expiry = time.Time{}
+		if s.RefreshTokenLifetime > 0 {
+			refresh.expiry = now.Add(s.RefreshTokenLifetime)
+		}
+		s.refreshTokens[refreshToken] = &refresh
+		response["refresh_token"] = refreshToken
+	}
+	return response, nil
+}
+
+func (s *Server) revoke(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, Error{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if e, fail := s.nextFailure(EndpointRevoke); fail {
+		writeError(w, e)
+		return
+	}
+	_, err = s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err.(Error))
+		return
+	}
+	token := r.PostForm.Get("token")
+	s.lock.Lock()
+	delete(s.accessTokens, token)
+	delete(s.refreshTokens, token)
+	s.lock.Unlock()
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) introspect(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, Error{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if e, fail := s.nextFailure(EndpointIntrospect); fail {
+		writeError(w, e)
+		return
+	}
+	_, err = s.authenticateClient(r)
+	if err != nil {
+		writeError(w, err.(Error))
+		return
+	}
+	token := r.PostForm.Get("token")
+	s.lock.Lock()
+	g, ok := s.accessTokens[token]
+	tokenType := "access_token"
+	if !ok {
+		g, ok = s.refreshTokens[token]
+		tokenType = "refresh_token"
+	}
+	s.lock.Unlock()
+	if !ok || g.expired() {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+		return
+	}
+	response := map[string]interface{}{
+		"active":          true,
+		"client_id":       g.clientID,
+		"sub":             g.subject,
+		"scope":           strings.Join(g.scopes, " "),
+		"token_type_hint": tokenType,
+	}
+	if !g.expiry.IsZero() {
+		response["exp"] = g.expiry.Unix()
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) device(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, Error{Code: "invalid_request", Description: err.Error()})
+		return
+	}
+	if e, fail := s.nextFailure(EndpointDevice); fail {
+		writeError(w, e)
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID = id
+	}
+	deviceCode := randomString()
+	userCode := strings.ToUpper(randomString()[:8])
+	s.lock.Lock()
+	s.devices[deviceCode] = &deviceGrant{
+		grant: grant{
+			clientID: clientID,
+			subject:  s.Subject,
+			scopes:   strings.Fields(r.PostForm.Get("scope")),
+			expiry:   time.Now().Add(10 * time.Minute),
+		},
+		userCode: userCode,
+	}
+	s.lock.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":               deviceCode,
+		"user_code":                 userCode,
+		"verification_uri":          s.URL + "/device/verify",
+		"verification_uri_complete": s.URL + "/device/verify?user_code=" + userCode,
+		"expires_in":                600,
+		"interval":                  1,
+	})
+}
+
+func (s *Server) userinfo(w http.ResponseWriter, r *http.Request) {
+	if e, fail := s.nextFailure(EndpointUserinfo); fail {
+		if e.Status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Bearer error=%q", e.Code))
+		}
+		writeError(w, e)
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.lock.Lock()
+	g, ok := s.accessTokens[token]
+	s.lock.Unlock()
+	if !ok || g.expired() {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, Error{Status: http.StatusUnauthorized, Code: "invalid_token"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sub":   g.subject,
+		"scope": strings.Join(g.scopes, " "),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []jwk{publicJWK(&s.key.PublicKey)},
+	})
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + EndpointAuthorize,
+		"token_endpoint":                        s.URL + EndpointToken,
+		"revocation_endpoint":                   s.URL + EndpointRevoke,
+		"introspection_endpoint":                s.URL + EndpointIntrospect,
+		"device_authorization_endpoint":         s.URL + EndpointDevice,
+		"userinfo_endpoint":                     s.URL + EndpointUserinfo,
+		"jwks_uri":                              s.URL + EndpointJWKS,
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token", "client_credentials", DeviceGrantType},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"plain", "S256"},
+	})
+}
@@ -0,0 +1,223 @@
+package oauthtest_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"golang.org/x/oauth2"
+)
+
+const redirectURL = "http://localhost/callback"
+
+func login(t *testing.T, s *oauthtest.Server, config *oauth2.Config, options ...oauth2.AuthCodeOption) *oauth2.Token {
+	redirect, err := s.Authorize(config.AuthCodeURL("state", options...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect.Query().Get("state") != "state" {
+		t.Fatal(redirect)
+	}
+	token, err := config.Exchange(context.Background(), redirect.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func postForm(t *testing.T, endpoint string, values url.Values) map[string]interface{} {
+	resp, err := http.PostForm(endpoint, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	result := make(map[string]interface{})
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		t.Fatal(resp.Status, err)
+	}
+	return result
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	config := s.Config("client", "secret", redirectURL, "openid", "profile")
+
+	token := login(t, s, config, oauth2.SetAuthURLParam("login_hint", "alice"))
+	if token.AccessToken == "" || token.RefreshToken == "" || token.Expiry.IsZero() {
+		t.Fatal(token)
+	}
+	if strings.Join(oauthenticator.GrantedScopes(token), " ") != "openid profile" {
+		t.Fail()
+	}
+	if oauthenticator.AccountName(token) != "alice" {
+		t.Fail()
+	}
+
+	resp, err := config.Client(context.Background(), token).Get(s.URL + oauthtest.EndpointUserinfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatal(resp.Status)
+	}
+}
+
+func TestPKCE(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	config := s.Config("client", "", redirectURL)
+
+	redirect, err := s.Authorize(config.AuthCodeURL("state",
+		oauth2.SetAuthURLParam("code_challenge", "verifier"),
+		oauth2.SetAuthURLParam("code_challenge_method", "plain")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.Exchange(context.Background(), redirect.Query().Get("code"), oauth2.SetAuthURLParam("code_verifier", "other"))
+	if err == nil {
+		t.Fatal("wrong verifier accepted")
+	}
+}
+
+func TestRegisteredClients(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	s.AddClient(oauthtest.Client{ID: "client", Secret: "secret", RedirectURIs: []string{redirectURL}})
+
+	login(t, s, s.Config("client", "secret", redirectURL))
+
+	_, err := s.Authorize(s.Config("client", "secret", "http://localhost/other").AuthCodeURL("state"))
+	if err == nil {
+		t.Error("unregistered redirect URI accepted")
+	}
+	config := s.Config("client", "wrong", redirectURL)
+	redirect, err := s.Authorize(config.AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.Exchange(context.Background(), redirect.Query().Get("code"))
+	if err == nil {
+		t.Error("wrong secret accepted")
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	s.RotateRefreshTokens = true
+	config := s.Config("client", "secret", redirectURL)
+
+	token := login(t, s, config)
+	s.ExpireAccessTokens()
+	token.Expiry = time.Now().Add(-time.Minute)
+	refreshed, err := config.TokenSource(context.Background(), token).Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.AccessToken == token.AccessToken || refreshed.RefreshToken == token.RefreshToken {
+		t.Fatal(refreshed)
+	}
+	_, err = config.TokenSource(context.Background(), token).Token()
+	if err == nil {
+		t.Error("rotated refresh token accepted")
+	}
+}
+
+func TestRevokeAndIntrospect(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	token := login(t, s, s.Config("client", "secret", redirectURL, "profile"))
+
+	introspect := url.Values{"client_id": {"client"}, "client_secret": {"secret"}, "token": {token.AccessToken}}
+	result := postForm(t, s.URL+oauthtest.EndpointIntrospect, introspect)
+	if result["active"] != true || result["scope"] != "profile" || result["sub"] != "user" {
+		t.Fatal(result)
+	}
+
+	revoke := url.Values{"client_id": {"client"}, "client_secret": {"secret"}, "token": {token.AccessToken}}
+	resp, err := http.PostForm(s.URL+oauthtest.EndpointRevoke, revoke)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	result = postForm(t, s.URL+oauthtest.EndpointIntrospect, introspect)
+	if result["active"] != false {
+		t.Fatal(result)
+	}
+}
+
+func TestDevice(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	s.AutoApproveDevice = false
+
+	device := postForm(t, s.URL+oauthtest.EndpointDevice, url.Values{"client_id": {"client"}, "scope": {"profile"}})
+	poll := url.Values{
+		"client_id":   {"client"},
+		"grant_type":  {oauthtest.DeviceGrantType},
+		"device_code": {device["device_code"].(string)},
+	}
+	result := postForm(t, s.URL+oauthtest.EndpointToken, poll)
+	if result["error"] != "authorization_pending" {
+		t.Fatal(result)
+	}
+	err := s.ApproveDevice(device["user_code"].(string), "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = postForm(t, s.URL+oauthtest.EndpointToken, poll)
+	if result["access_token"] == nil {
+		t.Fatal(result)
+	}
+}
+
+func TestFailNext(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+	config := s.Config("client", "secret", redirectURL)
+
+	s.FailNext(oauthtest.EndpointAuthorize, oauthtest.Error{Code: "access_denied"})
+	redirect, err := s.Authorize(config.AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect.Query().Get("error") != "access_denied" || redirect.Query().Get("state") != "state" {
+		t.Fatal(redirect)
+	}
+
+	s.FailNext(oauthtest.EndpointToken, oauthtest.Error{Status: http.StatusServiceUnavailable, Code: "temporarily_unavailable"})
+	redirect, _ = s.Authorize(config.AuthCodeURL("state"))
+	_, err = config.Exchange(context.Background(), redirect.Query().Get("code"))
+	if err == nil {
+		t.Fatal("scripted failure not returned")
+	}
+	if s.Requests(oauthtest.EndpointToken) != 1 {
+		t.Fail()
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	s := oauthtest.NewServer()
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + oauthtest.EndpointDiscovery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	metadata := make(map[string]interface{})
+	json.NewDecoder(resp.Body).Decode(&metadata)
+	if metadata["token_endpoint"] != s.Endpoint().TokenURL || metadata["jwks_uri"] != s.URL+oauthtest.EndpointJWKS {
+		t.Fatal(metadata)
+	}
+}
@@ -0,0 +1,246 @@
+// Package bolt stores configs and tokens in a single bbolt file. Every config
+// has its own bucket, holding its definition, the selected account and a
+// nested bucket of tokens by account.
+package bolt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/oauth2"
+)
+
+var (
+	configsBucket = []byte("configs")
+	tokensBucket  = []byte("tokens")
+	definitionKey = []byte("definition")
+	selectedKey   = []byte("selected")
+)
+
+// DB is a provider over a bbolt database
+type DB struct {
+	db          *bbolt.DB
+	redirecturl string
+	sealer      oauthenticator.Sealer
+}
+
+type Option func(*DB)
+
+// Encrypt encrypts the tokens stored in the database
+func Encrypt(sealer oauthenticator.Sealer) Option {
+	return func(d *DB) {
+		d.sealer = sealer
+	}
+}
+
+type config struct {
+	db         *DB
+	definition oauthenticator.ConfigDefinition
+}
+
+var _ oauthenticator.WritableProvider = &DB{}
+
+// Open opens or creates the database at the given path. The file is locked
+// while open, other processes opening it wait for a second before giving up.
+// The redirect URL is used for configs that do not have their own.
+func Open(path string, redirectURL string, options ...Option) (*DB, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(configsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	d := &DB{
+		db:          db,
+		redirecturl: redirectURL,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d, nil
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// configBucket returns the bucket of a config, nil if it does not exist
+func configBucket(tx *bbolt.Tx, identifier string) *bbolt.Bucket {
+	if identifier == "" {
+		return nil
+	}
+	return tx.Bucket(configsBucket).Bucket([]byte(identifier))
+}
+
+func (d *DB) readConfig(identifier string, bucket *bbolt.Bucket) (*config, error) {
+	c := &config{db: d}
+	err := json.Unmarshal(bucket.Get(definitionKey), &c.definition)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", identifier, err)
+	}
+	c.definition.Identifier = identifier
+	return c, nil
+}
+
+func (d *DB) filter(accept func(c *config) bool) ([]oauthenticator.Config, error) {
+	var result []oauthenticator.Config
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(configsBucket).ForEach(func(k, v []byte) error {
+			if v != nil {
+				// not a bucket
+				return nil
+			}
+			c, err := d.readConfig(string(k), tx.Bucket(configsBucket).Bucket(k))
+			if err != nil {
+				return err
+			}
+			if accept(c) {
+				result = append(result, c)
+			}
+			return nil
+		})
+	})
+	return result, err
+}
+
+func (d *DB) Configs() ([]oauthenticator.Config, error) {
+	return d.filter(func(*config) bool { return true })
+}
+
+func (d *DB) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	return d.filter(func(c *config) bool { return c.definition.Type == ctype })
+}
+
+func (d *DB) Config(identifier string) (oauthenticator.Config, error) {
+	var result *config
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		bucket := configBucket(tx, identifier)
+		if bucket == nil {
+			return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+		}
+		var err error
+		result, err = d.readConfig(identifier, bucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+var _ oauthenticator.BatchWriter = &DB{}
+
+func (d *DB) PutConfig(def oauthenticator.ConfigDefinition) (oauthenticator.Config, error) {
+	result, err := d.PutConfigs([]oauthenticator.ConfigDefinition{def})
+	if err != nil {
+		return nil, err
+	}
+	return result[0], nil
+}
+
+// PutConfigs stores the configs in a single transaction
+func (d *DB) PutConfigs(defs []oauthenticator.ConfigDefinition) ([]oauthenticator.Config, error) {
+	data := make([][]byte, len(defs))
+	for i := range defs {
+		if defs[i].Identifier == "" {
+			return nil, errors.New("config identifier is empty")
+		}
+		var err error
+		data[i], err = json.Marshal(&defs[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	err := d.db.Update(func(tx *bbolt.Tx) error {
+		for i, def := range defs {
+			bucket, err := tx.Bucket(configsBucket).CreateBucketIfNotExists([]byte(def.Identifier))
+			if err != nil {
+				return err
+			}
+			err = bucket.Put(definitionKey, data[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := make([]oauthenticator.Config, len(defs))
+	for i, def := range defs {
+		result[i] = &config{db: d, definition: def}
+	}
+	return result, nil
+}
+
+func (d *DB) RemoveConfig(identifier string) error {
+	return d.db.Update(func(tx *bbolt.Tx) error {
+		if configBucket(tx, identifier) == nil {
+			return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+		}
+		return tx.Bucket(configsBucket).DeleteBucket([]byte(identifier))
+	})
+}
+
+func (c *config) Type() string {
+	return c.definition.Type
+}
+
+func (c *config) Identifier() string {
+	return c.definition.Identifier
+}
+
+func (c *config) Label() string {
+	return c.definition.Label
+}
+
+func (c *config) Config() *oauth2.Config {
+	redirectURL := c.definition.RedirectURL
+	if redirectURL == "" {
+		redirectURL = c.db.redirecturl
+	}
+	return &oauth2.Config{
+		ClientID:     c.definition.ClientID,
+		ClientSecret: c.definition.ClientSecret,
+		Endpoint:     c.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       c.definition.Scopes,
+	}
+}
+
+func (c *config) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  c.definition.AuthURL,
+		TokenURL: c.definition.TokenURL,
+	}
+}
+
+func (c *config) Token() oauthenticator.TokenPersistence {
+	return oauthenticator.SelectedToken(c.Accounts())
+}
+
+func (c *config) Accounts() oauthenticator.Accounts {
+	return &accounts{
+		db:     c.db,
+		config: c.definition.Identifier,
+	}
+}
+
+func (c *config) Options() []oauth2.AuthCodeOption {
+	var result []oauth2.AuthCodeOption
+	for key, value := range c.definition.Params {
+		result = append(result, oauth2.SetAuthURLParam(key, value))
+	}
+	return result
+}
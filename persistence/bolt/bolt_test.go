@@ -0,0 +1,65 @@
+package bolt_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/bolt"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"golang.org/x/oauth2"
+)
+
+func open(t *testing.T, path string, options ...bolt.Option) *bolt.DB {
+	db, err := bolt.Open(path, "http://localhost:8083/verify", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	conformance.RunWritable(t, func(t *testing.T) oauthenticator.WritableProvider {
+		return open(t, t.TempDir()+"/test.db")
+	})
+}
+
+func TestEncryption(t *testing.T) {
+	sealer, err := oauthenticator.NewAESSealer([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := t.TempDir() + "/test.db"
+	db := open(t, path, bolt.Encrypt(sealer))
+	c, err := db.PutConfig(conformance.Configs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token().SetToken(&oauth2.Token{AccessToken: "secret-token"})
+	token, err := c.Token().Token()
+	if err != nil || token == nil || token.AccessToken != "secret-token" {
+		t.Fatal(token, err)
+	}
+	db.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Fatal("token stored in plain text")
+	}
+
+	// without the key, the token can not be read
+	db = open(t, path)
+	c, err = db.Config(conformance.Configs()[0].Identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Token().Token()
+	if err == nil {
+		t.Fatal("encrypted token read without key")
+	}
+}
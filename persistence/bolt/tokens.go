@@ -0,0 +1,153 @@
+package bolt
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/balazsgrill/oauthenticator"
+	bbolt "go.etcd.io/bbolt"
+	"golang.org/x/oauth2"
+)
+
+// accounts are the entries of the tokens bucket of a config
+type accounts struct {
+	db     *DB
+	config string
+}
+
+type accountToken struct {
+	accounts *accounts
+	account  string
+}
+
+func (a *accounts) view(f func(bucket *bbolt.Bucket) error) error {
+	return a.db.db.View(func(tx *bbolt.Tx) error {
+		bucket := configBucket(tx, a.config)
+		if bucket == nil {
+			return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, a.config)
+		}
+		return f(bucket)
+	})
+}
+
+func (a *accounts) update(f func(bucket *bbolt.Bucket) error) error {
+	return a.db.db.Update(func(tx *bbolt.Tx) error {
+		bucket := configBucket(tx, a.config)
+		if bucket == nil {
+			return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, a.config)
+		}
+		return f(bucket)
+	})
+}
+
+func list(bucket *bbolt.Bucket) []string {
+	result := []string{}
+	tokens := bucket.Bucket(tokensBucket)
+	if tokens == nil {
+		return result
+	}
+	tokens.ForEach(func(k, v []byte) error {
+		result = append(result, string(k))
+		return nil
+	})
+	sort.Strings(result)
+	return result
+}
+
+func (a *accounts) List() ([]string, error) {
+	var result []string
+	err := a.view(func(bucket *bbolt.Bucket) error {
+		result = list(bucket)
+		return nil
+	})
+	return result, err
+}
+
+func (a *accounts) Token(account string) oauthenticator.TokenPersistence {
+	return &accountToken{
+		accounts: a,
+		account:  account,
+	}
+}
+
+func (a *accounts) Selected() (string, error) {
+	var result string
+	err := a.view(func(bucket *bbolt.Bucket) error {
+		accounts := list(bucket)
+		selected := string(bucket.Get(selectedKey))
+		for _, account := range accounts {
+			if account == selected {
+				result = selected
+				return nil
+			}
+		}
+		result = oauthenticator.SelectedAccount(accounts)
+		return nil
+	})
+	return result, err
+}
+
+func (a *accounts) Select(account string) error {
+	return a.update(func(bucket *bbolt.Bucket) error {
+		return bucket.Put(selectedKey, []byte(account))
+	})
+}
+
+func (a *accounts) Remove(account string) error {
+	return a.update(func(bucket *bbolt.Bucket) error {
+		tokens := bucket.Bucket(tokensBucket)
+		if tokens != nil {
+			err := tokens.Delete([]byte(account))
+			if err != nil {
+				return err
+			}
+		}
+		if string(bucket.Get(selectedKey)) == account {
+			return bucket.Delete(selectedKey)
+		}
+		return nil
+	})
+}
+
+func (at *accountToken) Token() (*oauth2.Token, error) {
+	var data []byte
+	err := at.accounts.view(func(bucket *bbolt.Bucket) error {
+		tokens := bucket.Bucket(tokensBucket)
+		if tokens != nil {
+			// only valid during the transaction
+			data = append(data, tokens.Get([]byte(at.account))...)
+		}
+		return nil
+	})
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return oauthenticator.OpenToken(at.accounts.db.sealer, data, at.accounts.config, at.account)
+}
+
+func (at *accountToken) SetToken(t *oauth2.Token) {
+	var err error
+	if t == nil {
+		err = at.accounts.Remove(at.account)
+	} else {
+		err = at.setToken(t)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (at *accountToken) setToken(t *oauth2.Token) error {
+	data, err := oauthenticator.SealToken(at.accounts.db.sealer, t, at.accounts.config, at.account)
+	if err != nil {
+		return err
+	}
+	return at.accounts.update(func(bucket *bbolt.Bucket) error {
+		tokens, err := bucket.CreateBucketIfNotExists(tokensBucket)
+		if err != nil {
+			return err
+		}
+		return tokens.Put([]byte(at.account), data)
+	})
+}
@@ -0,0 +1,407 @@
+// Package cache keeps the configs and tokens of a provider in memory for a
+// limited time.
+package cache
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// Option configures a cache
+type Option func(*cache)
+
+// Batched reads all configs together with their details and tokens in a
+// single round trip, if the provider is an oauthenticator.Batcher.
+func Batched() Option {
+	return func(c *cache) {
+		c.batcher, _ = c.provider.(oauthenticator.Batcher)
+	}
+}
+
+// InvalidateOn drops everything cached whenever an event is received, e.g.
+// from file.Watch.
+func InvalidateOn(events <-chan struct{}) Option {
+	return func(c *cache) {
+		go func() {
+			for range events {
+				c.invalidateAll()
+			}
+		}()
+	}
+}
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+type cache struct {
+	provider oauthenticator.Provider
+	batcher  oauthenticator.Batcher
+	ttl      time.Duration
+
+	lock sync.Mutex
+	// generation is increased on every invalidation, so values loaded
+	// before are not stored
+	generation uint64
+	// lists holds the results of Configs and ConfigsOfType
+	lists map[string]entry
+	// configs holds the details and tokens of configs by identifier
+	configs map[string]map[string]entry
+}
+
+type writableCache struct {
+	*cache
+	provider oauthenticator.WritableProvider
+}
+
+// batchWritableCache is the cache of a provider that can store several
+// configs at once
+type batchWritableCache struct {
+	*writableCache
+	batch oauthenticator.BatchWriter
+}
+
+type cachedConfig struct {
+	cache  *cache
+	config oauthenticator.Config
+}
+
+type cachedAccounts struct {
+	cache      *cache
+	identifier string
+	accounts   oauthenticator.Accounts
+}
+
+type cachedToken struct {
+	accounts *cachedAccounts
+	account  string
+}
+
+// New caches the results of the provider for the given duration. Configs and
+// tokens written through the cache invalidate the cached values, changes made
+// by others are seen once the values expire. If the provider is writable, so
+// is the cache.
+func New(provider oauthenticator.Provider, ttl time.Duration, options ...Option) oauthenticator.Provider {
+	c := &cache{
+		provider: provider,
+		ttl:      ttl,
+		lists:    make(map[string]entry),
+		configs:  make(map[string]map[string]entry),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if writable, ok := provider.(oauthenticator.WritableProvider); ok {
+		w := &writableCache{
+			cache:    c,
+			provider: writable,
+		}
+		if batch, ok := provider.(oauthenticator.BatchWriter); ok {
+			return &batchWritableCache{
+				writableCache: w,
+				batch:         batch,
+			}
+		}
+		return w
+	}
+	return c
+}
+
+// get returns the cached value of the given key, loading it if missing or
+// expired. Errors are not cached.
+func (c *cache) get(entries func() map[string]entry, key string, load func() (interface{}, error)) (interface{}, error) {
+	c.lock.Lock()
+	e, ok := entries()[key]
+	generation := c.generation
+	c.lock.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	value, err := load()
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.generation == generation {
+		entries()[key] = entry{
+			value:   value,
+			expires: time.Now().Add(c.ttl),
+		}
+	}
+	return value, nil
+}
+
+// list must be called with the lock held
+func (c *cache) list() map[string]entry {
+	return c.lists
+}
+
+// details returns the entries of a config, it must be called with the lock held
+func (c *cache) details(identifier string) func() map[string]entry {
+	return func() map[string]entry {
+		entries, ok := c.configs[identifier]
+		if !ok {
+			entries = make(map[string]entry)
+			c.configs[identifier] = entries
+		}
+		return entries
+	}
+}
+
+func (c *cache) invalidate(identifier string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.lists = make(map[string]entry)
+	delete(c.configs, identifier)
+}
+
+func (c *cache) invalidateAll() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.generation++
+	c.lists = make(map[string]entry)
+	c.configs = make(map[string]map[string]entry)
+}
+
+func (c *cache) wrap(configs []oauthenticator.Config) []oauthenticator.Config {
+	result := make([]oauthenticator.Config, len(configs))
+	for i, config := range configs {
+		result[i] = &cachedConfig{
+			cache:  c,
+			config: config,
+		}
+	}
+	return result
+}
+
+// batch reads all configs in one round trip and stores their details
+func (c *cache) batch() ([]oauthenticator.Config, error) {
+	c.lock.Lock()
+	generation := c.generation
+	c.lock.Unlock()
+
+	states, err := c.batcher.Batch()
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	configs := make([]oauthenticator.Config, len(states))
+	for i, state := range states {
+		configs[i] = state.Config
+		if c.generation != generation {
+			continue
+		}
+		expires := time.Now().Add(c.ttl)
+		entries := make(map[string]entry)
+		entries["oauth2"] = entry{state.OAuth2, expires}
+		entries["options"] = entry{state.Options, expires}
+
+		var accounts []string
+		for account, token := range state.Tokens {
+			accounts = append(accounts, account)
+			entries["token "+account] = entry{token, expires}
+		}
+		sort.Strings(accounts)
+		entries["accounts"] = entry{accounts, expires}
+		selected := oauthenticator.SelectedAccount(accounts)
+		if _, ok := state.Tokens[state.Selected]; ok {
+			selected = state.Selected
+		}
+		entries["selected"] = entry{selected, expires}
+		if _, ok := state.Tokens[selected]; !ok {
+			entries["token "+selected] = entry{(*oauth2.Token)(nil), expires}
+		}
+		c.configs[state.Config.Identifier()] = entries
+	}
+	return c.wrap(configs), nil
+}
+
+func (c *cache) Configs() ([]oauthenticator.Config, error) {
+	value, err := c.get(c.list, "configs", func() (interface{}, error) {
+		if c.batcher != nil {
+			return c.batch()
+		}
+		configs, err := c.provider.Configs()
+		if err != nil {
+			return nil, err
+		}
+		return c.wrap(configs), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]oauthenticator.Config), nil
+}
+
+func (c *cache) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	value, err := c.get(c.list, "type "+ctype, func() (interface{}, error) {
+		configs, err := c.provider.ConfigsOfType(ctype)
+		if err != nil {
+			return nil, err
+		}
+		return c.wrap(configs), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]oauthenticator.Config), nil
+}
+
+func (c *cache) Config(identifier string) (oauthenticator.Config, error) {
+	value, err := c.get(c.details(identifier), "config", func() (interface{}, error) {
+		config, err := c.provider.Config(identifier)
+		if err != nil {
+			return nil, err
+		}
+		return &cachedConfig{
+			cache:  c,
+			config: config,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(oauthenticator.Config), nil
+}
+
+func (c *writableCache) PutConfig(definition oauthenticator.ConfigDefinition) (oauthenticator.Config, error) {
+	defer c.invalidate(definition.Identifier)
+	config, err := c.provider.PutConfig(definition)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedConfig{
+		cache:  c.cache,
+		config: config,
+	}, nil
+}
+
+func (c *batchWritableCache) PutConfigs(definitions []oauthenticator.ConfigDefinition) ([]oauthenticator.Config, error) {
+	for _, definition := range definitions {
+		defer c.invalidate(definition.Identifier)
+	}
+	configs, err := c.batch.PutConfigs(definitions)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]oauthenticator.Config, len(configs))
+	for i, config := range configs {
+		result[i] = &cachedConfig{
+			cache:  c.cache,
+			config: config,
+		}
+	}
+	return result, nil
+}
+
+func (c *writableCache) RemoveConfig(identifier string) error {
+	defer c.invalidate(identifier)
+	return c.provider.RemoveConfig(identifier)
+}
+
+func (c *cachedConfig) Type() string {
+	return c.config.Type()
+}
+
+func (c *cachedConfig) Identifier() string {
+	return c.config.Identifier()
+}
+
+func (c *cachedConfig) Label() string {
+	return c.config.Label()
+}
+
+func (c *cachedConfig) Endpoint() oauth2.Endpoint {
+	return c.config.Endpoint()
+}
+
+func (c *cachedConfig) Config() *oauth2.Config {
+	value, _ := c.cache.get(c.cache.details(c.Identifier()), "oauth2", func() (interface{}, error) {
+		return c.config.Config(), nil
+	})
+	// callers may modify the result
+	config := *value.(*oauth2.Config)
+	config.Scopes = append([]string(nil), config.Scopes...)
+	return &config
+}
+
+func (c *cachedConfig) Options() []oauth2.AuthCodeOption {
+	value, _ := c.cache.get(c.cache.details(c.Identifier()), "options", func() (interface{}, error) {
+		return c.config.Options(), nil
+	})
+	return value.([]oauth2.AuthCodeOption)
+}
+
+func (c *cachedConfig) Token() oauthenticator.TokenPersistence {
+	return oauthenticator.SelectedToken(c.Accounts())
+}
+
+func (c *cachedConfig) Accounts() oauthenticator.Accounts {
+	return &cachedAccounts{
+		cache:      c.cache,
+		identifier: c.Identifier(),
+		accounts:   c.config.Accounts(),
+	}
+}
+
+func (a *cachedAccounts) List() ([]string, error) {
+	value, err := a.cache.get(a.cache.details(a.identifier), "accounts", func() (interface{}, error) {
+		return a.accounts.List()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), value.([]string)...), nil
+}
+
+func (a *cachedAccounts) Selected() (string, error) {
+	value, err := a.cache.get(a.cache.details(a.identifier), "selected", func() (interface{}, error) {
+		return a.accounts.Selected()
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (a *cachedAccounts) Token(account string) oauthenticator.TokenPersistence {
+	return &cachedToken{
+		accounts: a,
+		account:  account,
+	}
+}
+
+func (a *cachedAccounts) Select(account string) error {
+	defer a.cache.invalidate(a.identifier)
+	return a.accounts.Select(account)
+}
+
+func (a *cachedAccounts) Remove(account string) error {
+	defer a.cache.invalidate(a.identifier)
+	return a.accounts.Remove(account)
+}
+
+func (t *cachedToken) Token() (*oauth2.Token, error) {
+	value, err := t.accounts.cache.get(t.accounts.cache.details(t.accounts.identifier), "token "+t.account, func() (interface{}, error) {
+		return t.accounts.accounts.Token(t.account).Token()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.(*oauth2.Token), nil
+}
+
+func (t *cachedToken) SetToken(token *oauth2.Token) {
+	defer t.accounts.cache.invalidate(t.accounts.identifier)
+	t.accounts.accounts.Token(t.account).SetToken(token)
+}
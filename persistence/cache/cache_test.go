@@ -0,0 +1,195 @@
+package cache_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/cache"
+	"github.com/balazsgrill/oauthenticator/persistence/composite"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+	"golang.org/x/oauth2"
+)
+
+// counting counts the reads of the configs and tokens of a provider
+type counting struct {
+	oauthenticator.Provider
+	memory  *memory.Provider
+	configs int32
+	tokens  int32
+	batches int32
+}
+
+type countingStore struct {
+	oauthenticator.TokenStore
+	counter *counting
+}
+
+type countingAccounts struct {
+	oauthenticator.Accounts
+	counter *counting
+}
+
+type countingToken struct {
+	oauthenticator.TokenPersistence
+	counter *counting
+}
+
+func newCounting() *counting {
+	c := &counting{
+		memory: memory.New(conformance.Configs()...),
+	}
+	c.Provider = composite.WithTokens(c.memory, &countingStore{memory.NewTokenStore(), c})
+	return c
+}
+
+func (c *counting) Configs() ([]oauthenticator.Config, error) {
+	atomic.AddInt32(&c.configs, 1)
+	return c.Provider.Configs()
+}
+
+func (s *countingStore) Accounts(identifier string) oauthenticator.Accounts {
+	return &countingAccounts{s.TokenStore.Accounts(identifier), s.counter}
+}
+
+func (a *countingAccounts) Token(account string) oauthenticator.TokenPersistence {
+	return &countingToken{a.Accounts.Token(account), a.counter}
+}
+
+func (t *countingToken) Token() (*oauth2.Token, error) {
+	atomic.AddInt32(&t.counter.tokens, 1)
+	return t.TokenPersistence.Token()
+}
+
+// batching reads configs in a single batch
+type batching struct {
+	*counting
+}
+
+func (b *batching) Batch() ([]oauthenticator.ConfigState, error) {
+	atomic.AddInt32(&b.batches, 1)
+	// reads of the batch itself are not counted
+	tokens := atomic.LoadInt32(&b.tokens)
+	defer atomic.StoreInt32(&b.tokens, tokens)
+	configs, err := b.counting.Provider.Configs()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]oauthenticator.ConfigState, len(configs))
+	for i, c := range configs {
+		states[i] = oauthenticator.ConfigState{
+			Config:  c,
+			OAuth2:  c.Config(),
+			Options: c.Options(),
+			Tokens:  make(map[string]*oauth2.Token),
+		}
+		accounts, _ := c.Accounts().List()
+		for _, account := range accounts {
+			states[i].Tokens[account], _ = c.Accounts().Token(account).Token()
+		}
+		states[i].Selected, _ = c.Accounts().Selected()
+	}
+	return states, nil
+}
+
+func TestConformance(t *testing.T) {
+	conformance.RunWritable(t, func(t *testing.T) oauthenticator.WritableProvider {
+		return cache.New(memory.New(), time.Minute).(oauthenticator.WritableProvider)
+	})
+}
+
+// readAll reads the configs and their tokens, as the index page does
+func readAll(t *testing.T, p oauthenticator.Provider) map[string]string {
+	configs, err := p.Configs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := make(map[string]string)
+	for _, c := range configs {
+		token, err := c.Token().Token()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != nil {
+			result[c.Identifier()] = token.AccessToken
+		}
+	}
+	return result
+}
+
+func TestCache(t *testing.T) {
+	inner := newCounting()
+	p := cache.New(inner, time.Minute)
+
+	readAll(t, p)
+	readAll(t, p)
+	if inner.configs != 1 || inner.tokens != 3 {
+		t.Fatal(inner.configs, inner.tokens)
+	}
+
+	// writes invalidate the cache
+	c, err := p.Config("mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token().SetToken(&oauth2.Token{AccessToken: "mail"})
+	tokens := readAll(t, p)
+	if tokens["mail"] != "mail" || inner.configs != 2 {
+		t.Fatal(tokens, inner.configs)
+	}
+
+	// changes made by others are seen once expired
+	p = cache.New(inner, 10*time.Millisecond)
+	readAll(t, p)
+	inner.memory.RemoveConfig("mail")
+	time.Sleep(20 * time.Millisecond)
+	tokens = readAll(t, p)
+	if _, ok := tokens["mail"]; ok {
+		t.Fatal(tokens)
+	}
+}
+
+func TestInvalidateOn(t *testing.T) {
+	inner := newCounting()
+	events := make(chan struct{})
+	defer close(events)
+	p := cache.New(inner, time.Minute, cache.InvalidateOn(events))
+
+	readAll(t, p)
+	events <- struct{}{}
+	// the event is handled asynchronously
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&inner.configs) < 2 && time.Now().Before(deadline) {
+		readAll(t, p)
+		time.Sleep(time.Millisecond)
+	}
+	if atomic.LoadInt32(&inner.configs) < 2 {
+		t.Fatal("cache not invalidated")
+	}
+}
+
+func TestBatched(t *testing.T) {
+	inner := &batching{newCounting()}
+	c, _ := inner.Provider.Config("mail")
+	_, err := oauthenticator.StoreToken(c.Accounts(), "work", &oauth2.Token{AccessToken: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := cache.New(inner, time.Minute, cache.Batched())
+
+	tokens := readAll(t, p)
+	if tokens["mail"] != "work" || len(tokens) != 1 {
+		t.Fatal(tokens)
+	}
+	configs, _ := p.Configs()
+	for _, c := range configs {
+		c.Config()
+		c.Options()
+		c.Accounts().List()
+	}
+	if inner.batches != 1 || inner.configs != 0 || inner.tokens != 0 {
+		t.Fatal(inner.batches, inner.configs, inner.tokens)
+	}
+}
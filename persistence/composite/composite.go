@@ -0,0 +1,200 @@
+// Package composite merges several providers into one.
+package composite
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// Separator is put between the prefix of a layer and the identifiers of its configs
+const Separator = ":"
+
+// Layer is a provider merged into a composite. If Prefix is set, the
+// identifiers of its configs are prefixed with it and the separator, so they
+// can not collide with the ones of other layers.
+type Layer struct {
+	Prefix   string
+	Provider oauthenticator.Provider
+}
+
+type compositeProvider struct {
+	layers []Layer
+}
+
+type tokenProvider struct {
+	provider oauthenticator.Provider
+	tokens   oauthenticator.TokenStore
+}
+
+// wrappedConfig overrides the identifier and the tokens of a config, if set
+type wrappedConfig struct {
+	config     oauthenticator.Config
+	identifier string
+	tokens     oauthenticator.TokenStore
+}
+
+// New merges the given layers. Earlier layers take precedence: if several
+// layers hold a config with the same (prefixed) identifier, the one of the
+// first layer is used.
+func New(layers ...Layer) oauthenticator.Provider {
+	return &compositeProvider{
+		layers: layers,
+	}
+}
+
+func (l *Layer) wrap(c oauthenticator.Config) oauthenticator.Config {
+	if l.Prefix == "" {
+		return c
+	}
+	return &wrappedConfig{
+		config:     c,
+		identifier: l.Prefix + Separator + c.Identifier(),
+	}
+}
+
+// local returns the identifier within the layer, false if the identifier
+// does not belong to the layer
+func (l *Layer) local(identifier string) (string, bool) {
+	if l.Prefix == "" {
+		return identifier, true
+	}
+	prefix := l.Prefix + Separator
+	if !strings.HasPrefix(identifier, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(identifier, prefix), true
+}
+
+func (p *compositeProvider) merge(list func(oauthenticator.Provider) ([]oauthenticator.Config, error)) ([]oauthenticator.Config, error) {
+	var result []oauthenticator.Config
+	seen := make(map[string]bool)
+	for i := range p.layers {
+		layer := &p.layers[i]
+		configs, err := list(layer.Provider)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range configs {
+			c = layer.wrap(c)
+			if seen[c.Identifier()] {
+				continue
+			}
+			seen[c.Identifier()] = true
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
+
+func (p *compositeProvider) Configs() ([]oauthenticator.Config, error) {
+	return p.merge(func(provider oauthenticator.Provider) ([]oauthenticator.Config, error) {
+		return provider.Configs()
+	})
+}
+
+func (p *compositeProvider) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	return p.merge(func(provider oauthenticator.Provider) ([]oauthenticator.Config, error) {
+		return provider.ConfigsOfType(ctype)
+	})
+}
+
+func (p *compositeProvider) Config(identifier string) (oauthenticator.Config, error) {
+	for i := range p.layers {
+		layer := &p.layers[i]
+		local, ok := layer.local(identifier)
+		if !ok {
+			continue
+		}
+		c, err := layer.Provider.Config(local)
+		if errors.Is(err, oauthenticator.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return layer.wrap(c), nil
+	}
+	return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+}
+
+// WithTokens replaces the token storage of the configs of a provider with the
+// token store, e.g. to keep tokens of configs read from files in SPARQL. The
+// tokens are stored by the identifiers of the configs within the provider.
+func WithTokens(provider oauthenticator.Provider, tokens oauthenticator.TokenStore) oauthenticator.Provider {
+	return &tokenProvider{
+		provider: provider,
+		tokens:   tokens,
+	}
+}
+
+func (p *tokenProvider) wrap(configs []oauthenticator.Config, err error) ([]oauthenticator.Config, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := make([]oauthenticator.Config, len(configs))
+	for i, c := range configs {
+		result[i] = &wrappedConfig{config: c, tokens: p.tokens}
+	}
+	return result, nil
+}
+
+func (p *tokenProvider) Configs() ([]oauthenticator.Config, error) {
+	return p.wrap(p.provider.Configs())
+}
+
+func (p *tokenProvider) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	return p.wrap(p.provider.ConfigsOfType(ctype))
+}
+
+func (p *tokenProvider) Config(identifier string) (oauthenticator.Config, error) {
+	c, err := p.provider.Config(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return &wrappedConfig{config: c, tokens: p.tokens}, nil
+}
+
+func (c *wrappedConfig) Identifier() string {
+	if c.identifier == "" {
+		return c.config.Identifier()
+	}
+	return c.identifier
+}
+
+func (c *wrappedConfig) Type() string {
+	return c.config.Type()
+}
+
+func (c *wrappedConfig) Label() string {
+	return c.config.Label()
+}
+
+func (c *wrappedConfig) Config() *oauth2.Config {
+	return c.config.Config()
+}
+
+func (c *wrappedConfig) Endpoint() oauth2.Endpoint {
+	return c.config.Endpoint()
+}
+
+func (c *wrappedConfig) Token() oauthenticator.TokenPersistence {
+	if c.tokens == nil {
+		return c.config.Token()
+	}
+	return oauthenticator.SelectedToken(c.Accounts())
+}
+
+func (c *wrappedConfig) Accounts() oauthenticator.Accounts {
+	if c.tokens == nil {
+		return c.config.Accounts()
+	}
+	return c.tokens.Accounts(c.config.Identifier())
+}
+
+func (c *wrappedConfig) Options() []oauth2.AuthCodeOption {
+	return c.config.Options()
+}
@@ -0,0 +1,82 @@
+package composite_test
+
+import (
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/composite"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+)
+
+// split distributes the configs over two providers
+func split(configs []oauthenticator.ConfigDefinition) (*memory.Provider, *memory.Provider) {
+	first, second := memory.New(), memory.New()
+	for i, c := range configs {
+		if i%2 == 0 {
+			first.PutConfig(c)
+		} else {
+			second.PutConfig(c)
+		}
+	}
+	return first, second
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+		first, second := split(configs)
+		return composite.New(composite.Layer{Provider: first}, composite.Layer{Provider: second})
+	})
+}
+
+func TestPrefixedConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+		first, second := split(configs)
+		return composite.New(
+			composite.Layer{Prefix: "first", Provider: first},
+			composite.Layer{Prefix: "second", Provider: second},
+		)
+	})
+}
+
+func TestWithTokensConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+		return composite.WithTokens(memory.New(configs...), memory.NewTokenStore())
+	})
+}
+
+func TestPrecedence(t *testing.T) {
+	local := memory.New(oauthenticator.ConfigDefinition{Identifier: "mail", Label: "Local mail"})
+	shared := memory.New(
+		oauthenticator.ConfigDefinition{Identifier: "mail", Label: "Shared mail"},
+		oauthenticator.ConfigDefinition{Identifier: "calendar", Label: "Shared calendar"},
+	)
+	p := composite.New(composite.Layer{Provider: local}, composite.Layer{Provider: shared})
+
+	configs, err := p.Configs()
+	if err != nil || len(configs) != 2 {
+		t.Fatal(configs, err)
+	}
+	c, err := p.Config("mail")
+	if err != nil || c.Label() != "Local mail" {
+		t.Fatal(c, err)
+	}
+	c, err = p.Config("calendar")
+	if err != nil || c.Label() != "Shared calendar" {
+		t.Fatal(c, err)
+	}
+
+	p = composite.New(composite.Layer{Prefix: "local", Provider: local}, composite.Layer{Prefix: "shared", Provider: shared})
+	configs, err = p.Configs()
+	if err != nil || len(configs) != 3 {
+		t.Fatal(configs, err)
+	}
+	c, err = p.Config("shared:mail")
+	if err != nil || c.Label() != "Shared mail" || c.Identifier() != "shared:mail" {
+		t.Fatal(c, err)
+	}
+	_, err = p.Config("mail")
+	if err == nil {
+		t.Fatal("identifier without prefix found")
+	}
+}
@@ -0,0 +1,549 @@
+// Package conformance checks that a Provider or TokenPersistence
+// implementation behaves like the others. Backends run it from their tests:
+//
+//	func TestConformance(t *testing.T) {
+//		conformance.Run(t, newProvider)
+//	}
+package conformance
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// Factory creates a provider holding the given configs and no tokens. Backends
+// may map the identifiers of the definitions to their own, configs are matched
+// by label. All definitions share the same redirect URL.
+type Factory func(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider
+
+// WritableFactory creates an empty writable provider
+type WritableFactory func(t *testing.T) oauthenticator.WritableProvider
+
+// TokenStoreFactory creates an empty token store
+type TokenStoreFactory func(t *testing.T) oauthenticator.TokenStore
+
+// TokenFactory creates an empty token persistence
+type TokenFactory func(t *testing.T) oauthenticator.TokenPersistence
+
+// Types used by the test configs
+const (
+	MailType     = "http://example.com/types#Mail"
+	CalendarType = "http://example.com/types#Calendar"
+)
+
+const redirectURL = "http://localhost:8083/verify"
+
+// Configs returns the configs the provider under test is expected to hold
+func Configs() []oauthenticator.ConfigDefinition {
+	return []oauthenticator.ConfigDefinition{
+		{
+			Identifier:   "mail",
+			Type:         MailType,
+			Label:        "Mail",
+			ClientID:     "mail-client",
+			ClientSecret: "mail-secret",
+			AuthURL:      "https://login.example.com/authorize",
+			TokenURL:     "https://login.example.com/token",
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "mail"},
+			Params:       map[string]string{"resource": "https://mail.example.com/"},
+		},
+		{
+			Identifier:   "archive",
+			Type:         MailType,
+			Label:        "Mail archive",
+			ClientID:     "archive-client",
+			ClientSecret: "archive-secret",
+			AuthURL:      "https://login.example.com/authorize",
+			TokenURL:     "https://login.example.com/token",
+			RedirectURL:  redirectURL,
+		},
+		{
+			Identifier:   "calendar",
+			Type:         CalendarType,
+			Label:        "Calendar",
+			ClientID:     "calendar-client",
+			ClientSecret: "calendar-secret",
+			AuthURL:      "https://calendar.example.com/oauth/authorize",
+			TokenURL:     "https://calendar.example.com/oauth/token",
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"calendar.read"},
+		},
+	}
+}
+
+// Run runs the conformance tests of a provider
+func Run(t *testing.T, factory Factory) {
+	t.Run("Configs", func(t *testing.T) {
+		p := factory(t, Configs())
+		configs, err := p.Configs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkConfigs(t, Configs(), configs)
+	})
+	t.Run("Config", func(t *testing.T) {
+		p := factory(t, Configs())
+		configs := listConfigs(t, p)
+		for _, c := range configs {
+			found, err := p.Config(c.Identifier())
+			if err != nil {
+				t.Fatalf("lookup of %s failed: %v", c.Identifier(), err)
+			}
+			if found == nil || found.Identifier() != c.Identifier() {
+				t.Fatalf("lookup of %s returned %v", c.Identifier(), found)
+			}
+			checkConfig(t, definitionByLabel(t, c.Label()), found)
+		}
+	})
+	t.Run("ConfigsOfType", func(t *testing.T) {
+		p := factory(t, Configs())
+		expected := map[string][]string{
+			MailType:                        {"Mail", "Mail archive"},
+			CalendarType:                    {"Calendar"},
+			"http://example.com/types#None": nil,
+		}
+		for ctype, labels := range expected {
+			configs, err := p.ConfigsOfType(ctype)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var found []string
+			for _, c := range configs {
+				if c == nil {
+					t.Fatalf("nil config of type %s", ctype)
+				}
+				if c.Type() != ctype {
+					t.Errorf("config %s of type %s listed as %s", c.Label(), c.Type(), ctype)
+				}
+				found = append(found, c.Label())
+			}
+			sort.Strings(found)
+			if !reflect.DeepEqual(found, labels) {
+				t.Errorf("configs of type %s: expected %v, got %v", ctype, labels, found)
+			}
+		}
+	})
+	t.Run("UnknownIdentifier", func(t *testing.T) {
+		p := factory(t, Configs())
+		for _, id := range []string{"", "unknown", "http://example.com/unknown", "../unknown"} {
+			c, err := p.Config(id)
+			if !errors.Is(err, oauthenticator.ErrNotFound) {
+				t.Errorf("lookup of %q: expected ErrNotFound, got %v", id, err)
+			}
+			if c != nil {
+				t.Errorf("lookup of %q returned a config", id)
+			}
+		}
+	})
+	t.Run("Empty", func(t *testing.T) {
+		p := factory(t, nil)
+		configs, err := p.Configs()
+		if err != nil || len(configs) != 0 {
+			t.Fatal(configs, err)
+		}
+	})
+	t.Run("AbsentToken", func(t *testing.T) {
+		p := factory(t, Configs())
+		for _, c := range listConfigs(t, p) {
+			checkAbsent(t, c.Token())
+			accounts, err := c.Accounts().List()
+			if err != nil || len(accounts) != 0 {
+				t.Fatal(accounts, err)
+			}
+			selected, err := c.Accounts().Selected()
+			if err != nil || selected != oauthenticator.DefaultAccount {
+				t.Fatal(selected, err)
+			}
+			checkAbsent(t, c.Accounts().Token("unknown"))
+			err = c.Accounts().Remove("unknown")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	t.Run("Token", func(t *testing.T) {
+		p := factory(t, Configs())
+		configs := listConfigs(t, p)
+		RunTokenPersistence(t, func(t *testing.T) oauthenticator.TokenPersistence {
+			return configs[0].Token()
+		})
+	})
+	t.Run("AccountToken", func(t *testing.T) {
+		p := factory(t, Configs())
+		configs := listConfigs(t, p)
+		RunTokenPersistence(t, func(t *testing.T) oauthenticator.TokenPersistence {
+			return configs[0].Accounts().Token("alice@example.com")
+		})
+	})
+	t.Run("Accounts", func(t *testing.T) {
+		p := factory(t, Configs())
+		configs := listConfigs(t, p)
+		c := configs[0]
+		accounts := c.Accounts()
+		name, err := oauthenticator.StoreToken(accounts, "work", testToken("work"))
+		if err != nil || name != "work" {
+			t.Fatal(name, err)
+		}
+		accounts.Token("home").SetToken(testToken("home"))
+		checkAccounts(t, accounts, []string{"home", "work"}, "work")
+		checkAccessToken(t, c.Token(), "work")
+
+		err = accounts.Select("home")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAccounts(t, accounts, []string{"home", "work"}, "home")
+		checkAccessToken(t, c.Token(), "home")
+
+		err = accounts.Remove("home")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAccounts(t, accounts, []string{"work"}, "work")
+		checkAccessToken(t, c.Token(), "work")
+
+		// tokens of other configs are not affected
+		for _, other := range configs[1:] {
+			checkAbsent(t, other.Token())
+		}
+		// a config looked up again sees the same tokens
+		again, err := p.Config(c.Identifier())
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAccessToken(t, again.Token(), "work")
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		p := factory(t, Configs())
+		configs := listConfigs(t, p)
+		var wg sync.WaitGroup
+		var expected []string
+		for _, c := range configs {
+			for i := 0; i < 4; i++ {
+				account := fmt.Sprintf("account%d", i)
+				if c == configs[0] {
+					expected = append(expected, account)
+				}
+				wg.Add(1)
+				go func(c oauthenticator.Config) {
+					defer wg.Done()
+					for j := 0; j < 5; j++ {
+						c.Accounts().Token(account).SetToken(testToken(account))
+						_, err := c.Token().Token()
+						if err != nil {
+							t.Error(err)
+						}
+					}
+				}(c)
+			}
+		}
+		wg.Wait()
+		for _, c := range configs {
+			accounts, err := c.Accounts().List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(accounts)
+			if !reflect.DeepEqual(accounts, expected) {
+				t.Errorf("%s: expected accounts %v, got %v", c.Label(), expected, accounts)
+			}
+			for _, account := range expected {
+				checkAccessToken(t, c.Accounts().Token(account), account)
+			}
+		}
+	})
+}
+
+// RunWritable runs the conformance tests of a writable provider, including the
+// ones of Run on configs stored with PutConfig
+func RunWritable(t *testing.T, factory WritableFactory) {
+	Run(t, func(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+		p := factory(t)
+		for _, def := range configs {
+			_, err := p.PutConfig(def)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return p
+	})
+	t.Run("PutConfig", func(t *testing.T) {
+		p := factory(t)
+		def := Configs()[0]
+		c, err := p.PutConfig(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkConfig(t, def, c)
+		if c.Identifier() != def.Identifier {
+			t.Fatalf("identifier %s stored as %s", def.Identifier, c.Identifier())
+		}
+		c.Token().SetToken(testToken("kept"))
+
+		def.Label = "Replaced"
+		def.Scopes = []string{"other"}
+		def.Params = nil
+		c, err = p.PutConfig(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs, err := p.Configs()
+		if err != nil || len(configs) != 1 {
+			t.Fatal(configs, err)
+		}
+		actual := oauthenticator.Definition(configs[0])
+		if actual.Label != "Replaced" || len(actual.Scopes) != 1 || len(actual.Params) != 0 {
+			t.Fatalf("config not replaced: %+v", actual)
+		}
+		checkAccessToken(t, c.Token(), "kept")
+
+		_, err = p.PutConfig(oauthenticator.ConfigDefinition{Label: "no identifier"})
+		if err == nil {
+			t.Error("config without identifier stored")
+		}
+	})
+	t.Run("RemoveConfig", func(t *testing.T) {
+		p := factory(t)
+		def := Configs()[0]
+		c, err := p.PutConfig(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Accounts().Token("work").SetToken(testToken("work"))
+		err = p.RemoveConfig(def.Identifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = p.Config(def.Identifier)
+		if !errors.Is(err, oauthenticator.ErrNotFound) {
+			t.Fatalf("removed config found: %v", err)
+		}
+		err = p.RemoveConfig(def.Identifier)
+		if !errors.Is(err, oauthenticator.ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+
+		// tokens are removed with the config
+		c, err = p.PutConfig(def)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAbsent(t, c.Accounts().Token("work"))
+	})
+}
+
+// RunTokenStore runs the conformance tests of a token store
+func RunTokenStore(t *testing.T, factory TokenStoreFactory) {
+	t.Run("Token", func(t *testing.T) {
+		RunTokenPersistence(t, func(t *testing.T) oauthenticator.TokenPersistence {
+			return oauthenticator.SelectedToken(factory(t).Accounts("mail"))
+		})
+	})
+	t.Run("AccountToken", func(t *testing.T) {
+		RunTokenPersistence(t, func(t *testing.T) oauthenticator.TokenPersistence {
+			return factory(t).Accounts("https://example.com/clients/mail").Token("alice@example.com")
+		})
+	})
+	t.Run("Accounts", func(t *testing.T) {
+		store := factory(t)
+		accounts := store.Accounts("mail")
+		checkAccounts(t, accounts, []string{}, oauthenticator.DefaultAccount)
+		_, err := oauthenticator.StoreToken(accounts, "work", testToken("work"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		accounts.Token("home").SetToken(testToken("home"))
+		checkAccounts(t, accounts, []string{"home", "work"}, "work")
+		err = accounts.Remove("work")
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkAccounts(t, accounts, []string{"home"}, "home")
+
+		// identifiers are independent
+		checkAccounts(t, store.Accounts("calendar"), []string{}, oauthenticator.DefaultAccount)
+		checkAccounts(t, store.Accounts("mail/calendar"), []string{}, oauthenticator.DefaultAccount)
+		checkAccessToken(t, store.Accounts("mail").Token("home"), "home")
+	})
+}
+
+// RunTokenPersistence runs the conformance tests of a token persistence. The
+// factory is called once per test.
+func RunTokenPersistence(t *testing.T, factory TokenFactory) {
+	t.Run("Absent", func(t *testing.T) {
+		checkAbsent(t, factory(t))
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		tp := factory(t)
+		token := testToken("first").WithExtra(map[string]interface{}{
+			"scope": "openid profile",
+		})
+		tp.SetToken(token)
+		stored, err := tp.Token()
+		if err != nil || stored == nil {
+			t.Fatal(stored, err)
+		}
+		if stored.AccessToken != token.AccessToken || stored.RefreshToken != token.RefreshToken ||
+			stored.TokenType != token.TokenType || !stored.Expiry.Equal(token.Expiry) {
+			t.Fatalf("expected %+v, got %+v", token, stored)
+		}
+		scopes := oauthenticator.GrantedScopes(stored)
+		if strings.Join(scopes, " ") != "openid profile" {
+			t.Fatalf("granted scopes lost: %v", scopes)
+		}
+
+		tp.SetToken(testToken("second"))
+		checkAccessToken(t, tp, "second")
+	})
+	t.Run("Remove", func(t *testing.T) {
+		tp := factory(t)
+		tp.SetToken(testToken("first"))
+		tp.SetToken(nil)
+		checkAbsent(t, tp)
+	})
+	t.Run("Concurrency", func(t *testing.T) {
+		tp := factory(t)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 5; j++ {
+					tp.SetToken(testToken(fmt.Sprintf("token%d", i)))
+					token, err := tp.Token()
+					if err != nil {
+						t.Error(err)
+					} else if token == nil || !strings.HasPrefix(token.AccessToken, "token") {
+						t.Errorf("inconsistent token %v", token)
+					}
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func testToken(access string) *oauth2.Token {
+	return &oauth2.Token{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		RefreshToken: "refresh-" + access,
+		Expiry:       time.Now().Add(time.Hour).Round(time.Second),
+	}
+}
+
+func listConfigs(t *testing.T, p oauthenticator.Provider) []oauthenticator.Config {
+	t.Helper()
+	configs, err := p.Configs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) == 0 {
+		t.Fatal("no configs")
+	}
+	sort.Slice(configs, func(i, j int) bool {
+		return configs[i].Label() > configs[j].Label()
+	})
+	return configs
+}
+
+func definitionByLabel(t *testing.T, label string) oauthenticator.ConfigDefinition {
+	t.Helper()
+	for _, d := range Configs() {
+		if d.Label == label {
+			return d
+		}
+	}
+	t.Fatalf("unexpected config %s", label)
+	return oauthenticator.ConfigDefinition{}
+}
+
+func checkConfigs(t *testing.T, expected []oauthenticator.ConfigDefinition, configs []oauthenticator.Config) {
+	t.Helper()
+	if len(configs) != len(expected) {
+		t.Fatalf("expected %d configs, got %d", len(expected), len(configs))
+	}
+	identifiers := make(map[string]bool)
+	for _, c := range configs {
+		if c == nil {
+			t.Fatal("nil config listed")
+		}
+		if identifiers[c.Identifier()] {
+			t.Fatalf("identifier %s listed twice", c.Identifier())
+		}
+		identifiers[c.Identifier()] = true
+		checkConfig(t, definitionByLabel(t, c.Label()), c)
+	}
+}
+
+func checkConfig(t *testing.T, expected oauthenticator.ConfigDefinition, c oauthenticator.Config) {
+	t.Helper()
+	actual := oauthenticator.Definition(c)
+	actual.Identifier = expected.Identifier
+	sort.Strings(actual.Scopes)
+	expected.Scopes = append([]string(nil), expected.Scopes...)
+	sort.Strings(expected.Scopes)
+	if len(actual.Scopes) == 0 && len(expected.Scopes) == 0 {
+		actual.Scopes, expected.Scopes = nil, nil
+	}
+	if len(actual.Params) == 0 && len(expected.Params) == 0 {
+		actual.Params, expected.Params = nil, nil
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+	if c.Endpoint() != c.Config().Endpoint {
+		t.Errorf("%s: endpoint differs from the one of the oauth2 config", c.Label())
+	}
+}
+
+func checkAbsent(t *testing.T, tp oauthenticator.TokenPersistence) {
+	t.Helper()
+	token, err := tp.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != nil {
+		t.Fatalf("expected no token, got %+v", token)
+	}
+}
+
+func checkAccessToken(t *testing.T, tp oauthenticator.TokenPersistence, access string) {
+	t.Helper()
+	token, err := tp.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == nil || token.AccessToken != access {
+		t.Fatalf("expected token %s, got %+v", access, token)
+	}
+}
+
+func checkAccounts(t *testing.T, accounts oauthenticator.Accounts, expected []string, selected string) {
+	t.Helper()
+	names, err := accounts.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if len(names) == 0 && len(expected) == 0 {
+		names = expected
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected accounts %v, got %v", expected, names)
+	}
+	actual, err := accounts.Selected()
+	if err != nil || actual != selected {
+		t.Fatalf("expected %s to be selected, got %s (%v)", selected, actual, err)
+	}
+}
@@ -0,0 +1,205 @@
+// Package env reads configs from environment variables. A config named NAME
+// is defined by the following variables, of which CLIENTID, AUTHURL and
+// TOKENURL are mandatory:
+//
+//	OAUTH_<NAME>_CLIENTID
+//	OAUTH_<NAME>_CLIENTSECRET
+//	OAUTH_<NAME>_AUTHURL
+//	OAUTH_<NAME>_TOKENURL
+//	OAUTH_<NAME>_REDIRECTURL
+//	OAUTH_<NAME>_LABEL
+//	OAUTH_<NAME>_TYPE
+//	OAUTH_<NAME>_SCOPES (separated by spaces or commas)
+//	OAUTH_<NAME>_PARAM_<KEY> (authorization URL parameter, the key is lowercased)
+//
+// The identifier of the config is NAME in lower case. Tokens are kept in a
+// separate token store.
+package env
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// Prefix of the environment variables defining configs
+const Prefix = "OAUTH_"
+
+const paramInfix = "_PARAM_"
+
+var fields = []string{"CLIENTID", "CLIENTSECRET", "AUTHURL", "TOKENURL", "REDIRECTURL", "LABEL", "TYPE", "SCOPES"}
+
+type envProvider struct {
+	configs map[string]oauthenticator.ConfigDefinition
+	tokens  oauthenticator.TokenStore
+}
+
+type config struct {
+	definition oauthenticator.ConfigDefinition
+	tokens     oauthenticator.TokenStore
+}
+
+// FromEnvironment reads the configs from the environment of the process
+func FromEnvironment(tokens oauthenticator.TokenStore, redirectURL string) oauthenticator.Provider {
+	return New(os.Environ(), tokens, redirectURL)
+}
+
+// New reads the configs from the given "KEY=value" pairs. The redirect URL is
+// used for configs that do not define one.
+func New(environ []string, tokens oauthenticator.TokenStore, redirectURL string) oauthenticator.Provider {
+	definitions := Parse(environ)
+	p := &envProvider{
+		configs: make(map[string]oauthenticator.ConfigDefinition),
+		tokens:  tokens,
+	}
+	for _, def := range definitions {
+		if def.RedirectURL == "" {
+			def.RedirectURL = redirectURL
+		}
+		p.configs[def.Identifier] = def
+	}
+	return p
+}
+
+// Parse returns the configs defined by the given "KEY=value" pairs, sorted by
+// identifier. Incomplete configs are skipped.
+func Parse(environ []string) []oauthenticator.ConfigDefinition {
+	values := make(map[string]map[string]string)
+	params := make(map[string]map[string]string)
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(key, Prefix) {
+			continue
+		}
+		key = strings.TrimPrefix(key, Prefix)
+		if name, param, ok := strings.Cut(key, paramInfix); ok && name != "" && param != "" {
+			if params[name] == nil {
+				params[name] = make(map[string]string)
+			}
+			params[name][strings.ToLower(param)] = value
+			continue
+		}
+		for _, field := range fields {
+			name := strings.TrimSuffix(key, "_"+field)
+			if name != key && name != "" {
+				if values[name] == nil {
+					values[name] = make(map[string]string)
+				}
+				values[name][field] = value
+				break
+			}
+		}
+	}
+
+	var result []oauthenticator.ConfigDefinition
+	for name, v := range values {
+		def := oauthenticator.ConfigDefinition{
+			Identifier:   strings.ToLower(name),
+			Type:         v["TYPE"],
+			Label:        v["LABEL"],
+			ClientID:     v["CLIENTID"],
+			ClientSecret: v["CLIENTSECRET"],
+			AuthURL:      v["AUTHURL"],
+			TokenURL:     v["TOKENURL"],
+			RedirectURL:  v["REDIRECTURL"],
+			Scopes: strings.FieldsFunc(v["SCOPES"], func(r rune) bool {
+				return r == ' ' || r == ','
+			}),
+			Params: params[name],
+		}
+		if def.ClientID == "" || def.AuthURL == "" || def.TokenURL == "" {
+			log.Printf("Ignoring config %s from the environment, CLIENTID, AUTHURL and TOKENURL are mandatory", name)
+			continue
+		}
+		if def.Label == "" {
+			def.Label = def.Identifier
+		}
+		result = append(result, def)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Identifier < result[j].Identifier
+	})
+	return result
+}
+
+func (p *envProvider) filter(accept func(def *oauthenticator.ConfigDefinition) bool) []oauthenticator.Config {
+	identifiers := make([]string, 0, len(p.configs))
+	for identifier := range p.configs {
+		identifiers = append(identifiers, identifier)
+	}
+	sort.Strings(identifiers)
+	var result []oauthenticator.Config
+	for _, identifier := range identifiers {
+		def := p.configs[identifier]
+		if accept(&def) {
+			result = append(result, &config{definition: def, tokens: p.tokens})
+		}
+	}
+	return result
+}
+
+func (p *envProvider) Configs() ([]oauthenticator.Config, error) {
+	return p.filter(func(*oauthenticator.ConfigDefinition) bool { return true }), nil
+}
+
+func (p *envProvider) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	return p.filter(func(def *oauthenticator.ConfigDefinition) bool { return def.Type == ctype }), nil
+}
+
+func (p *envProvider) Config(identifier string) (oauthenticator.Config, error) {
+	def, ok := p.configs[identifier]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+	}
+	return &config{definition: def, tokens: p.tokens}, nil
+}
+
+func (c *config) Type() string {
+	return c.definition.Type
+}
+
+func (c *config) Identifier() string {
+	return c.definition.Identifier
+}
+
+func (c *config) Label() string {
+	return c.definition.Label
+}
+
+func (c *config) Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.definition.ClientID,
+		ClientSecret: c.definition.ClientSecret,
+		Endpoint:     c.Endpoint(),
+		RedirectURL:  c.definition.RedirectURL,
+		Scopes:       c.definition.Scopes,
+	}
+}
+
+func (c *config) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  c.definition.AuthURL,
+		TokenURL: c.definition.TokenURL,
+	}
+}
+
+func (c *config) Token() oauthenticator.TokenPersistence {
+	return oauthenticator.SelectedToken(c.Accounts())
+}
+
+func (c *config) Accounts() oauthenticator.Accounts {
+	return c.tokens.Accounts(c.definition.Identifier)
+}
+
+func (c *config) Options() []oauth2.AuthCodeOption {
+	var result []oauth2.AuthCodeOption
+	for key, value := range c.definition.Params {
+		result = append(result, oauth2.SetAuthURLParam(key, value))
+	}
+	return result
+}
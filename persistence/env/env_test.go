@@ -0,0 +1,66 @@
+package env_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/env"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+)
+
+func environ(configs []oauthenticator.ConfigDefinition) []string {
+	var result []string
+	for _, c := range configs {
+		prefix := env.Prefix + strings.ToUpper(c.Identifier) + "_"
+		result = append(result,
+			prefix+"CLIENTID="+c.ClientID,
+			prefix+"CLIENTSECRET="+c.ClientSecret,
+			prefix+"AUTHURL="+c.AuthURL,
+			prefix+"TOKENURL="+c.TokenURL,
+			prefix+"LABEL="+c.Label,
+			prefix+"TYPE="+c.Type,
+			prefix+"SCOPES="+strings.Join(c.Scopes, " "),
+		)
+		for key, value := range c.Params {
+			result = append(result, prefix+"PARAM_"+strings.ToUpper(key)+"="+value)
+		}
+	}
+	return append(result, "PATH=/usr/bin", "OAUTH_INCOMPLETE_CLIENTID=id")
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+		redirectURL := ""
+		if len(configs) > 0 {
+			redirectURL = configs[0].RedirectURL
+		}
+		return env.New(environ(configs), memory.NewTokenStore(), redirectURL)
+	})
+}
+
+func TestParse(t *testing.T) {
+	configs := env.Parse([]string{
+		"OAUTH_MY_APP_CLIENTID=id",
+		"OAUTH_MY_APP_AUTHURL=https://login.example.com/authorize",
+		"OAUTH_MY_APP_TOKENURL=https://login.example.com/token",
+		"OAUTH_MY_APP_SCOPES=openid,profile email",
+		"OAUTH_MY_APP_PARAM_LOGIN_HINT=user@example.com",
+		"OAUTH_MY_APP_REDIRECTURL=https://app.example.com/verify",
+		"OAUTH_OTHER_CLIENTID=other",
+	})
+	if len(configs) != 1 {
+		t.Fatal(configs)
+	}
+	c := configs[0]
+	if c.Identifier != "my_app" || c.Label != "my_app" || c.RedirectURL != "https://app.example.com/verify" {
+		t.Fatal(c)
+	}
+	if strings.Join(c.Scopes, " ") != "openid profile email" {
+		t.Fatal(c.Scopes)
+	}
+	if len(c.Params) != 1 || c.Params["login_hint"] != "user@example.com" {
+		t.Fatal(c.Params)
+	}
+}
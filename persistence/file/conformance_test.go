@@ -0,0 +1,65 @@
+package file_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/file"
+)
+
+func newProvider(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+	dir := t.TempDir()
+	redirectURL := ""
+	for _, c := range configs {
+		data, err := json.Marshal(&file.Configdata{
+			Type_:        c.Type,
+			Label_:       c.Label,
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			AuthURL:      c.AuthURL,
+			TokenURL:     c.TokenURL,
+			Scopes:       c.Scopes,
+			Params:       c.Params,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(dir+"/"+c.Identifier+".json", data, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		redirectURL = c.RedirectURL
+	}
+	// not a config
+	err := os.WriteFile(dir+"/broken.json", []byte("{"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file.NewDirectory(dir, redirectURL)
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, newProvider)
+}
+
+func TestTokenDirectoryConformance(t *testing.T) {
+	conformance.RunTokenStore(t, func(t *testing.T) oauthenticator.TokenStore {
+		return file.NewTokenDirectory(t.TempDir())
+	})
+}
+
+func TestUnreadableToken(t *testing.T) {
+	dir := t.TempDir()
+	// reading a directory fails, which is not the absence of a token
+	err := os.Mkdir(dir+"/test.token", 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = file.NewTokenDirectory(dir).Accounts("test").Token(oauthenticator.DefaultAccount).Token()
+	if err == nil {
+		t.Fatal("unreadable token reported as missing")
+	}
+}
@@ -2,9 +2,14 @@ package file
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/balazsgrill/oauthenticator"
 	"golang.org/x/oauth2"
@@ -17,6 +22,7 @@ type Configdata struct {
 	ClientSecret string            `json:"clientsecret"`
 	AuthURL      string            `json:"authurl"`
 	TokenURL     string            `json:"tokenurl"`
+	Scopes       []string          `json:"scopes"`
 	Params       map[string]string `json:"params"`
 }
 
@@ -56,13 +62,17 @@ func (c *config) Config() *oauth2.Config {
 		ClientSecret: c.ClientSecret,
 		Endpoint:     c.Endpoint(),
 		RedirectURL:  c.provider.redirecturl,
-		Scopes:       []string{},
+		Scopes:       c.Scopes,
 	}
 }
 
 func (c *config) Token() oauthenticator.TokenPersistence {
 	return c.provider.Token(c)
 }
+func (c *config) Accounts() oauthenticator.Accounts {
+	return c.provider.Accounts(c)
+}
+
 func (c *config) Options() []oauth2.AuthCodeOption {
 	return c.provider.Options(c)
 }
@@ -79,13 +89,28 @@ var _ oauthenticator.Config = &config{}
 type directoryProvider struct {
 	path        string
 	redirecturl string
+	tokenlock   sync.Mutex
+	sealer      oauthenticator.Sealer
 }
 
-func NewDirectory(path string, redirectURL string) oauthenticator.Provider {
-	return &directoryProvider{
+type Option func(*directoryProvider)
+
+// Encrypt encrypts the tokens written to the token files
+func Encrypt(sealer oauthenticator.Sealer) Option {
+	return func(p *directoryProvider) {
+		p.sealer = sealer
+	}
+}
+
+func NewDirectory(path string, redirectURL string, options ...Option) oauthenticator.Provider {
+	p := &directoryProvider{
 		path:        path,
 		redirecturl: redirectURL,
 	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
 }
 
 func (p *directoryProvider) Configs() ([]oauthenticator.Config, error) {
@@ -99,9 +124,9 @@ func (p *directoryProvider) Configs() ([]oauthenticator.Config, error) {
 			c, err := p.Config(p.path + "/" + entry.Name())
 			if err != nil {
 				log.Println(err)
+				continue
 			}
 			result = append(result, c)
-
 		}
 	}
 	return result, nil
@@ -127,37 +152,26 @@ func (p *directoryProvider) Config(identifier string) (oauthenticator.Config, er
 		path:     identifier,
 	}
 	err := c.load()
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+	}
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-type tokenfile struct {
-	path string
-}
-
-func (tp *tokenfile) SetToken(t *oauth2.Token) {
-	data, err := json.Marshal(t)
-	if err != nil {
-		data = make([]byte, 0)
-	}
-	os.WriteFile(tp.path, data, 0666)
-}
-
-func (tp *tokenfile) Token() (*oauth2.Token, error) {
-	data, err := os.ReadFile(tp.path)
-	if err != nil || len(data) == 0 {
-		// possibly not existing file
-		return nil, nil
-	}
-	t := &oauth2.Token{}
-	return t, json.Unmarshal(data, t)
+func (p *directoryProvider) Token(c *config) oauthenticator.TokenPersistence {
+	return oauthenticator.SelectedToken(p.Accounts(c))
 }
 
-func (p *directoryProvider) Token(c *config) oauthenticator.TokenPersistence {
+func (p *directoryProvider) Accounts(c *config) oauthenticator.Accounts {
 	return &tokenfile{
 		path: c.path + ".token",
+		// the directory may be moved, only the name of the config is bound
+		config: filepath.Base(c.path),
+		lock:   &p.tokenlock,
+		sealer: p.sealer,
 	}
 }
 
@@ -1,9 +1,11 @@
 package file_test
 
 import (
+	"os"
 	"testing"
 
 	"github.com/balazsgrill/oauthenticator/persistence/file"
+	"golang.org/x/oauth2"
 )
 
 func Test_loadjson(t *testing.T) {
@@ -16,7 +18,60 @@ func Test_loadjson(t *testing.T) {
 	if d.Label_ != "example config" {
 		t.Fail()
 	}
-	if d.Params["scope"] != "profile all" {
+	if len(d.Scopes) != 2 || d.Scopes[0] != "profile" || d.Scopes[1] != "all" {
+		t.Fail()
+	}
+	if d.Params["resource"] != "https://data.example.com/" {
+		t.Fail()
+	}
+}
+
+func Test_accounts(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile("../../example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/example.json", data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// token file written by earlier versions
+	err = os.WriteFile(dir+"/example.json.token", []byte(`{"access_token":"legacy"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := file.NewDirectory(dir, "").Config(dir + "/example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Token().Token()
+	if err != nil || token == nil || token.AccessToken != "legacy" {
+		t.Fatal(token, err)
+	}
+
+	accounts := c.Accounts()
+	accounts.Token("other").SetToken(&oauth2.Token{AccessToken: "other"})
+	err = accounts.Select("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := accounts.List()
+	if err != nil || len(names) != 2 {
+		t.Fatal(names, err)
+	}
+	token, _ = c.Token().Token()
+	if token.AccessToken != "other" {
+		t.Fail()
+	}
+
+	err = accounts.Remove("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ = c.Token().Token()
+	if token.AccessToken != "legacy" {
 		t.Fail()
 	}
 }
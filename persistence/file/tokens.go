@@ -0,0 +1,210 @@
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// tokenfile stores all accounts of a config in a single file. Files written
+// by earlier versions contain a single token, which is read as the default
+// account.
+type tokenfile struct {
+	path string
+	// config identifies the config in sealed tokens
+	config string
+	lock   *sync.Mutex
+	sealer oauthenticator.Sealer
+}
+
+type tokenDirectory struct {
+	provider *directoryProvider
+}
+
+// NewTokenDirectory creates a token store keeping the tokens of each config in
+// a file of the directory, named after the identifier of the config
+func NewTokenDirectory(path string, options ...Option) oauthenticator.TokenStore {
+	return &tokenDirectory{
+		provider: NewDirectory(path, "", options...).(*directoryProvider),
+	}
+}
+
+func (d *tokenDirectory) Accounts(identifier string) oauthenticator.Accounts {
+	return &tokenfile{
+		path:   filepath.Join(d.provider.path, url.PathEscape(identifier)+".token"),
+		config: identifier,
+		lock:   &d.provider.tokenlock,
+		sealer: d.provider.sealer,
+	}
+}
+
+type tokenfiledata struct {
+	Selected string                     `json:"selected,omitempty"`
+	Accounts map[string]json.RawMessage `json:"accounts"`
+}
+
+type accountToken struct {
+	file    *tokenfile
+	account string
+}
+
+func (tf *tokenfile) load() (*tokenfiledata, error) {
+	d := &tokenfiledata{
+		Accounts: make(map[string]json.RawMessage),
+	}
+	data, err := os.ReadFile(tf.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return d, nil
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fields["accounts"]; !ok {
+		if fields != nil {
+			d.Accounts[oauthenticator.DefaultAccount] = data
+		}
+		return d, nil
+	}
+	err = json.Unmarshal(data, d)
+	if d.Accounts == nil {
+		d.Accounts = make(map[string]json.RawMessage)
+	}
+	return d, err
+}
+
+func (tf *tokenfile) save(d *tokenfiledata) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	tmp := tf.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, tf.path)
+}
+
+func (tf *tokenfile) update(f func(d *tokenfiledata) error) error {
+	tf.lock.Lock()
+	defer tf.lock.Unlock()
+	d, err := tf.load()
+	if err != nil {
+		return err
+	}
+	err = f(d)
+	if err != nil {
+		return err
+	}
+	return tf.save(d)
+}
+
+func (tf *tokenfile) read() (*tokenfiledata, error) {
+	tf.lock.Lock()
+	defer tf.lock.Unlock()
+	return tf.load()
+}
+
+func (tf *tokenfile) List() ([]string, error) {
+	d, err := tf.read()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(d.Accounts))
+	for account := range d.Accounts {
+		result = append(result, account)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (tf *tokenfile) Token(account string) oauthenticator.TokenPersistence {
+	return &accountToken{
+		file:    tf,
+		account: account,
+	}
+}
+
+func (tf *tokenfile) Selected() (string, error) {
+	d, err := tf.read()
+	if err != nil {
+		return "", err
+	}
+	if _, ok := d.Accounts[d.Selected]; ok {
+		return d.Selected, nil
+	}
+	accounts := make([]string, 0, len(d.Accounts))
+	for account := range d.Accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return oauthenticator.SelectedAccount(accounts), nil
+}
+
+func (tf *tokenfile) Select(account string) error {
+	return tf.update(func(d *tokenfiledata) error {
+		d.Selected = account
+		return nil
+	})
+}
+
+func (tf *tokenfile) Remove(account string) error {
+	return tf.update(func(d *tokenfiledata) error {
+		delete(d.Accounts, account)
+		if d.Selected == account {
+			d.Selected = ""
+		}
+		return nil
+	})
+}
+
+func (at *accountToken) SetToken(t *oauth2.Token) {
+	var err error
+	if t == nil {
+		err = at.file.Remove(at.account)
+	} else {
+		err = at.setToken(t)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (at *accountToken) setToken(t *oauth2.Token) error {
+	data, err := oauthenticator.SealToken(at.file.sealer, t, at.file.config, at.account)
+	if err != nil {
+		return err
+	}
+	return at.file.update(func(d *tokenfiledata) error {
+		d.Accounts[at.account] = data
+		return nil
+	})
+}
+
+func (at *accountToken) Token() (*oauth2.Token, error) {
+	d, err := at.file.read()
+	if err != nil {
+		return nil, err
+	}
+	data, ok := d.Accounts[at.account]
+	if !ok {
+		return nil, nil
+	}
+	return oauthenticator.OpenToken(at.file.sealer, data, at.file.config, at.account)
+}
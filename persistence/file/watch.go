@@ -0,0 +1,61 @@
+package file
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Watch polls the directory in the given interval and sends an event when
+// files are added, removed or modified. The channel is closed after stop is
+// closed.
+func Watch(path string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	events := make(chan struct{}, 1)
+	last := snapshot(path)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			current := snapshot(path)
+			if current == last {
+				continue
+			}
+			last = current
+			select {
+			case events <- struct{}{}:
+			default:
+				// an event is already pending
+			}
+		}
+	}()
+	return events
+}
+
+// snapshot describes the entries of the directory by name, size and
+// modification time
+func snapshot(path string) string {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		log.Println(err)
+		return ""
+	}
+	var result []byte
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		result = append(result, entry.Name()...)
+		result = append(result, info.ModTime().String()...)
+		result = strconv.AppendInt(result, info.Size(), 10)
+		result = append(result, 0)
+	}
+	return string(result)
+}
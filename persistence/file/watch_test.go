@@ -0,0 +1,49 @@
+package file_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator/persistence/file"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	stop := make(chan struct{})
+	events := file.Watch(dir, 5*time.Millisecond, stop)
+
+	err := os.WriteFile(dir+"/example.json", []byte("{}"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("no event on new file")
+	}
+
+	// grows by 256 bytes with the same modification time
+	info, err := os.Stat(dir + "/example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/example.json", []byte(`{"label":"`+strings.Repeat("x", 2+256-12)+`"}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chtimes(dir+"/example.json", info.ModTime(), info.ModTime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-events:
+	case <-time.After(time.Second):
+		t.Fatal("no event on resized file")
+	}
+
+	close(stop)
+	for range events {
+	}
+}
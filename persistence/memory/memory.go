@@ -0,0 +1,301 @@
+// Package memory keeps configs and tokens in memory, for embedding
+// oauthenticator into other programs and for tests. The state can be saved
+// with Snapshot and loaded with Restore or Load.
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// Snapshot is the state of a provider
+type Snapshot struct {
+	Configs  []oauthenticator.ConfigDefinition `json:"configs"`
+	Accounts map[string]AccountsSnapshot       `json:"accounts,omitempty"`
+}
+
+// AccountsSnapshot holds the tokens of a config, by account
+type AccountsSnapshot struct {
+	Selected string                     `json:"selected,omitempty"`
+	Tokens   map[string]json.RawMessage `json:"tokens"`
+}
+
+type accountsData struct {
+	selected string
+	tokens   map[string][]byte
+}
+
+// Provider is a thread-safe in-memory provider
+type Provider struct {
+	lock     sync.RWMutex
+	configs  map[string]oauthenticator.ConfigDefinition
+	accounts map[string]*accountsData
+}
+
+type config struct {
+	provider   *Provider
+	definition oauthenticator.ConfigDefinition
+}
+
+var _ oauthenticator.WritableProvider = &Provider{}
+
+// New creates a provider holding the given configs, without tokens. Configs
+// with the same identifier replace earlier ones.
+func New(configs ...oauthenticator.ConfigDefinition) *Provider {
+	p := &Provider{
+		configs:  make(map[string]oauthenticator.ConfigDefinition),
+		accounts: make(map[string]*accountsData),
+	}
+	for _, def := range configs {
+		p.put(def)
+	}
+	return p
+}
+
+// Load creates a provider from JSON, either a Snapshot or an array of config
+// definitions.
+func Load(r io.Reader) (*Provider, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		err = json.Unmarshal(data, &snapshot.Configs)
+	} else {
+		err = json.Unmarshal(data, &snapshot)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p := New()
+	return p, p.Restore(snapshot)
+}
+
+// Snapshot returns a copy of the configs and tokens held
+func (p *Provider) Snapshot() Snapshot {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	result := Snapshot{
+		Configs:  make([]oauthenticator.ConfigDefinition, 0, len(p.configs)),
+		Accounts: make(map[string]AccountsSnapshot),
+	}
+	for _, identifier := range p.identifiers() {
+		result.Configs = append(result.Configs, copyDefinition(p.configs[identifier]))
+		accounts := p.accounts[identifier]
+		if len(accounts.tokens) == 0 {
+			continue
+		}
+		tokens := make(map[string]json.RawMessage, len(accounts.tokens))
+		for account, data := range accounts.tokens {
+			tokens[account] = append(json.RawMessage(nil), data...)
+		}
+		result.Accounts[identifier] = AccountsSnapshot{
+			Selected: accounts.selected,
+			Tokens:   tokens,
+		}
+	}
+	return result
+}
+
+// Restore replaces the configs and tokens with the ones of the snapshot
+func (p *Provider) Restore(snapshot Snapshot) error {
+	configs := make(map[string]oauthenticator.ConfigDefinition, len(snapshot.Configs))
+	accounts := make(map[string]*accountsData, len(snapshot.Configs))
+	for _, def := range snapshot.Configs {
+		if def.Identifier == "" {
+			return errors.New("config identifier is empty")
+		}
+		configs[def.Identifier] = copyDefinition(def)
+		accounts[def.Identifier] = &accountsData{
+			tokens: make(map[string][]byte),
+		}
+	}
+	for identifier, snapshotAccounts := range snapshot.Accounts {
+		a, ok := accounts[identifier]
+		if !ok {
+			return fmt.Errorf("tokens of unknown config: %s", identifier)
+		}
+		a.selected = snapshotAccounts.Selected
+		for account, data := range snapshotAccounts.Tokens {
+			_, err := oauthenticator.UnmarshalToken(data)
+			if err != nil {
+				return fmt.Errorf("invalid token of %s in %s: %w", account, identifier, err)
+			}
+			a.tokens[account] = append([]byte(nil), data...)
+		}
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.configs = configs
+	p.accounts = accounts
+	return nil
+}
+
+func copyDefinition(def oauthenticator.ConfigDefinition) oauthenticator.ConfigDefinition {
+	def.Scopes = append([]string(nil), def.Scopes...)
+	if def.Params != nil {
+		params := make(map[string]string, len(def.Params))
+		for key, value := range def.Params {
+			params[key] = value
+		}
+		def.Params = params
+	}
+	return def
+}
+
+// identifiers returns the sorted identifiers of the configs, the lock must be held
+func (p *Provider) identifiers() []string {
+	result := make([]string, 0, len(p.configs))
+	for identifier := range p.configs {
+		result = append(result, identifier)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (p *Provider) filter(accept func(def *oauthenticator.ConfigDefinition) bool) []oauthenticator.Config {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	var result []oauthenticator.Config
+	for _, identifier := range p.identifiers() {
+		def := p.configs[identifier]
+		if accept(&def) {
+			result = append(result, &config{
+				provider:   p,
+				definition: copyDefinition(def),
+			})
+		}
+	}
+	return result
+}
+
+func (p *Provider) Configs() ([]oauthenticator.Config, error) {
+	return p.filter(func(*oauthenticator.ConfigDefinition) bool { return true }), nil
+}
+
+func (p *Provider) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	return p.filter(func(def *oauthenticator.ConfigDefinition) bool { return def.Type == ctype }), nil
+}
+
+func (p *Provider) Config(identifier string) (oauthenticator.Config, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	def, ok := p.configs[identifier]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+	}
+	return &config{
+		provider:   p,
+		definition: copyDefinition(def),
+	}, nil
+}
+
+// put stores a config, the lock must be held
+func (p *Provider) put(def oauthenticator.ConfigDefinition) {
+	p.configs[def.Identifier] = copyDefinition(def)
+	if _, ok := p.accounts[def.Identifier]; !ok {
+		p.accounts[def.Identifier] = &accountsData{
+			tokens: make(map[string][]byte),
+		}
+	}
+}
+
+var _ oauthenticator.BatchWriter = &Provider{}
+
+func (p *Provider) PutConfig(def oauthenticator.ConfigDefinition) (oauthenticator.Config, error) {
+	result, err := p.PutConfigs([]oauthenticator.ConfigDefinition{def})
+	if err != nil {
+		return nil, err
+	}
+	return result[0], nil
+}
+
+// PutConfigs stores the configs while holding the lock
+func (p *Provider) PutConfigs(defs []oauthenticator.ConfigDefinition) ([]oauthenticator.Config, error) {
+	for _, def := range defs {
+		if def.Identifier == "" {
+			return nil, errors.New("config identifier is empty")
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := make([]oauthenticator.Config, len(defs))
+	for i, def := range defs {
+		p.put(def)
+		result[i] = &config{
+			provider:   p,
+			definition: copyDefinition(def),
+		}
+	}
+	return result, nil
+}
+
+func (p *Provider) RemoveConfig(identifier string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if _, ok := p.configs[identifier]; !ok {
+		return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+	}
+	delete(p.configs, identifier)
+	delete(p.accounts, identifier)
+	return nil
+}
+
+func (c *config) Type() string {
+	return c.definition.Type
+}
+
+func (c *config) Identifier() string {
+	return c.definition.Identifier
+}
+
+func (c *config) Label() string {
+	return c.definition.Label
+}
+
+func (c *config) Config() *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     c.definition.ClientID,
+		ClientSecret: c.definition.ClientSecret,
+		Endpoint:     c.Endpoint(),
+		RedirectURL:  c.definition.RedirectURL,
+		Scopes:       c.definition.Scopes,
+	}
+}
+
+func (c *config) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  c.definition.AuthURL,
+		TokenURL: c.definition.TokenURL,
+	}
+}
+
+func (c *config) Token() oauthenticator.TokenPersistence {
+	return oauthenticator.SelectedToken(c.Accounts())
+}
+
+func (c *config) Accounts() oauthenticator.Accounts {
+	return &accounts{
+		provider: c.provider,
+		config:   c.definition.Identifier,
+	}
+}
+
+func (c *config) Options() []oauth2.AuthCodeOption {
+	var result []oauth2.AuthCodeOption
+	for key, value := range c.definition.Params {
+		result = append(result, oauth2.SetAuthURLParam(key, value))
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package memory_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+	"golang.org/x/oauth2"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.RunWritable(t, func(t *testing.T) oauthenticator.WritableProvider {
+		return memory.New()
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	p := memory.New(conformance.Configs()...)
+	c, err := p.Config("mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = oauthenticator.StoreToken(c.Accounts(), "work", &oauth2.Token{AccessToken: "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshot := p.Snapshot()
+
+	c.Accounts().Remove("work")
+	err = p.RemoveConfig("calendar")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// snapshots survive serialization
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := memory.Load(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Restore(restored.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs, _ := p.Configs()
+	if len(configs) != len(conformance.Configs()) {
+		t.Fatal(configs)
+	}
+	token, err := c.Token().Token()
+	if err != nil || token == nil || token.AccessToken != "work" {
+		t.Fatal(token, err)
+	}
+}
+
+func TestLoadDefinitions(t *testing.T) {
+	p, err := memory.Load(strings.NewReader(`[{"identifier": "example", "label": "Example", "clientid": "id", "scopes": ["profile"]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Config("example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Label() != "Example" || c.Config().ClientID != "id" || len(c.Config().Scopes) != 1 {
+		t.Fatal(oauthenticator.Definition(c))
+	}
+
+	_, err = memory.Load(strings.NewReader(`{"configs": [], "accounts": {"unknown": {"tokens": {}}}}`))
+	if err == nil {
+		t.Fatal("tokens of unknown config accepted")
+	}
+}
+
+func TestTokenStoreConformance(t *testing.T) {
+	conformance.RunTokenStore(t, func(t *testing.T) oauthenticator.TokenStore {
+		return memory.NewTokenStore()
+	})
+}
@@ -0,0 +1,155 @@
+package memory
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+type accounts struct {
+	provider *Provider
+	config   string
+	// standalone accounts are not bound to a config of the provider
+	standalone bool
+}
+
+type tokenStore struct {
+	provider *Provider
+}
+
+// NewTokenStore creates a token store keeping tokens in memory
+func NewTokenStore() oauthenticator.TokenStore {
+	return &tokenStore{
+		provider: New(),
+	}
+}
+
+func (s *tokenStore) Accounts(identifier string) oauthenticator.Accounts {
+	return &accounts{
+		provider:   s.provider,
+		config:     identifier,
+		standalone: true,
+	}
+}
+
+type accountToken struct {
+	accounts *accounts
+	account  string
+}
+
+func (a *accounts) view(f func(data *accountsData)) error {
+	a.provider.lock.RLock()
+	defer a.provider.lock.RUnlock()
+	data, ok := a.provider.accounts[a.config]
+	if !ok && a.standalone {
+		data, ok = &accountsData{}, true
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, a.config)
+	}
+	f(data)
+	return nil
+}
+
+func (a *accounts) update(f func(data *accountsData)) error {
+	a.provider.lock.Lock()
+	defer a.provider.lock.Unlock()
+	data, ok := a.provider.accounts[a.config]
+	if !ok && a.standalone {
+		data, ok = &accountsData{tokens: make(map[string][]byte)}, true
+		a.provider.accounts[a.config] = data
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, a.config)
+	}
+	f(data)
+	return nil
+}
+
+func (d *accountsData) list() []string {
+	result := make([]string, 0, len(d.tokens))
+	for account := range d.tokens {
+		result = append(result, account)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func (a *accounts) List() ([]string, error) {
+	var result []string
+	err := a.view(func(data *accountsData) {
+		result = data.list()
+	})
+	return result, err
+}
+
+func (a *accounts) Token(account string) oauthenticator.TokenPersistence {
+	return &accountToken{
+		accounts: a,
+		account:  account,
+	}
+}
+
+func (a *accounts) Selected() (string, error) {
+	var result string
+	err := a.view(func(data *accountsData) {
+		if _, ok := data.tokens[data.selected]; ok {
+			result = data.selected
+		} else {
+			result = oauthenticator.SelectedAccount(data.list())
+		}
+	})
+	return result, err
+}
+
+func (a *accounts) Select(account string) error {
+	return a.update(func(data *accountsData) {
+		data.selected = account
+	})
+}
+
+func (a *accounts) Remove(account string) error {
+	return a.update(func(data *accountsData) {
+		delete(data.tokens, account)
+		if data.selected == account {
+			data.selected = ""
+		}
+	})
+}
+
+func (at *accountToken) Token() (*oauth2.Token, error) {
+	var token []byte
+	err := at.accounts.view(func(data *accountsData) {
+		token = data.tokens[at.account]
+	})
+	if err != nil || token == nil {
+		return nil, err
+	}
+	// stored serialized, so callers can not alter the stored token
+	return oauthenticator.UnmarshalToken(token)
+}
+
+func (at *accountToken) SetToken(t *oauth2.Token) {
+	var err error
+	if t == nil {
+		err = at.accounts.Remove(at.account)
+	} else {
+		err = at.setToken(t)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (at *accountToken) setToken(t *oauth2.Token) error {
+	token, err := oauthenticator.MarshalToken(t)
+	if err != nil {
+		return err
+	}
+	return at.accounts.update(func(data *accountsData) {
+		data.tokens[at.account] = token
+	})
+}
@@ -0,0 +1,331 @@
+package sparql
+
+import (
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/knakk/rdf"
+	"golang.org/x/oauth2"
+)
+
+// accountsInRepo stores the token of the default account directly on the
+// client, as earlier versions did. Named accounts are separate nodes linked
+// to the client with oauth:account.
+type accountsInRepo struct {
+	provider *sparqlProvider
+	client   rdf.Term
+}
+
+type tokenStore struct {
+	provider *sparqlProvider
+}
+
+// NewTokenStore creates a token store over the given repository, for configs
+// of other providers. Identifiers that are not IRIs are turned into URNs.
+func NewTokenStore(repo Repo, options ...Option) (oauthenticator.TokenStore, error) {
+	p, err := NewSparql(repo, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenStore{
+		provider: p.(*sparqlProvider),
+	}, nil
+}
+
+// ClientIRI returns the IRI the token store keeps the tokens of a config
+// under: the identifier if it is an IRI, or an URN derived from it otherwise
+func ClientIRI(identifier string) (rdf.Term, error) {
+	client, err := rdf.NewIRI(identifier)
+	if err == nil && strings.Contains(identifier, ":") {
+		return client, nil
+	}
+	return rdf.NewIRI("urn:oauthenticator:config:" + url.PathEscape(identifier))
+}
+
+func (s *tokenStore) Accounts(identifier string) oauthenticator.Accounts {
+	client, err := ClientIRI(identifier)
+	if err != nil {
+		return invalidAccounts{err: err}
+	}
+	return &accountsInRepo{
+		provider: s.provider,
+		client:   client,
+	}
+}
+
+// invalidAccounts are the accounts of an identifier no client IRI could be
+// made of, all of their operations fail
+type invalidAccounts struct {
+	err error
+}
+
+func (a invalidAccounts) List() ([]string, error) {
+	return nil, a.err
+}
+
+func (a invalidAccounts) Token(account string) oauthenticator.TokenPersistence {
+	return invalidToken(a)
+}
+
+func (a invalidAccounts) Selected() (string, error) {
+	return "", a.err
+}
+
+func (a invalidAccounts) Select(account string) error {
+	return a.err
+}
+
+func (a invalidAccounts) Remove(account string) error {
+	return a.err
+}
+
+type invalidToken struct {
+	err error
+}
+
+func (t invalidToken) Token() (*oauth2.Token, error) {
+	return nil, t.err
+}
+
+func (t invalidToken) SetToken(token *oauth2.Token) {
+	log.Println(t.err)
+}
+
+type tokenInRepo struct {
+	accounts *accountsInRepo
+	account  string
+}
+
+// accountTerm returns the node holding the token of the given account of the
+// client.
+func accountTerm(client rdf.Term, account string) (rdf.Term, error) {
+	if account == oauthenticator.DefaultAccount {
+		return client, nil
+	}
+	return rdf.NewIRI(client.String() + "/accounts/" + url.PathEscape(account))
+}
+
+func (a *accountsInRepo) List() ([]string, error) {
+	q := a.provider.queries
+	repo := a.provider.repo
+	accounts, err := q.ReadAccounts(repo, a.client)
+	if err != nil {
+		return nil, err
+	}
+	t, err := q.ReadToken(repo, a.client, oauthenticator.DefaultAccount)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		accounts = append(accounts, oauthenticator.DefaultAccount)
+	}
+	sort.Strings(accounts)
+	return accounts, nil
+}
+
+func (a *accountsInRepo) Token(account string) oauthenticator.TokenPersistence {
+	return &tokenInRepo{
+		accounts: a,
+		account:  account,
+	}
+}
+
+func (a *accountsInRepo) Selected() (string, error) {
+	selected, err := a.provider.queries.ReadSelectedAccount(a.provider.repo, a.client)
+	if err != nil {
+		return "", err
+	}
+	accounts, err := a.List()
+	if err != nil {
+		return "", err
+	}
+	for _, account := range accounts {
+		if account == selected {
+			return selected, nil
+		}
+	}
+	return oauthenticator.SelectedAccount(accounts), nil
+}
+
+func (a *accountsInRepo) Select(account string) error {
+	return a.provider.queries.WriteSelectedAccount(a.provider.repo, a.client, account)
+}
+
+func (a *accountsInRepo) Remove(account string) error {
+	q := a.provider.queries
+	repo := a.provider.repo
+	term, err := accountTerm(a.client, account)
+	if err != nil {
+		return err
+	}
+	err = q.RemoveToken(repo, term)
+	if err != nil {
+		return err
+	}
+	if account == oauthenticator.DefaultAccount {
+		return nil
+	}
+	return q.RemoveAccount(repo, a.client, term)
+}
+
+func (tp *tokenInRepo) Token() (*oauth2.Token, error) {
+	return tp.accounts.provider.queries.ReadToken(tp.accounts.provider.repo, tp.accounts.client, tp.account)
+}
+
+func (tp *tokenInRepo) SetToken(t *oauth2.Token) {
+	var err error
+	if t == nil {
+		err = tp.accounts.Remove(tp.account)
+	} else {
+		err = tp.setToken(t)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (tp *tokenInRepo) setToken(t *oauth2.Token) error {
+	q := tp.accounts.provider.queries
+	repo := tp.accounts.provider.repo
+	err := q.WriteToken(repo, tp.accounts.client, tp.account, t)
+	if err != nil {
+		return err
+	}
+	if tp.account == oauthenticator.DefaultAccount {
+		return nil
+	}
+	term, err := accountTerm(tp.accounts.client, tp.account)
+	if err != nil {
+		return err
+	}
+	return q.AddAccount(repo, tp.accounts.client, term, tp.account)
+}
+
+func (q *Queries) ReadAccounts(repo Repo, client rdf.Term) ([]string, error) {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return nil, err
+	}
+	query, err := q.prepare("accounts", queryArgs{
+		Client: clientarg,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := repo.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []string
+	for _, solution := range result.Solutions() {
+		account, err := binding(solution, "account")
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (q *Queries) AddAccount(repo Repo, client rdf.Term, account rdf.Term, label string) error {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return err
+	}
+	accountarg, err := termArg(account)
+	if err != nil {
+		return err
+	}
+	labelarg, err := literalArg(label)
+	if err != nil {
+		return err
+	}
+	query, err := q.prepare("addaccount", queryArgs{
+		Client:  clientarg,
+		Account: accountarg,
+		Label:   labelarg,
+	})
+	if err != nil {
+		return err
+	}
+	return repo.Update(query)
+}
+
+func (q *Queries) RemoveAccount(repo Repo, client rdf.Term, account rdf.Term) error {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return err
+	}
+	accountarg, err := termArg(account)
+	if err != nil {
+		return err
+	}
+	query, err := q.prepare("removeaccount", queryArgs{
+		Client:  clientarg,
+		Account: accountarg,
+	})
+	if err != nil {
+		return err
+	}
+	return repo.Update(query)
+}
+
+func (q *Queries) RemoveToken(repo Repo, client rdf.Term) error {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return err
+	}
+	query, err := q.prepare("removetoken", queryArgs{
+		Client: clientarg,
+	})
+	if err != nil {
+		return err
+	}
+	return repo.Update(query)
+}
+
+func (q *Queries) ReadSelectedAccount(repo Repo, client rdf.Term) (string, error) {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return "", err
+	}
+	query, err := q.prepare("selectedaccount", queryArgs{
+		Client: clientarg,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result, err := repo.Query(query)
+	if err != nil {
+		return "", err
+	}
+	for _, solution := range result.Solutions() {
+		return binding(solution, "account")
+	}
+	return "", nil
+}
+
+func (q *Queries) WriteSelectedAccount(repo Repo, client rdf.Term, account string) error {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return err
+	}
+	labelarg, err := literalArg(account)
+	if err != nil {
+		return err
+	}
+	query, err := q.prepare("selectaccount", queryArgs{
+		Client: clientarg,
+		Label:  labelarg,
+	})
+	if err != nil {
+		return err
+	}
+	return repo.Update(query)
+}
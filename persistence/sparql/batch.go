@@ -0,0 +1,105 @@
+package sparql
+
+import (
+	"errors"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/knakk/rdf"
+	"golang.org/x/oauth2"
+)
+
+var _ oauthenticator.Batcher = &sparqlProvider{}
+
+// batchState collects the solutions of the batch query belonging to a client
+type batchState struct {
+	config   *OAuthConfig
+	params   [][2]string
+	seen     map[string]bool
+	tokens   map[string]*oauth2.Token
+	selected string
+}
+
+// Batch reads all configs with their scopes, parameters and tokens in a
+// single query
+func (p *sparqlProvider) Batch() ([]oauthenticator.ConfigState, error) {
+	query, err := p.queries.prepare("batch", queryArgs{})
+	if err != nil {
+		return nil, err
+	}
+	res, err := p.repo.Query(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []*batchState
+	byClient := make(map[string]*batchState)
+	for _, solution := range res.Solutions() {
+		client, ok := solution["client"]
+		if !ok || client == nil {
+			return nil, errors.New("variable not bound: client")
+		}
+		if client.Type() != rdf.TermIRI {
+			continue
+		}
+		key := client.Serialize(rdf.NTriples)
+		state, ok := byClient[key]
+		if !ok {
+			c, err := configFromSolution(p, client, solution)
+			if err != nil {
+				return nil, err
+			}
+			state = &batchState{
+				config: c,
+				seen:   make(map[string]bool),
+				tokens: make(map[string]*oauth2.Token),
+			}
+			byClient[key] = state
+			states = append(states, state)
+		}
+		err = state.add(p.queries, solution)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]oauthenticator.ConfigState, len(states))
+	for i, state := range states {
+		var options []oauth2.AuthCodeOption
+		for _, param := range state.params {
+			options = append(options, oauth2.SetAuthURLParam(param[0], param[1]))
+		}
+		result[i] = oauthenticator.ConfigState{
+			Config:   state.config,
+			OAuth2:   state.config.Config(),
+			Options:  options,
+			Tokens:   state.tokens,
+			Selected: state.selected,
+		}
+	}
+	return result, nil
+}
+
+// add records the type, scope, parameter, token or selected account bound in
+// the solution. Solutions are repeated for every type of the client.
+func (s *batchState) add(q *Queries, solution map[string]rdf.Term) error {
+	s.config.addSolution(solution)
+	if option := optionalBinding(solution, "option"); option != "" && !s.seen["param "+option] {
+		s.seen["param "+option] = true
+		s.params = append(s.params, [2]string{option, optionalBinding(solution, "value")})
+	}
+	if data := optionalBinding(solution, "token"); data != "" {
+		account := optionalBinding(solution, "account")
+		if account == "" {
+			account = oauthenticator.DefaultAccount
+		}
+		token, err := oauthenticator.OpenToken(q.sealer, []byte(data), s.config.client.String(), account)
+		if err != nil {
+			return err
+		}
+		s.tokens[account] = token
+	}
+	if selected := optionalBinding(solution, "selected"); selected != "" {
+		s.selected = selected
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package sparql_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/sparql"
+	"github.com/balazsgrill/oauthenticator/persistence/sparql/sparqltest"
+	"github.com/knakk/rdf"
+)
+
+func literal(value string) string {
+	l, err := rdf.NewLiteral(value)
+	if err != nil {
+		panic(err)
+	}
+	return l.Serialize(rdf.NTriples)
+}
+
+func newProvider(t *testing.T, configs []oauthenticator.ConfigDefinition) oauthenticator.Provider {
+	srv := sparqltest.NewServer()
+	t.Cleanup(srv.Close)
+
+	data := &strings.Builder{}
+	data.WriteString(`PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
+PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+PREFIX oauth: <https://oauth.net/2#>
+PREFIX dc: <http://purl.org/dc/elements/1.1/>
+INSERT DATA { GRAPH <http://example.com/configs> {
+`)
+	for _, c := range configs {
+		client := "<http://example.com/clients/" + c.Identifier + ">"
+		endpoint := "<http://example.com/clients/" + c.Identifier + "/endpoint>"
+		fmt.Fprintf(data, "%s rdf:type oauth:Client .\n", client)
+		if c.Type != "" {
+			fmt.Fprintf(data, "%s rdf:type <%s> .\n", client, c.Type)
+		}
+		fmt.Fprintf(data, "%s oauth:clientID %s ; oauth:clientSecret %s ; oauth:redirectURL %s ; oauth:endpoint %s ; dc:identifier %s ; rdfs:label %s .\n",
+			client, literal(c.ClientID), literal(c.ClientSecret), literal(c.RedirectURL), endpoint, literal(c.Identifier), literal(c.Label))
+		fmt.Fprintf(data, "%s oauth:authurl %s ; oauth:tokenurl %s .\n", endpoint, literal(c.AuthURL), literal(c.TokenURL))
+		for _, scope := range c.Scopes {
+			fmt.Fprintf(data, "%s oauth:scope %s .\n", client, literal(scope))
+		}
+		for key, value := range c.Params {
+			param := "<http://example.com/clients/" + c.Identifier + "/params/" + key + ">"
+			fmt.Fprintf(data, "%s oauth:param %s . %s rdfs:label %s ; rdf:value %s .\n", client, param, param, literal(key), literal(value))
+		}
+	}
+	data.WriteString("} }")
+
+	repo, err := srv.Repo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Update(data.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := sparql.NewSparql(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, newProvider)
+}
+
+func TestTokenStoreConformance(t *testing.T) {
+	conformance.RunTokenStore(t, func(t *testing.T) oauthenticator.TokenStore {
+		srv := sparqltest.NewServer()
+		t.Cleanup(srv.Close)
+		repo, err := srv.Repo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		store, err := sparql.NewTokenStore(repo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+}
+
+func TestConfigByIRI(t *testing.T) {
+	p := newProvider(t, []oauthenticator.ConfigDefinition{{
+		Identifier:   "mail",
+		Label:        "Mail",
+		ClientID:     "id",
+		ClientSecret: "secret",
+		AuthURL:      "https://login.example.com/authorize",
+		TokenURL:     "https://login.example.com/token",
+		RedirectURL:  "http://localhost/callback",
+	}})
+	for _, id := range []string{"mail", "http://example.com/clients/mail"} {
+		c, err := p.Config(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Identifier() != "mail" {
+			t.Fatal(c.Identifier())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package sparql
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/knakk/rdf"
+	"github.com/knakk/sparql"
+)
+
+// DefaultNamespace is the vocabulary used for configs and tokens unless
+// another one is set with Namespace.
+const DefaultNamespace = "https://oauth.net/2#"
+
+// DefaultTokenGraph is the graph tokens are stored in unless another one is
+// set with TokenGraph.
+const DefaultTokenGraph = "tokens"
+
+// Option alters the configuration of the queries used by the provider
+type Option func(*Queries) error
+
+// Namespace sets the IRI of the vocabulary (oauth: prefix) used in queries
+func Namespace(iri string) Option {
+	return func(q *Queries) error {
+		ns, err := rdf.NewIRI(iri)
+		if err != nil {
+			return fmt.Errorf("invalid namespace: %w", err)
+		}
+		q.namespace = ns.Serialize(rdf.Turtle)
+		return nil
+	}
+}
+
+// TokenGraph sets the graph tokens and accounts are read from and written to
+func TokenGraph(iri string) Option {
+	return func(q *Queries) error {
+		graph, err := rdf.NewIRI(iri)
+		if err != nil {
+			return fmt.Errorf("invalid token graph: %w", err)
+		}
+		q.tokengraph = graph.Serialize(rdf.Turtle)
+		return nil
+	}
+}
+
+// ConfigGraphs restricts the graphs configs are looked up in. By default,
+// configs are looked up in any graph.
+func ConfigGraphs(iris ...string) Option {
+	return func(q *Queries) error {
+		if len(iris) == 0 {
+			q.configgraphs = ""
+			return nil
+		}
+		terms := make([]string, len(iris))
+		for i, iri := range iris {
+			graph, err := rdf.NewIRI(iri)
+			if err != nil {
+				return fmt.Errorf("invalid config graph: %w", err)
+			}
+			terms[i] = graph.Serialize(rdf.Turtle)
+		}
+		q.configgraphs = fmt.Sprintf("VALUES ?configgraph { %s }", strings.Join(terms, " "))
+		return nil
+	}
+}
+
+// Encrypt encrypts the tokens stored in the repository
+func Encrypt(sealer oauthenticator.Sealer) Option {
+	return func(q *Queries) error {
+		q.sealer = sealer
+		return nil
+	}
+}
+
+// QueryOverrides replaces queries of the bank with the ones read from r.
+// The format is the same as of sparql.LoadBank, each query is preceded by a
+// "# tag: <name>" comment. Queries not present in r are kept.
+func QueryOverrides(r io.Reader) Option {
+	return func(q *Queries) error {
+		for tag, query := range sparql.LoadBank(r) {
+			if _, ok := q.bank[tag]; !ok {
+				return fmt.Errorf("unknown query: %s", tag)
+			}
+			q.bank[tag] = query
+		}
+		return nil
+	}
+}
+
+// QueryFile replaces queries of the bank with the ones in the given file, see QueryOverrides
+func QueryFile(path string) Option {
+	return func(q *Queries) error {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return QueryOverrides(bytes.NewReader(data))(q)
+	}
+}
+
+// queryArgs are the values that can be used in the query templates. All of
+// them are serialized RDF terms or fragments built from RDF terms.
+type queryArgs struct {
+	Namespace    string
+	TokenGraph   string
+	ConfigGraphs string
+
+	Client     string
+	ClientType string
+	Identifier string
+	Account    string
+	Label      string
+	Token      string
+}
+
+func (q *Queries) prepare(tag string, args queryArgs) (string, error) {
+	args.Namespace = q.namespace
+	args.TokenGraph = q.tokengraph
+	args.ConfigGraphs = q.configgraphs
+	return q.bank.Prepare(tag, args)
+}
@@ -2,8 +2,10 @@ package sparql
 
 import (
 	"bytes"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/balazsgrill/oauthenticator"
 	"github.com/knakk/rdf"
@@ -15,12 +17,18 @@ const queries = `
 # tag: clients
 PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
 PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
-PREFIX oauth: <https://oauth.net/2#>
+PREFIX oauth: {{.Namespace}}
 PREFIX dc: <http://purl.org/dc/elements/1.1/>
-SELECT ?clientid ?clientsecret ?redirecturl ?client ?authurl ?tokenurl ?identifier ?label
+SELECT ?clientid ?clientsecret ?redirecturl ?client ?authurl ?tokenurl ?identifier ?label ?type ?scope
 WHERE {
-  GRAPH ?anygraph {
+  {{.ConfigGraphs}}
+  GRAPH ?configgraph {
 	?client rdf:type oauth:Client .
+	OPTIONAL {
+		?client rdf:type ?type .
+		FILTER (?type != oauth:Client)
+	}
+	OPTIONAL { ?client oauth:scope ?scope . }
 	?client oauth:clientID ?clientid .
 	?client oauth:clientSecret ?clientsecret .
 	?client oauth:redirectURL ?redirecturl .
@@ -35,12 +43,18 @@ WHERE {
 # tag: client
 PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
 PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
-PREFIX oauth: <https://oauth.net/2#>
+PREFIX oauth: {{.Namespace}}
 PREFIX dc: <http://purl.org/dc/elements/1.1/>
-SELECT ?clientid ?clientsecret ?redirecturl ?authurl ?tokenurl ?identifier ?label
+SELECT ?clientid ?clientsecret ?redirecturl ?authurl ?tokenurl ?identifier ?label ?type ?scope
 WHERE {
-  GRAPH ?anygraph {
+  {{.ConfigGraphs}}
+  GRAPH ?configgraph {
 	{{.Client}} rdf:type oauth:Client .
+	OPTIONAL {
+		{{.Client}} rdf:type ?type .
+		FILTER (?type != oauth:Client)
+	}
+	OPTIONAL { {{.Client}} oauth:scope ?scope . }
 	{{.Client}} oauth:clientID ?clientid .
 	{{.Client}} oauth:clientSecret ?clientsecret .
 	{{.Client}} oauth:redirectURL ?redirecturl .
@@ -52,18 +66,31 @@ WHERE {
   }
 }
 
+# tag: identified
+PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
+PREFIX oauth: {{.Namespace}}
+PREFIX dc: <http://purl.org/dc/elements/1.1/>
+SELECT ?client
+WHERE {
+  {{.ConfigGraphs}}
+  GRAPH ?configgraph {
+	?client rdf:type oauth:Client .
+	?client dc:identifier {{.Identifier}} .
+  }
+}
+
 # tag: token
-PREFIX oauth: <https://oauth.net/2#>
+PREFIX oauth: {{.Namespace}}
 SELECT ?token
 WHERE {
-	GRAPH {{.Graph}} {
+	GRAPH {{.TokenGraph}} {
 		{{.Client}} oauth:token ?token
 	}
 }
 
 # tag: updatetoken
-PREFIX oauth: <https://oauth.net/2#>
-WITH {{.Graph}}
+PREFIX oauth: {{.Namespace}}
+WITH {{.TokenGraph}}
 DELETE {
 	{{.Client}} oauth:token ?oldtoken
 }
@@ -74,13 +101,80 @@ WHERE {
 	OPTIONAL { {{.Client}} oauth:token ?oldtoken }
 }
 
+# tag: removetoken
+PREFIX oauth: {{.Namespace}}
+WITH {{.TokenGraph}}
+DELETE {
+	{{.Client}} oauth:token ?oldtoken
+}
+WHERE {
+	{{.Client}} oauth:token ?oldtoken
+}
+
+# tag: accounts
+PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+PREFIX oauth: {{.Namespace}}
+SELECT ?account
+WHERE {
+	GRAPH {{.TokenGraph}} {
+		{{.Client}} oauth:account ?accountnode .
+		?accountnode rdfs:label ?account .
+	}
+}
+
+# tag: addaccount
+PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+PREFIX oauth: {{.Namespace}}
+INSERT DATA {
+	GRAPH {{.TokenGraph}} {
+		{{.Client}} oauth:account {{.Account}} .
+		{{.Account}} rdfs:label {{.Label}} .
+	}
+}
+
+# tag: removeaccount
+PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+PREFIX oauth: {{.Namespace}}
+WITH {{.TokenGraph}}
+DELETE {
+	{{.Client}} oauth:account {{.Account}} .
+	{{.Account}} rdfs:label ?label .
+}
+WHERE {
+	{{.Client}} oauth:account {{.Account}} .
+	{{.Account}} rdfs:label ?label .
+}
+
+# tag: selectedaccount
+PREFIX oauth: {{.Namespace}}
+SELECT ?account
+WHERE {
+	GRAPH {{.TokenGraph}} {
+		{{.Client}} oauth:selectedAccount ?account
+	}
+}
+
+# tag: selectaccount
+PREFIX oauth: {{.Namespace}}
+WITH {{.TokenGraph}}
+DELETE {
+	{{.Client}} oauth:selectedAccount ?oldaccount
+}
+INSERT {
+	{{.Client}} oauth:selectedAccount {{.Label}}
+}
+WHERE {
+	OPTIONAL { {{.Client}} oauth:selectedAccount ?oldaccount }
+}
+
 # tag: options
 PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
 PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
-PREFIX oauth: <https://oauth.net/2#>
+PREFIX oauth: {{.Namespace}}
 SELECT ?option ?value
 WHERE {
-	GRAPH ?anygraph {
+	{{.ConfigGraphs}}
+	GRAPH ?configgraph {
 		{{.Client}} oauth:param ?param .
 		?param rdfs:label ?option .
 		?param rdf:value ?value .
@@ -90,33 +184,91 @@ WHERE {
 # tag: clientsOfType
 PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
 PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
-PREFIX oauth: <https://oauth.net/2#>
+PREFIX oauth: {{.Namespace}}
+PREFIX dc: <http://purl.org/dc/elements/1.1/>
+SELECT ?clientid ?clientsecret ?redirecturl ?client ?authurl ?tokenurl ?identifier ?label ?scope
+WHERE {
+  {{.ConfigGraphs}}
+  GRAPH ?configgraph {
+	?client rdf:type oauth:Client .
+	?client rdf:type {{.ClientType}} .
+	OPTIONAL { ?client oauth:scope ?scope . }
+	?client oauth:clientID ?clientid .
+	?client oauth:clientSecret ?clientsecret .
+	?client oauth:redirectURL ?redirecturl .
+	?client oauth:endpoint ?endpoint .
+	?client dc:identifier ?identifier .
+	?client rdfs:label ?label .
+	?endpoint oauth:authurl ?authurl .
+	?endpoint oauth:tokenurl ?tokenurl .
+  }
+}
+
+# tag: batch
+PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
+PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+PREFIX oauth: {{.Namespace}}
 PREFIX dc: <http://purl.org/dc/elements/1.1/>
-SELECT ?item ?token
+SELECT ?clientid ?clientsecret ?redirecturl ?client ?authurl ?tokenurl ?identifier ?label ?type ?scope ?option ?value ?account ?token ?selected
 WHERE {
-  GRAPH ?anygraph {
-	?item rdf:type <{{.ClientType}}> .
+  {{.ConfigGraphs}}
+  GRAPH ?configgraph {
+	?client rdf:type oauth:Client .
+	OPTIONAL {
+		?client rdf:type ?type .
+		FILTER (?type != oauth:Client)
+	}
+	?client oauth:clientID ?clientid .
+	?client oauth:clientSecret ?clientsecret .
+	?client oauth:redirectURL ?redirecturl .
+	?client oauth:endpoint ?endpoint .
+	?client dc:identifier ?identifier .
+	?client rdfs:label ?label .
+	?endpoint oauth:authurl ?authurl .
+	?endpoint oauth:tokenurl ?tokenurl .
   }
-  GRAPH ?tokengraph {
-	?item oauth:token ?token .
+  {
+  } UNION {
+	GRAPH ?configgraph {
+		?client oauth:scope ?scope .
+	}
+  } UNION {
+	GRAPH ?configgraph {
+		?client oauth:param ?param .
+		?param rdfs:label ?option .
+		?param rdf:value ?value .
+	}
+  } UNION {
+	GRAPH {{.TokenGraph}} {
+		?client oauth:token ?token .
+	}
+  } UNION {
+	GRAPH {{.TokenGraph}} {
+		?client oauth:account ?accountnode .
+		?accountnode rdfs:label ?account .
+		?accountnode oauth:token ?token .
+	}
+  } UNION {
+	GRAPH {{.TokenGraph}} {
+		?client oauth:selectedAccount ?selected .
+	}
   }
 }
 `
 
 type Queries struct {
-	bank sparql.Bank
+	bank         sparql.Bank
+	namespace    string
+	tokengraph   string
+	configgraphs string
+	sealer       oauthenticator.Sealer
 }
 
 type sparqlProvider struct {
-	repo    *sparql.Repo
+	repo    Repo
 	queries *Queries
 }
 
-type tokenInRepo struct {
-	provider *sparqlProvider
-	client   rdf.Term
-}
-
 type OAuthConfig struct {
 	provider     *sparqlProvider
 	client       rdf.Term
@@ -127,6 +279,8 @@ type OAuthConfig struct {
 	redirectURL  string
 	authurl      string
 	tokenurl     string
+	ctype        string
+	scopes       []string
 }
 
 func (c *OAuthConfig) Term() rdf.Term {
@@ -139,10 +293,12 @@ func (c *OAuthConfig) Config() *oauth2.Config {
 		ClientSecret: c.clientSecret,
 		Endpoint:     c.Endpoint(),
 		RedirectURL:  c.redirectURL,
-		Scopes:       []string{},
+		Scopes:       c.scopes,
 	}
 }
 
+// Identifier returns the dc:identifier of the client. Provider.Config
+// accepts it as well as the IRI of the client.
 func (c *OAuthConfig) Identifier() string {
 	return c.identifier
 }
@@ -162,27 +318,51 @@ func (c *OAuthConfig) Token() oauthenticator.TokenPersistence {
 	return c.provider.Token(c)
 }
 
+func (c *OAuthConfig) Accounts() oauthenticator.Accounts {
+	return c.provider.Accounts(c)
+}
+
 func (c *OAuthConfig) Options() []oauth2.AuthCodeOption {
 	return c.provider.Options(c)
 }
 
+// Type returns the rdf:type of the client besides oauth:Client
 func (c *OAuthConfig) Type() string {
-	// TODO
-	return ""
+	return c.ctype
 }
 
-func InitializeQueries() *Queries {
+func InitializeQueries(options ...Option) (*Queries, error) {
 	result := &Queries{}
 	data := bytes.NewBufferString(queries)
 	result.bank = sparql.LoadBank(data)
-	return result
+	err := Namespace(DefaultNamespace)(result)
+	if err != nil {
+		return nil, err
+	}
+	err = TokenGraph(DefaultTokenGraph)(result)
+	if err != nil {
+		return nil, err
+	}
+	for _, option := range options {
+		err = option(result)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
-func NewSparql(repo *sparql.Repo) oauthenticator.Provider {
+// NewSparql creates a provider over the given repository. The graphs and the
+// vocabulary used can be changed with options.
+func NewSparql(repo Repo, options ...Option) (oauthenticator.Provider, error) {
+	queries, err := InitializeQueries(options...)
+	if err != nil {
+		return nil, err
+	}
 	return &sparqlProvider{
 		repo:    repo,
-		queries: InitializeQueries(),
-	}
+		queries: queries,
+	}, nil
 }
 
 func (p *sparqlProvider) Options(c *OAuthConfig) []oauth2.AuthCodeOption {
@@ -193,9 +373,26 @@ func (p *sparqlProvider) Options(c *OAuthConfig) []oauth2.AuthCodeOption {
 	return params
 }
 
+// Config looks up a config by the IRI of the client, or by its dc:identifier
 func (p *sparqlProvider) Config(termid string) (oauthenticator.Config, error) {
-	term, _ := rdf.NewIRI(termid)
-	return p.queries.GetConfig(p, p.repo, term)
+	if term, err := rdf.NewIRI(termid); err == nil && strings.Contains(termid, ":") {
+		c, err := p.queries.GetConfig(p, p.repo, term)
+		if err == nil {
+			return c, nil
+		}
+		if !errors.Is(err, oauthenticator.ErrNotFound) {
+			return nil, err
+		}
+	}
+	term, err := p.queries.FindClient(p.repo, termid)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.queries.GetConfig(p, p.repo, term)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
 }
 
 func (p *sparqlProvider) Configs() ([]oauthenticator.Config, error) {
@@ -203,32 +400,27 @@ func (p *sparqlProvider) Configs() ([]oauthenticator.Config, error) {
 }
 
 func (p *sparqlProvider) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
-	return p.queries.GetClientsOfType(p.repo, ctype)
+	return p.queries.GetClientsOfType(p, p.repo, ctype)
 }
 
 func (p *sparqlProvider) Token(c *OAuthConfig) oauthenticator.TokenPersistence {
-	return &tokenInRepo{
+	return oauthenticator.SelectedToken(p.Accounts(c))
+}
+
+func (p *sparqlProvider) Accounts(c *OAuthConfig) oauthenticator.Accounts {
+	return &accountsInRepo{
 		provider: p,
 		client:   c.client,
 	}
 }
 
-func (tp *tokenInRepo) Token() (*oauth2.Token, error) {
-	return tp.provider.queries.ReadToken(tp.provider.repo, tp.client)
-}
-
-func (tp *tokenInRepo) SetToken(t *oauth2.Token) {
-	err := tp.provider.queries.WriteToken(tp.provider.repo, tp.client, t)
+func (q *Queries) GetParams(repo Repo, client rdf.Term) ([]oauth2.AuthCodeOption, error) {
+	clientarg, err := termArg(client)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
-}
-
-func (q *Queries) GetParams(repo *sparql.Repo, client rdf.Term) ([]oauth2.AuthCodeOption, error) {
-	query, err := q.bank.Prepare("options", struct {
-		Client string
-	}{
-		Client: client.Serialize(rdf.Turtle),
+	query, err := q.prepare("options", queryArgs{
+		Client: clientarg,
 	})
 	if err != nil {
 		return nil, err
@@ -246,32 +438,42 @@ func (q *Queries) GetParams(repo *sparql.Repo, client rdf.Term) ([]oauth2.AuthCo
 	var params []oauth2.AuthCodeOption
 	for i := 0; i < len(solutions); i++ {
 		solution := solutions[i]
-		option := solution["option"].String()
-		value := solution["value"].String()
+		option, err := binding(solution, "option")
+		if err != nil {
+			return nil, err
+		}
+		value, err := binding(solution, "value")
+		if err != nil {
+			return nil, err
+		}
 		params = append(params, oauth2.SetAuthURLParam(option, value))
 	}
 
 	return params, nil
 }
 
-func (q *Queries) WriteToken(repo *sparql.Repo, client rdf.Term, t *oauth2.Token) error {
-	tokendata, err := json.Marshal(t)
+// WriteToken stores the token of an account of the client
+func (q *Queries) WriteToken(repo Repo, client rdf.Term, account string, t *oauth2.Token) error {
+	term, err := accountTerm(client, account)
+	if err != nil {
+		return err
+	}
+	clientarg, err := termArg(term)
+	if err != nil {
+		return err
+	}
+	tokendata, err := oauthenticator.SealToken(q.sealer, t, client.String(), account)
 	if err != nil {
 		return err
 	}
-	tokenlit, err := rdf.NewLiteral(string(tokendata))
+	tokenarg, err := literalArg(string(tokendata))
 	if err != nil {
 		return err
 	}
 
-	query, err := q.bank.Prepare("updatetoken", struct {
-		Graph  string
-		Client string
-		Token  string
-	}{
-		Graph:  "<tokens>",
-		Client: client.Serialize(rdf.Turtle),
-		Token:  tokenlit.Serialize(rdf.Turtle),
+	query, err := q.prepare("updatetoken", queryArgs{
+		Client: clientarg,
+		Token:  tokenarg,
 	})
 	if err != nil {
 		return err
@@ -280,13 +482,18 @@ func (q *Queries) WriteToken(repo *sparql.Repo, client rdf.Term, t *oauth2.Token
 	return repo.Update(query)
 }
 
-func (q *Queries) ReadToken(repo *sparql.Repo, client rdf.Term) (*oauth2.Token, error) {
-	query, err := q.bank.Prepare("token", struct {
-		Graph  string
-		Client string
-	}{
-		Graph:  "<tokens>",
-		Client: client.Serialize(rdf.Turtle),
+// ReadToken reads the token of an account of the client, nil if there is none
+func (q *Queries) ReadToken(repo Repo, client rdf.Term, account string) (*oauth2.Token, error) {
+	term, err := accountTerm(client, account)
+	if err != nil {
+		return nil, err
+	}
+	clientarg, err := termArg(term)
+	if err != nil {
+		return nil, err
+	}
+	query, err := q.prepare("token", queryArgs{
+		Client: clientarg,
 	})
 	if err != nil {
 		return nil, err
@@ -301,50 +508,129 @@ func (q *Queries) ReadToken(repo *sparql.Repo, client rdf.Term) (*oauth2.Token,
 		return nil, nil
 	}
 
-	solution := solutions[0]
-	data := solution["token"].String()
-	t := &oauth2.Token{}
-	err = json.Unmarshal([]byte(data), t)
+	data, err := binding(solutions[0], "token")
 	if err != nil {
 		return nil, err
 	}
-	return t, nil
+	return oauthenticator.OpenToken(q.sealer, []byte(data), client.String(), account)
+}
+
+func configFromSolution(provider *sparqlProvider, client rdf.Term, solution map[string]rdf.Term) (*OAuthConfig, error) {
+	c := &OAuthConfig{
+		provider: provider,
+		client:   client,
+	}
+	fields := []struct {
+		variable string
+		value    *string
+	}{
+		{"clientid", &c.clientID},
+		{"clientsecret", &c.clientSecret},
+		{"redirecturl", &c.redirectURL},
+		{"authurl", &c.authurl},
+		{"tokenurl", &c.tokenurl},
+		{"identifier", &c.identifier},
+		{"label", &c.label},
+	}
+	for _, field := range fields {
+		value, err := binding(solution, field.variable)
+		if err != nil {
+			return nil, err
+		}
+		*field.value = value
+	}
+	c.addSolution(solution)
+	return c, nil
+}
+
+// addSolution records the type and scope bound in the solution. Solutions are
+// repeated for every scope and type of the client. Of several types the
+// smallest IRI is kept, so the type does not depend on the solution order.
+func (c *OAuthConfig) addSolution(solution map[string]rdf.Term) {
+	ctype := optionalBinding(solution, "type")
+	if ctype != "" && (c.ctype == "" || ctype < c.ctype) {
+		c.ctype = ctype
+	}
+	scope := optionalBinding(solution, "scope")
+	if scope == "" {
+		return
+	}
+	for _, s := range c.scopes {
+		if s == scope {
+			return
+		}
+	}
+	c.scopes = append(c.scopes, scope)
 }
 
-func (q *Queries) GetConfig(provider *sparqlProvider, repo *sparql.Repo, client rdf.Term) (*OAuthConfig, error) {
-	query, err := q.bank.Prepare("client", struct{ Client string }{
-		Client: client.Serialize(rdf.Turtle),
+// configsFromSolutions creates one config per client, a client with several
+// types or scopes is returned in several solutions. If ctype is given, it is
+// used as the type of all configs.
+func configsFromSolutions(provider *sparqlProvider, solutions []map[string]rdf.Term, ctype string) ([]oauthenticator.Config, error) {
+	var result []oauthenticator.Config
+	seen := make(map[string]*OAuthConfig)
+	for _, solution := range solutions {
+		client, ok := solution["client"]
+		if !ok || client == nil {
+			return nil, errors.New("variable not bound: client")
+		}
+		if client.Type() != rdf.TermIRI {
+			// blank nodes can not be referred to in later queries
+			log.Printf("Ignoring client %s, it is not an IRI", client.Serialize(rdf.NTriples))
+			continue
+		}
+		key := client.Serialize(rdf.NTriples)
+		if c, ok := seen[key]; ok {
+			c.addSolution(solution)
+			continue
+		}
+		c, err := configFromSolution(provider, client, solution)
+		if err != nil {
+			return nil, err
+		}
+		seen[key] = c
+		result = append(result, c)
+	}
+	if ctype != "" {
+		for _, c := range seen {
+			c.ctype = ctype
+		}
+	}
+	return result, nil
+}
+
+// FindClient returns the client with the dc:identifier
+func (q *Queries) FindClient(repo Repo, identifier string) (rdf.Term, error) {
+	identifierarg, err := literalArg(identifier)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid identifier %q: %v", oauthenticator.ErrNotFound, identifier, err)
+	}
+	query, err := q.prepare("identified", queryArgs{
+		Identifier: identifierarg,
 	})
 	if err != nil {
 		return nil, err
 	}
-
 	res, err := repo.Query(query)
 	if err != nil {
 		return nil, err
 	}
-
-	solutions := res.Solutions()
-
-	for _, solution := range solutions {
-		return &OAuthConfig{
-			provider:     provider,
-			client:       client,
-			clientID:     solution["clientid"].String(),
-			clientSecret: solution["clientsecret"].String(),
-			redirectURL:  solution["redirecturl"].String(),
-			authurl:      solution["authurl"].String(),
-			tokenurl:     solution["tokenurl"].String(),
-			identifier:   solution["identifier"].String(),
-			label:        solution["label"].String(),
-		}, nil
+	for _, solution := range res.Solutions() {
+		if client, ok := solution["client"]; ok && client != nil && client.Type() == rdf.TermIRI {
+			return client, nil
+		}
 	}
-
-	return nil, nil
+	return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
 }
 
-func (q *Queries) ReadConfigs(provider *sparqlProvider, repo *sparql.Repo) ([]oauthenticator.Config, error) {
-	query, err := q.bank.Prepare("clients")
+func (q *Queries) GetConfig(provider *sparqlProvider, repo Repo, client rdf.Term) (*OAuthConfig, error) {
+	clientarg, err := termArg(client)
+	if err != nil {
+		return nil, err
+	}
+	query, err := q.prepare("client", queryArgs{
+		Client: clientarg,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -355,49 +641,48 @@ func (q *Queries) ReadConfigs(provider *sparqlProvider, repo *sparql.Repo) ([]oa
 	}
 
 	solutions := res.Solutions()
-	result := make([]oauthenticator.Config, len(solutions))
-
-	for i := 0; i < len(solutions); i++ {
-		solution := solutions[i]
-		result[i] = &OAuthConfig{
-			provider:     provider,
-			client:       solution["client"],
-			clientID:     solution["clientid"].String(),
-			clientSecret: solution["clientsecret"].String(),
-			redirectURL:  solution["redirecturl"].String(),
-			authurl:      solution["authurl"].String(),
-			tokenurl:     solution["tokenurl"].String(),
-			identifier:   solution["identifier"].String(),
-			label:        solution["label"].String(),
+	if len(solutions) > 0 {
+		c, err := configFromSolution(provider, client, solutions[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, solution := range solutions[1:] {
+			c.addSolution(solution)
 		}
+		return c, nil
 	}
 
-	return result, nil
+	return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, client.String())
 }
 
-func (q *Queries) GetClientsOfType(repo *sparql.Repo, clientType string) ([]oauthenticator.Config, error) {
-	provider := NewSparql(repo)
-	query, err := q.bank.Prepare("clientsOfType", struct{ ClientType string }{ClientType: clientType})
+func (q *Queries) ReadConfigs(provider *sparqlProvider, repo Repo) ([]oauthenticator.Config, error) {
+	query, err := q.prepare("clients", queryArgs{})
 	if err != nil {
 		return nil, err
 	}
 
-	result, err := repo.Query(query)
+	res, err := repo.Query(query)
 	if err != nil {
 		return nil, err
 	}
 
-	solutions := result.Solutions()
+	return configsFromSolutions(provider, res.Solutions(), "")
+}
 
-	var res []oauthenticator.Config
-	for _, solution := range solutions {
-		c, err := provider.Config(solution["item"].String())
-		if err != nil {
-			log.Println(err)
-		} else {
-			res = append(res, c)
-		}
+func (q *Queries) GetClientsOfType(provider *sparqlProvider, repo Repo, clientType string) ([]oauthenticator.Config, error) {
+	typearg, err := iriArg(clientType)
+	if err != nil {
+		return nil, err
+	}
+	query, err := q.prepare("clientsOfType", queryArgs{ClientType: typearg})
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := repo.Query(query)
+	if err != nil {
+		return nil, err
 	}
 
-	return res, nil
+	return configsFromSolutions(provider, res.Solutions(), clientType)
 }
@@ -0,0 +1,177 @@
+package sparql
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/knakk/rdf"
+)
+
+// queryToken is a lexical token of a SPARQL query, detailed enough to tell
+// whether a substituted value stayed within its term.
+type queryToken struct {
+	kind string
+	text string
+}
+
+var queryLexer = regexp.MustCompile(`^(?:` +
+	`(?P<iri><[^<>"{}|^` + "`" + `\\\x00-\x20]*>)|` +
+	`(?P<literal>"(?:[^"\\\n\r]|\\.)*")|` +
+	`(?P<var>[?$][A-Za-z0-9_]+)|` +
+	`(?P<word>[A-Za-z0-9_:#\-]+)|` +
+	`(?P<punct>[{}().;,=!])|` +
+	`(?P<invalid>.))`)
+
+func lexQuery(query string) []queryToken {
+	var result []queryToken
+	names := queryLexer.SubexpNames()
+	for {
+		query = strings.TrimLeft(query, " \t\r\n")
+		if query == "" {
+			return result
+		}
+		match := queryLexer.FindStringSubmatch(query)
+		for i := 1; i < len(match); i++ {
+			if match[i] != "" {
+				result = append(result, queryToken{kind: names[i], text: match[i]})
+				query = query[len(match[0]):]
+				break
+			}
+		}
+	}
+}
+
+func unescapeLiteral(literal string) string {
+	literal = literal[1 : len(literal)-1]
+	replacer := strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\"`, `"`, `\\`, `\`)
+	return replacer.Replace(literal)
+}
+
+// checkSubstitution prepares a query once with a placeholder term and once
+// with the fuzzed value, and checks that the two differ only in the value of
+// the substituted terms.
+func checkSubstitution(t *testing.T, tag string, args func(value string) queryArgs, placeholder string, value string, expected func(token queryToken) bool) {
+	q, err := InitializeQueries(ConfigGraphs("urn:graph:a", "urn:graph:b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reference, err := q.prepare(tag, args(placeholder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fuzzed, err := q.prepare(tag, args(value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	referenceTokens := lexQuery(reference)
+	fuzzedTokens := lexQuery(fuzzed)
+	if len(referenceTokens) != len(fuzzedTokens) {
+		t.Fatalf("query structure changed:\n%s\n%s", reference, fuzzed)
+	}
+	for i, token := range referenceTokens {
+		if token.text == placeholder {
+			if !expected(fuzzedTokens[i]) {
+				t.Fatalf("substituted term changed: %v", fuzzedTokens[i])
+			}
+		} else if token != fuzzedTokens[i] {
+			t.Fatalf("query structure changed at %v:\n%s\n%s", token, reference, fuzzed)
+		}
+	}
+}
+
+func iriSeeds(f *testing.F) {
+	f.Add("http://example.com/client")
+	f.Add("http://example.com/client> } ; DROP ALL ; <x")
+	f.Add("x> ?p ?o . } #")
+	f.Add("{{.Client}}")
+	f.Add(`a"b`)
+	f.Add("urn:a\nb")
+}
+
+func FuzzClientIRI(f *testing.F) {
+	iriSeeds(f)
+	f.Fuzz(func(t *testing.T, iri string) {
+		arg, err := iriArg(iri)
+		if err != nil {
+			return
+		}
+		placeholder := "<urn:fuzz:placeholder>"
+		for _, tag := range []string{"client", "token", "updatetoken", "options", "accounts", "removetoken"} {
+			checkSubstitution(t, tag, func(value string) queryArgs {
+				return queryArgs{Client: value, Token: `"token"`}
+			}, placeholder, arg, func(token queryToken) bool {
+				return token.kind == "iri" && token.text == "<"+iri+">"
+			})
+		}
+	})
+}
+
+func FuzzClientType(f *testing.F) {
+	iriSeeds(f)
+	f.Fuzz(func(t *testing.T, iri string) {
+		arg, err := iriArg(iri)
+		if err != nil {
+			return
+		}
+		checkSubstitution(t, "clientsOfType", func(value string) queryArgs {
+			return queryArgs{ClientType: value}
+		}, "<urn:fuzz:placeholder>", arg, func(token queryToken) bool {
+			return token.kind == "iri" && token.text == "<"+iri+">"
+		})
+	})
+}
+
+func FuzzLiteral(f *testing.F) {
+	f.Add("alice")
+	f.Add(`{"access_token":"x\"y"}`)
+	f.Add(`" } ; DROP ALL ; INSERT DATA { <a> <b> "`)
+	f.Add("line\nbreak\\")
+	f.Add("\xff")
+	f.Fuzz(func(t *testing.T, value string) {
+		arg, err := literalArg(value)
+		if err != nil {
+			if utf8.ValidString(value) {
+				t.Fatal(err)
+			}
+			return
+		}
+		placeholder := `"placeholder"`
+		expected := func(token queryToken) bool {
+			return token.kind == "literal" && unescapeLiteral(token.text) == value
+		}
+		checkSubstitution(t, "updatetoken", func(v string) queryArgs {
+			return queryArgs{Client: "<urn:client>", Token: v}
+		}, placeholder, arg, expected)
+		checkSubstitution(t, "addaccount", func(v string) queryArgs {
+			return queryArgs{Client: "<urn:client>", Account: "<urn:account>", Label: v}
+		}, placeholder, arg, expected)
+		checkSubstitution(t, "selectaccount", func(v string) queryArgs {
+			return queryArgs{Client: "<urn:client>", Label: v}
+		}, placeholder, arg, expected)
+	})
+}
+
+func TestInvalidIdentifier(t *testing.T) {
+	p, _ := newTestProvider(t)
+	// identifiers that are no IRIs are looked up as dc:identifier literals
+	_, err := p.Config("http://example.com/client> ?p ?o } #")
+	if !errors.Is(err, oauthenticator.ErrNotFound) {
+		t.Fatal(err)
+	}
+	_, err = p.ConfigsOfType("urn:type> . ?client ?p ?o")
+	if err == nil {
+		t.Fatal("invalid type accepted")
+	}
+}
+
+func TestMissingBinding(t *testing.T) {
+	client, _ := rdf.NewIRI("urn:client")
+	_, err := configFromSolution(nil, client, map[string]rdf.Term{})
+	if err == nil {
+		t.Fatal("missing binding accepted")
+	}
+}
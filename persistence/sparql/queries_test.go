@@ -0,0 +1,353 @@
+package sparql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/sparql/sparqltest"
+	"github.com/knakk/rdf"
+	"golang.org/x/oauth2"
+)
+
+const testdata = `
+PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
+PREFIX rdfs: <http://www.w3.org/2000/01/rdf-schema#>
+PREFIX oauth: <https://oauth.net/2#>
+PREFIX dc: <http://purl.org/dc/elements/1.1/>
+PREFIX ex: <http://example.com/>
+INSERT DATA {
+	GRAPH ex:configs {
+		ex:a rdf:type oauth:Client, ex:Mail ;
+			oauth:clientID "id-a" ;
+			oauth:clientSecret "secret-a" ;
+			oauth:redirectURL "http://localhost:8083/verify" ;
+			oauth:endpoint ex:endpoint ;
+			dc:identifier "http://example.com/a" ;
+			rdfs:label "Client A" ;
+			oauth:scope "openid", "profile" ;
+			oauth:param ex:resource .
+		ex:resource rdfs:label "resource" ;
+			rdf:value "https://data.example.com/" .
+		ex:b rdf:type oauth:Client ;
+			oauth:clientID "id-b" ;
+			oauth:clientSecret "secret-b" ;
+			oauth:redirectURL "http://localhost:8083/verify" ;
+			oauth:endpoint ex:endpoint ;
+			dc:identifier "http://example.com/b" ;
+			rdfs:label "Client B" .
+		ex:endpoint oauth:authurl "https://login.example.com/authorize" ;
+			oauth:tokenurl "https://login.example.com/token" .
+	}
+}
+`
+
+func newTestProvider(t *testing.T, options ...Option) (*sparqlProvider, *sparqltest.Server) {
+	srv := sparqltest.NewServer()
+	t.Cleanup(srv.Close)
+	repo, err := srv.Repo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Update(testdata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewSparql(repo, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.(*sparqlProvider), srv
+}
+
+func iri(t *testing.T, value string) rdf.Term {
+	term, err := rdf.NewIRI(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return term
+}
+
+func TestReadConfigs(t *testing.T) {
+	p, _ := newTestProvider(t)
+	configs, err := p.queries.ReadConfigs(p, p.repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(configs))
+	}
+	types := make(map[string]string)
+	for _, c := range configs {
+		types[c.Label()] = c.Type()
+	}
+	if types["Client A"] != "http://example.com/Mail" || types["Client B"] != "" {
+		t.Fatal(types)
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	p, _ := newTestProvider(t)
+	c, err := p.queries.GetConfig(p, p.repo, iri(t, "http://example.com/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := c.Config()
+	if config.ClientID != "id-a" || config.ClientSecret != "secret-a" || config.RedirectURL != "http://localhost:8083/verify" {
+		t.Fatal(config)
+	}
+	if config.Endpoint.AuthURL != "https://login.example.com/authorize" || config.Endpoint.TokenURL != "https://login.example.com/token" {
+		t.Fatal(config.Endpoint)
+	}
+	if len(config.Scopes) != 2 {
+		t.Fatal(config.Scopes)
+	}
+	if c.Identifier() != "http://example.com/a" || c.Label() != "Client A" {
+		t.Fatal(c.Identifier(), c.Label())
+	}
+
+	_, err = p.queries.GetConfig(p, p.repo, iri(t, "http://example.com/unknown"))
+	if err == nil {
+		t.Fatal("unknown client found")
+	}
+}
+
+func TestGetParams(t *testing.T) {
+	p, _ := newTestProvider(t)
+	params, err := p.queries.GetParams(p.repo, iri(t, "http://example.com/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 1 {
+		t.Fatal(params)
+	}
+	authurl := (&oauth2.Config{Endpoint: oauth2.Endpoint{AuthURL: "https://login.example.com/authorize"}}).AuthCodeURL("state", params...)
+	if authurl != "https://login.example.com/authorize?client_id=&resource=https%3A%2F%2Fdata.example.com%2F&response_type=code&state=state" {
+		t.Fatal(authurl)
+	}
+
+	params, err = p.queries.GetParams(p.repo, iri(t, "http://example.com/b"))
+	if err != nil || len(params) != 0 {
+		t.Fatal(params, err)
+	}
+}
+
+func TestTokenRoundTrip(t *testing.T) {
+	p, srv := newTestProvider(t)
+	client := iri(t, "http://example.com/a")
+
+	token, err := p.queries.ReadToken(p.repo, client, oauthenticator.DefaultAccount)
+	if err != nil || token != nil {
+		t.Fatal(token, err)
+	}
+
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, accesstoken := range []string{"first", `second "quoted"`} {
+		err = p.queries.WriteToken(p.repo, client, oauthenticator.DefaultAccount, &oauth2.Token{AccessToken: accesstoken, RefreshToken: "refresh", Expiry: expiry})
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err = p.queries.ReadToken(p.repo, client, oauthenticator.DefaultAccount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != accesstoken || token.RefreshToken != "refresh" || !token.Expiry.Equal(expiry) {
+			t.Fatal(token)
+		}
+	}
+
+	// the token is replaced, not added
+	_, solutions, err := srv.Store.Query(`SELECT ?token WHERE { GRAPH <tokens> { ?client <https://oauth.net/2#token> ?token } }`)
+	if err != nil || len(solutions) != 1 {
+		t.Fatal(solutions, err)
+	}
+}
+
+func TestGetClientsOfType(t *testing.T) {
+	p, _ := newTestProvider(t)
+	configs, err := p.queries.GetClientsOfType(p, p.repo, "http://example.com/Mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Label() != "Client A" || configs[0].Type() != "http://example.com/Mail" {
+		t.Fatal(configs)
+	}
+	// configs are complete, not only references
+	if configs[0].Config().ClientID != "id-a" {
+		t.Fatal(configs[0].Config())
+	}
+
+	configs, err = p.queries.GetClientsOfType(p, p.repo, "http://example.com/Unknown")
+	if err != nil || len(configs) != 0 {
+		t.Fatal(configs, err)
+	}
+}
+
+func TestAccounts(t *testing.T) {
+	p, _ := newTestProvider(t)
+	c, err := p.Config("http://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts := c.Accounts()
+	c.Token().SetToken(&oauth2.Token{AccessToken: "default"})
+	accounts.Token("alice").SetToken(&oauth2.Token{AccessToken: "alice"})
+
+	names, err := accounts.List()
+	if err != nil || len(names) != 2 {
+		t.Fatal(names, err)
+	}
+	selected, err := accounts.Selected()
+	if err != nil || selected != oauthenticator.DefaultAccount {
+		t.Fatal(selected, err)
+	}
+	err = accounts.Select("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Token().Token()
+	if err != nil || token.AccessToken != "alice" {
+		t.Fatal(token, err)
+	}
+	err = accounts.Remove("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = c.Token().Token()
+	if err != nil || token.AccessToken != "default" {
+		t.Fatal(token, err)
+	}
+}
+
+func TestGraphOptions(t *testing.T) {
+	p, srv := newTestProvider(t, TokenGraph("http://example.com/tokens"), ConfigGraphs("http://example.com/other"))
+	configs, err := p.Configs()
+	if err != nil || len(configs) != 0 {
+		t.Fatal(configs, err)
+	}
+
+	p, err = func() (*sparqlProvider, error) {
+		repo, err := srv.Repo()
+		if err != nil {
+			return nil, err
+		}
+		provider, err := NewSparql(repo, TokenGraph("http://example.com/tokens"), ConfigGraphs("http://example.com/configs"))
+		if err != nil {
+			return nil, err
+		}
+		return provider.(*sparqlProvider), nil
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs, err = p.Configs()
+	if err != nil || len(configs) != 2 {
+		t.Fatal(configs, err)
+	}
+	err = p.queries.WriteToken(p.repo, iri(t, "http://example.com/a"), oauthenticator.DefaultAccount, &oauth2.Token{AccessToken: "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, solutions, err := srv.Store.Query(`SELECT ?token WHERE { GRAPH <http://example.com/tokens> { ?client <https://oauth.net/2#token> ?token } }`)
+	if err != nil || len(solutions) != 1 {
+		t.Fatal(solutions, err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	p, _ := newTestProvider(t)
+	c, err := p.Config("http://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token().SetToken(&oauth2.Token{AccessToken: "default"})
+	c.Accounts().Token("alice").SetToken(&oauth2.Token{AccessToken: "alice"})
+	err = c.Accounts().Select("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err := p.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("expected 2 configs, got %d", len(states))
+	}
+	byLabel := make(map[string]oauthenticator.ConfigState)
+	for _, state := range states {
+		byLabel[state.Config.Label()] = state
+	}
+	a := byLabel["Client A"]
+	if a.Config.Type() != "http://example.com/Mail" || a.OAuth2.ClientID != "id-a" || len(a.OAuth2.Scopes) != 2 || len(a.Options) != 1 {
+		t.Fatal(a)
+	}
+	if len(a.Tokens) != 2 || a.Tokens[oauthenticator.DefaultAccount].AccessToken != "default" || a.Tokens["alice"].AccessToken != "alice" {
+		t.Fatal(a.Tokens)
+	}
+	if a.Selected != "alice" {
+		t.Fatal(a.Selected)
+	}
+	b := byLabel["Client B"]
+	if b.OAuth2 == nil || len(b.OAuth2.Scopes) != 0 || len(b.Options) != 0 || len(b.Tokens) != 0 || b.Selected != "" {
+		t.Fatal(b)
+	}
+}
+
+func TestMultipleTypes(t *testing.T) {
+	p, _ := newTestProvider(t)
+	err := p.repo.Update(`
+PREFIX rdf: <http://www.w3.org/1999/02/22-rdf-syntax-ns#>
+PREFIX ex: <http://example.com/>
+INSERT DATA {
+	GRAPH ex:configs {
+		ex:b rdf:type ex:Zeta, ex:Alpha, ex:Mu .
+	}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const expected = "http://example.com/Alpha"
+
+	c, err := p.queries.GetConfig(p, p.repo, iri(t, "http://example.com/b"))
+	if err != nil || c.Type() != expected {
+		t.Fatal(c, err)
+	}
+	configs, err := p.queries.ReadConfigs(p, p.repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range configs {
+		if c.Label() == "Client B" && c.Type() != expected {
+			t.Fatal(c.Type())
+		}
+	}
+	states, err := p.Batch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range states {
+		if state.Config.Label() == "Client B" && state.Config.Type() != expected {
+			t.Fatal(state.Config.Type())
+		}
+	}
+	configs, err = p.queries.GetClientsOfType(p, p.repo, "http://example.com/Zeta")
+	if err != nil || len(configs) != 1 || configs[0].Type() != "http://example.com/Zeta" {
+		t.Fatal(configs, err)
+	}
+}
+
+func TestClientIRI(t *testing.T) {
+	for identifier, expected := range map[string]string{
+		"http://example.com/a": "http://example.com/a",
+		"1:2":                  "1:2",
+		"mail":                 "urn:oauthenticator:config:mail",
+		"my config/a":          "urn:oauthenticator:config:my%20config%2Fa",
+		"a b:c":                "urn:oauthenticator:config:a%20b:c",
+	} {
+		client, err := ClientIRI(identifier)
+		if err != nil || client.String() != expected {
+			t.Fatal(identifier, client, err)
+		}
+	}
+}
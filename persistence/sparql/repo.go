@@ -0,0 +1,113 @@
+package sparql
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/knakk/sparql"
+)
+
+// Repo is a SPARQL repository, implemented by *sparql.Repo and by the
+// repositories of NewRepo
+type Repo interface {
+	Query(query interface{}) (*sparql.Results, error)
+	Update(update string) error
+}
+
+// httpRepo sends queries and updates over its own HTTP client. Repositories
+// of the sparql package share http.DefaultClient, and their options modify it
+// for the whole process.
+type httpRepo struct {
+	endpoint string
+	client   *http.Client
+}
+
+// NewRepo connects to a SPARQL repository sending requests with the client,
+// http.DefaultClient if nil
+func NewRepo(endpoint string, client *http.Client) Repo {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &httpRepo{
+		endpoint: endpoint,
+		client:   client,
+	}
+}
+
+// Query sends a query given as a string, and parses the JSON results
+func (r *httpRepo) Query(query interface{}) (*sparql.Results, error) {
+	q, ok := query.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported query: %T", query)
+	}
+	resp, err := r.post("query", q, "application/sparql-results+json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, failed("query", resp)
+	}
+	return sparql.ParseJSON(resp.Body)
+}
+
+func (r *httpRepo) Update(update string) error {
+	resp, err := r.post("update", update, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return failed("update", resp)
+	}
+	return nil
+}
+
+// post sends the query or update form of the SPARQL protocol
+func (r *httpRepo) post(field string, value string, accept string) (*http.Response, error) {
+	form := url.Values{}
+	form.Set(field, value)
+	req, err := http.NewRequest(http.MethodPost, r.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return r.client.Do(req)
+}
+
+func failed(operation string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("SPARQL %s failed: %s %s", operation, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// BasicAuth returns a transport adding basic authentication to the requests
+// sent with base, http.DefaultTransport if nil
+func BasicAuth(username string, password string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &basicAuthTransport{
+		username: username,
+		password: password,
+		base:     base,
+	}
+}
+
+type basicAuthTransport struct {
+	username string
+	password string
+	base     http.RoundTripper
+}
+
+func (t *basicAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests must not be modified by transports
+	req = req.Clone(req.Context())
+	req.SetBasicAuth(t.username, t.password)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,54 @@
+package sparql
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator/persistence/sparql/sparqltest"
+)
+
+func TestNewRepo(t *testing.T) {
+	srv := sparqltest.NewServer()
+	defer srv.Close()
+	protected := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	}))
+	defer protected.Close()
+
+	repo := NewRepo(protected.URL, &http.Client{
+		Timeout:   time.Second,
+		Transport: BasicAuth("user", "secret", nil),
+	})
+	err := repo.Update(`INSERT DATA { GRAPH <urn:g> { <urn:s> <urn:p> "o" } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := repo.Query("SELECT ?o WHERE { GRAPH ?g { <urn:s> <urn:p> ?o } }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	solutions := res.Solutions()
+	if len(solutions) != 1 || solutions[0]["o"].String() != "o" {
+		t.Fatal(solutions)
+	}
+	if http.DefaultClient.Transport != nil || http.DefaultClient.Timeout != 0 {
+		t.Fatal("default client modified")
+	}
+
+	repo = NewRepo(protected.URL, nil)
+	_, err = repo.Query("SELECT ?s WHERE { ?s ?p ?o }")
+	if err == nil {
+		t.Fatal("request sent with credentials")
+	}
+	err = repo.Update(`INSERT DATA { GRAPH <urn:g> { <urn:s> <urn:p> "o" } }`)
+	if err == nil {
+		t.Fatal("update sent with credentials")
+	}
+}
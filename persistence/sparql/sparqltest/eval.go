@@ -0,0 +1,429 @@
+package sparqltest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/knakk/rdf"
+)
+
+// solution maps variable names to bound terms
+type solution map[string]rdf.Term
+
+func (s solution) extend(name string, t rdf.Term) (solution, bool) {
+	if current, ok := s[name]; ok {
+		return s, termKey(current) == termKey(t)
+	}
+	result := make(solution, len(s)+1)
+	for k, v := range s {
+		result[k] = v
+	}
+	result[name] = t
+	return result, true
+}
+
+type evalContext struct {
+	store *Store
+	// graph is the active graph, nil for the default graph
+	graph rdf.Term
+}
+
+func (n node) resolve(s solution) rdf.Term {
+	if n.isVar() {
+		return s[n.variable]
+	}
+	return n.term
+}
+
+func (n node) bind(s solution, t rdf.Term) (solution, bool) {
+	if n.isVar() {
+		return s.extend(n.variable, t)
+	}
+	return s, true
+}
+
+func (b *triplesBlock) eval(ctx *evalContext, input []solution) ([]solution, error) {
+	current := input
+	for _, tp := range b.triples {
+		var next []solution
+		for _, s := range current {
+			for _, t := range ctx.store.match(ctx.graph, tp.subj.resolve(s), tp.pred.resolve(s), tp.obj.resolve(s)) {
+				extended, ok := tp.subj.bind(s, t.Subj)
+				if ok {
+					extended, ok = tp.pred.bind(extended, t.Pred)
+				}
+				if ok {
+					extended, ok = tp.obj.bind(extended, t.Obj)
+				}
+				if ok {
+					next = append(next, extended)
+				}
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
+
+func (g *graphPattern) eval(ctx *evalContext, input []solution) ([]solution, error) {
+	var result []solution
+	for _, s := range input {
+		var graphs []rdf.Term
+		if name := g.graph.resolve(s); name != nil {
+			graphs = []rdf.Term{name}
+		} else {
+			graphs = ctx.store.namedGraphs()
+		}
+		for _, name := range graphs {
+			bound, ok := g.graph.bind(s, name)
+			if !ok {
+				continue
+			}
+			inner, err := g.inner.evalGroup(&evalContext{store: ctx.store, graph: name}, []solution{bound})
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, inner...)
+		}
+	}
+	return result, nil
+}
+
+func (o *optionalPattern) eval(ctx *evalContext, input []solution) ([]solution, error) {
+	var result []solution
+	for _, s := range input {
+		inner, err := o.inner.evalGroup(ctx, []solution{s})
+		if err != nil {
+			return nil, err
+		}
+		if len(inner) == 0 {
+			result = append(result, s)
+		} else {
+			result = append(result, inner...)
+		}
+	}
+	return result, nil
+}
+
+func (u *unionPattern) eval(ctx *evalContext, input []solution) ([]solution, error) {
+	var result []solution
+	for _, branch := range u.branches {
+		inner, err := branch.evalGroup(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, inner...)
+	}
+	return result, nil
+}
+
+func (v *valuesPattern) eval(ctx *evalContext, input []solution) ([]solution, error) {
+	var result []solution
+	for _, s := range input {
+		for _, row := range v.rows {
+			extended, ok := s, true
+			for i, name := range v.vars {
+				if row[i] == nil {
+					continue
+				}
+				extended, ok = extended.extend(name, row[i])
+				if !ok {
+					break
+				}
+			}
+			if ok {
+				result = append(result, extended)
+			}
+		}
+	}
+	return result, nil
+}
+
+func (b *bindPattern) eval(ctx *evalContext, input []solution) ([]solution, error) {
+	var result []solution
+	for _, s := range input {
+		if _, ok := s[b.variable]; ok {
+			return nil, fmt.Errorf("BIND to already bound variable %s", b.variable)
+		}
+		v, err := b.expr.evaluate(s)
+		if err != nil {
+			// errors leave the variable unbound
+			result = append(result, s)
+			continue
+		}
+		extended, _ := s.extend(b.variable, v)
+		result = append(result, extended)
+	}
+	return result, nil
+}
+
+// evalGroup evaluates the elements of a group in order, each one joined with
+// the solutions of the previous ones. Filters apply to the whole group.
+func (g *group) evalGroup(ctx *evalContext, input []solution) ([]solution, error) {
+	current := input
+	for _, element := range g.elements {
+		var err error
+		current, err = element.eval(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(g.filters) == 0 {
+		return current, nil
+	}
+	var result []solution
+	for _, s := range current {
+		keep := true
+		for _, f := range g.filters {
+			v, err := f.evaluate(s)
+			if err == nil {
+				keep, err = effectiveBooleanValue(v)
+			}
+			if err != nil || !keep {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// patternVariables lists the variables of a group in order of appearance
+func (g *group) patternVariables(seen map[string]bool, result []string) []string {
+	add := func(nodes ...node) {
+		for _, n := range nodes {
+			if n.isVar() && !strings.HasPrefix(n.variable, "_:") && !seen[n.variable] {
+				seen[n.variable] = true
+				result = append(result, n.variable)
+			}
+		}
+	}
+	for _, element := range g.elements {
+		switch e := element.(type) {
+		case *triplesBlock:
+			for _, t := range e.triples {
+				add(t.subj, t.pred, t.obj)
+			}
+		case *graphPattern:
+			add(e.graph)
+			result = e.inner.patternVariables(seen, result)
+		case *optionalPattern:
+			result = e.inner.patternVariables(seen, result)
+		case *unionPattern:
+			for _, b := range e.branches {
+				result = b.patternVariables(seen, result)
+			}
+		case *valuesPattern:
+			for _, v := range e.vars {
+				add(node{variable: v})
+			}
+		case *bindPattern:
+			add(node{variable: e.variable})
+		}
+	}
+	return result
+}
+
+func (q *selectQuery) eval(store *Store) ([]string, []solution, error) {
+	solutions, err := q.where.evalGroup(&evalContext{store: store}, []solution{{}})
+	if err != nil {
+		return nil, nil, err
+	}
+	vars := q.vars
+	if vars == nil {
+		vars = q.where.patternVariables(make(map[string]bool), nil)
+	}
+	if len(q.order) > 0 {
+		sort.SliceStable(solutions, func(i, j int) bool {
+			for _, c := range q.order {
+				a, aerr := c.expr.evaluate(solutions[i])
+				b, berr := c.expr.evaluate(solutions[j])
+				var cmp int
+				switch {
+				case aerr != nil && berr != nil:
+					cmp = 0
+				case aerr != nil:
+					cmp = -1
+				case berr != nil:
+					cmp = 1
+				default:
+					cmp = compare(a, b)
+				}
+				if c.descending {
+					cmp = -cmp
+				}
+				if cmp != 0 {
+					return cmp < 0
+				}
+			}
+			return false
+		})
+	}
+	var result []solution
+	seen := make(map[string]bool)
+	for _, s := range solutions {
+		projected := make(solution, len(vars))
+		var key strings.Builder
+		for _, v := range vars {
+			if t, ok := s[v]; ok {
+				projected[v] = t
+				key.WriteString(termKey(t))
+			}
+			key.WriteString("\x00")
+		}
+		if q.distinct {
+			if seen[key.String()] {
+				continue
+			}
+			seen[key.String()] = true
+		}
+		result = append(result, projected)
+	}
+	if offset := q.offset; offset > 0 {
+		if offset > len(result) {
+			offset = len(result)
+		}
+		result = result[offset:]
+	}
+	if q.limit >= 0 && q.limit < len(result) {
+		result = result[:q.limit]
+	}
+	return vars, result, nil
+}
+
+// instantiate creates the quads of a template for a solution. Templates with
+// unbound variables are skipped, blank nodes are created per solution.
+func instantiate(templates []quadPattern, with rdf.Term, s solution, blanks map[string]rdf.Term, newBlank func() rdf.Term) []rdf.Quad {
+	var result []rdf.Quad
+	term := func(n node) rdf.Term {
+		if strings.HasPrefix(n.variable, "_:") {
+			b, ok := blanks[n.variable]
+			if !ok {
+				b = newBlank()
+				blanks[n.variable] = b
+			}
+			return b
+		}
+		return n.resolve(s)
+	}
+	for _, q := range templates {
+		subj, pred, obj := term(q.subj), term(q.pred), term(q.obj)
+		if subj == nil || pred == nil || obj == nil {
+			continue
+		}
+		ts, ok1 := subj.(rdf.Subject)
+		tp, ok2 := pred.(rdf.Predicate)
+		to, ok3 := obj.(rdf.Object)
+		if !ok1 || !ok2 || !ok3 {
+			continue
+		}
+		quad := rdf.Quad{Triple: rdf.Triple{Subj: ts, Pred: tp, Obj: to}}
+		g := with
+		if q.graph != nil {
+			g = term(*q.graph)
+			if g == nil {
+				continue
+			}
+		}
+		if g != nil {
+			ctx, ok := g.(rdf.Context)
+			if !ok {
+				continue
+			}
+			quad.Ctx = ctx
+		}
+		result = append(result, quad)
+	}
+	return result
+}
+
+func quadGraph(q rdf.Quad) rdf.Term {
+	if q.Ctx == nil {
+		return nil
+	}
+	return q.Ctx
+}
+
+func (s *Store) apply(op *updateOperation) error {
+	if op.clear {
+		s.graphs = make(map[string]*graph)
+		return nil
+	}
+	solutions := []solution{{}}
+	if op.where != nil {
+		var err error
+		solutions, err = op.where.evalGroup(&evalContext{store: s, graph: op.with}, solutions)
+		if err != nil {
+			return err
+		}
+	}
+	var deletes, inserts []rdf.Quad
+	for _, sol := range solutions {
+		blanks := make(map[string]rdf.Term)
+		deletes = append(deletes, instantiate(op.delete, op.with, sol, blanks, s.newBlank)...)
+		inserts = append(inserts, instantiate(op.insert, op.with, sol, blanks, s.newBlank)...)
+	}
+	for _, q := range deletes {
+		s.remove(quadGraph(q), q.Triple)
+	}
+	for _, q := range inserts {
+		s.add(quadGraph(q), q.Triple)
+	}
+	return nil
+}
+
+func (s *Store) newBlank() rdf.Term {
+	s.blanks++
+	b, _ := rdf.NewBlank(fmt.Sprintf("b%d", s.blanks))
+	return b
+}
+
+// Query evaluates a SELECT query, returning the projected variables and the
+// solutions
+func (s *Store) Query(query string) ([]string, []map[string]rdf.Term, error) {
+	p, err := newParser(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	q, err := p.parseQuery()
+	if err != nil {
+		return nil, nil, err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	vars, solutions, err := q.eval(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	result := make([]map[string]rdf.Term, len(solutions))
+	for i, sol := range solutions {
+		result[i] = sol
+	}
+	return vars, result, nil
+}
+
+// Update executes a SPARQL update request. The operations of the request are
+// applied in order, no other request is served in between.
+func (s *Store) Update(update string) error {
+	p, err := newParser(update)
+	if err != nil {
+		return err
+	}
+	ops, err := p.parseUpdate()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, op := range ops {
+		err = s.apply(op)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,410 @@
+package sparqltest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/knakk/rdf"
+)
+
+var errUnbound = errors.New("unbound variable")
+
+// expression is a FILTER, BIND or ORDER BY expression
+type expression interface {
+	evaluate(s solution) (rdf.Term, error)
+}
+
+type variableExpr struct {
+	name string
+}
+
+type termExpr struct {
+	term rdf.Term
+}
+
+type notExpr struct {
+	operand expression
+}
+
+type binaryExpr struct {
+	operator    string
+	left, right expression
+}
+
+type callExpr struct {
+	function string
+	args     []expression
+}
+
+func (e *variableExpr) evaluate(s solution) (rdf.Term, error) {
+	t, ok := s[e.name]
+	if !ok {
+		return nil, errUnbound
+	}
+	return t, nil
+}
+
+func (e *termExpr) evaluate(s solution) (rdf.Term, error) {
+	return e.term, nil
+}
+
+func boolTerm(b bool) rdf.Term {
+	t, _ := rdf.NewLiteral(b)
+	return t
+}
+
+// effectiveBooleanValue implements the EBV rules of SPARQL
+func effectiveBooleanValue(t rdf.Term) (bool, error) {
+	l, ok := t.(rdf.Literal)
+	if !ok {
+		return false, fmt.Errorf("no boolean value for %s", t.Serialize(rdf.NTriples))
+	}
+	switch l.DataType.String() {
+	case xsdNS + "boolean":
+		return l.String() == "true" || l.String() == "1", nil
+	case xsdNS + "integer", xsdNS + "decimal", xsdNS + "double", xsdNS + "int":
+		f, err := strconv.ParseFloat(l.String(), 64)
+		return err == nil && f != 0, nil
+	default:
+		return l.String() != "", nil
+	}
+}
+
+func (e *notExpr) evaluate(s solution) (rdf.Term, error) {
+	v, err := e.operand.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	b, err := effectiveBooleanValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return boolTerm(!b), nil
+}
+
+func numericValue(t rdf.Term) (float64, bool) {
+	l, ok := t.(rdf.Literal)
+	if !ok {
+		return 0, false
+	}
+	switch l.DataType.String() {
+	case xsdNS + "integer", xsdNS + "decimal", xsdNS + "double", xsdNS + "int", xsdNS + "float":
+		f, err := strconv.ParseFloat(l.String(), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// compare orders two terms, numerically if both are numeric
+func compare(a, b rdf.Term) int {
+	if x, ok := numericValue(a); ok {
+		if y, ok := numericValue(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(a.String(), b.String())
+}
+
+func equal(a, b rdf.Term) bool {
+	if x, ok := numericValue(a); ok {
+		if y, ok := numericValue(b); ok {
+			return x == y
+		}
+	}
+	return termKey(a) == termKey(b)
+}
+
+func (e *binaryExpr) evaluate(s solution) (rdf.Term, error) {
+	switch e.operator {
+	case "||", "&&":
+		// errors are tolerated if the other operand decides the result
+		l, lerr := e.left.evaluate(s)
+		var lb bool
+		if lerr == nil {
+			lb, lerr = effectiveBooleanValue(l)
+		}
+		r, rerr := e.right.evaluate(s)
+		var rb bool
+		if rerr == nil {
+			rb, rerr = effectiveBooleanValue(r)
+		}
+		if e.operator == "||" {
+			if (lerr == nil && lb) || (rerr == nil && rb) {
+				return boolTerm(true), nil
+			}
+		} else if (lerr == nil && !lb) || (rerr == nil && !rb) {
+			return boolTerm(false), nil
+		}
+		if lerr != nil {
+			return nil, lerr
+		}
+		if rerr != nil {
+			return nil, rerr
+		}
+		return boolTerm(e.operator == "&&"), nil
+	}
+	l, err := e.left.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.right.evaluate(s)
+	if err != nil {
+		return nil, err
+	}
+	switch e.operator {
+	case "=":
+		return boolTerm(equal(l, r)), nil
+	case "!=":
+		return boolTerm(!equal(l, r)), nil
+	case "<":
+		return boolTerm(compare(l, r) < 0), nil
+	case ">":
+		return boolTerm(compare(l, r) > 0), nil
+	case "<=":
+		return boolTerm(compare(l, r) <= 0), nil
+	case ">=":
+		return boolTerm(compare(l, r) >= 0), nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", e.operator)
+}
+
+func stringArg(t rdf.Term) (string, error) {
+	if t.Type() == rdf.TermBlank {
+		return "", errors.New("blank node used as string")
+	}
+	return t.String(), nil
+}
+
+func (e *callExpr) evaluate(s solution) (rdf.Term, error) {
+	if e.function == "BOUND" {
+		v, ok := e.args[0].(*variableExpr)
+		if !ok {
+			return nil, errors.New("BOUND requires a variable")
+		}
+		_, bound := s[v.name]
+		return boolTerm(bound), nil
+	}
+	if e.function == "COALESCE" {
+		for _, arg := range e.args {
+			if v, err := arg.evaluate(s); err == nil {
+				return v, nil
+			}
+		}
+		return nil, errUnbound
+	}
+	args := make([]rdf.Term, len(e.args))
+	for i, arg := range e.args {
+		v, err := arg.evaluate(s)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	switch e.function {
+	case "STR":
+		v, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return rdf.NewLiteral(v)
+	case "LANG":
+		if l, ok := args[0].(rdf.Literal); ok {
+			return rdf.NewLiteral(l.Lang())
+		}
+		return nil, errors.New("LANG of non-literal")
+	case "DATATYPE":
+		if l, ok := args[0].(rdf.Literal); ok {
+			return l.DataType, nil
+		}
+		return nil, errors.New("DATATYPE of non-literal")
+	case "ISIRI", "ISURI":
+		return boolTerm(args[0].Type() == rdf.TermIRI), nil
+	case "ISLITERAL":
+		return boolTerm(args[0].Type() == rdf.TermLiteral), nil
+	case "ISBLANK":
+		return boolTerm(args[0].Type() == rdf.TermBlank), nil
+	case "SAMETERM":
+		return boolTerm(termKey(args[0]) == termKey(args[1])), nil
+	case "LCASE", "UCASE":
+		v, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if e.function == "LCASE" {
+			return rdf.NewLiteral(strings.ToLower(v))
+		}
+		return rdf.NewLiteral(strings.ToUpper(v))
+	case "CONTAINS", "STRSTARTS", "STRENDS", "REGEX":
+		a, err := stringArg(args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := stringArg(args[1])
+		if err != nil {
+			return nil, err
+		}
+		switch e.function {
+		case "CONTAINS":
+			return boolTerm(strings.Contains(a, b)), nil
+		case "STRSTARTS":
+			return boolTerm(strings.HasPrefix(a, b)), nil
+		case "STRENDS":
+			return boolTerm(strings.HasSuffix(a, b)), nil
+		}
+		if len(args) > 2 && strings.Contains(args[2].String(), "i") {
+			b = "(?i)" + b
+		}
+		re, err := regexp.Compile(b)
+		if err != nil {
+			return nil, err
+		}
+		return boolTerm(re.MatchString(a)), nil
+	}
+	return nil, fmt.Errorf("unsupported function %s", e.function)
+}
+
+var functionArity = map[string]int{
+	"BOUND":     1,
+	"STR":       1,
+	"LANG":      1,
+	"DATATYPE":  1,
+	"ISIRI":     1,
+	"ISURI":     1,
+	"ISLITERAL": 1,
+	"ISBLANK":   1,
+	"SAMETERM":  2,
+	"LCASE":     1,
+	"UCASE":     1,
+	"CONTAINS":  2,
+	"STRSTARTS": 2,
+	"STRENDS":   2,
+	"REGEX":     -2,
+	"COALESCE":  -1,
+}
+
+// parseConstraint parses the expression of a FILTER
+func (p *parser) parseConstraint() (expression, error) {
+	if p.isPunct("(") {
+		return p.parseBrackettedExpression()
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parseBrackettedExpression() (expression, error) {
+	err := p.expectPunct("(")
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return e, p.expectPunct(")")
+}
+
+func (p *parser) parseExpression() (expression, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptPunct("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{operator: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (expression, error) {
+	left, err := p.parseRelational()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptPunct("&&") {
+		right, err := p.parseRelational()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{operator: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseRelational() (expression, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range []string{"=", "!=", "<", ">", "<=", ">="} {
+		if p.acceptPunct(op) {
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &binaryExpr{operator: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (expression, error) {
+	if p.acceptPunct("!") {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (expression, error) {
+	t := p.peek()
+	if t.kind == tokPunct && t.text == "(" {
+		return p.parseBrackettedExpression()
+	}
+	if arity, ok := functionArity[t.text]; ok && t.kind == tokKeyword {
+		p.next()
+		err := p.expectPunct("(")
+		if err != nil {
+			return nil, err
+		}
+		call := &callExpr{function: t.text}
+		for !p.acceptPunct(")") {
+			if len(call.args) > 0 {
+				err = p.expectPunct(",")
+				if err != nil {
+					return nil, err
+				}
+			}
+			arg, err := p.parseExpression()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+		}
+		if (arity > 0 && len(call.args) != arity) || (arity < 0 && len(call.args) < -arity) {
+			return nil, fmt.Errorf("wrong number of arguments for %s", t.text)
+		}
+		return call, nil
+	}
+	n, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	if n.isVar() {
+		return &variableExpr{name: n.variable}, nil
+	}
+	return &termExpr{term: n.term}, nil
+}
@@ -0,0 +1,226 @@
+package sparqltest
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIRI
+	tokPName
+	tokVar
+	tokString
+	tokLang
+	tokDatatype
+	tokNumber
+	tokBlank
+	tokKeyword
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	// text is the value of the token: the IRI without brackets, the decoded
+	// string, the variable name without ? or the upper case keyword
+	text string
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of input"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isNameChar(r rune) bool {
+	return r == '_' || r == '-' || r == '.' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// lex splits a query or update into tokens. It supports the subset of the
+// SPARQL 1.1 grammar understood by the parser.
+func lex(input string) ([]token, error) {
+	var result []token
+	pos := 0
+	for pos < len(input) {
+		r, width := utf8.DecodeRuneInString(input[pos:])
+		switch {
+		case unicode.IsSpace(r):
+			pos += width
+		case r == '#':
+			end := strings.IndexAny(input[pos:], "\n\r")
+			if end < 0 {
+				pos = len(input)
+			} else {
+				pos += end
+			}
+		case r == '<':
+			if end := iriEnd(input[pos:]); end > 0 {
+				result = append(result, token{kind: tokIRI, text: input[pos+1 : pos+end]})
+				pos += end + 1
+			} else if strings.HasPrefix(input[pos:], "<=") {
+				result = append(result, token{kind: tokPunct, text: "<="})
+				pos += 2
+			} else {
+				result = append(result, token{kind: tokPunct, text: "<"})
+				pos++
+			}
+		case r == '"' || r == '\'':
+			value, length, err := lexString(input[pos:])
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, token{kind: tokString, text: value})
+			pos += length
+		case r == '?' || r == '$':
+			end := pos + 1
+			for end < len(input) {
+				r, w := utf8.DecodeRuneInString(input[end:])
+				if r == '.' || r == '-' || !isNameChar(r) {
+					break
+				}
+				end += w
+			}
+			if end == pos+1 {
+				return nil, fmt.Errorf("invalid variable at %d", pos)
+			}
+			result = append(result, token{kind: tokVar, text: input[pos+1 : end]})
+			pos = end
+		case r == '@':
+			end := pos + 1
+			for end < len(input) && (isNameChar(rune(input[end])) && input[end] != '.') {
+				end++
+			}
+			result = append(result, token{kind: tokLang, text: input[pos+1 : end]})
+			pos = end
+		case strings.HasPrefix(input[pos:], "^^"):
+			result = append(result, token{kind: tokDatatype, text: "^^"})
+			pos += 2
+		case strings.HasPrefix(input[pos:], "_:"):
+			end := nameEnd(input, pos+2)
+			result = append(result, token{kind: tokBlank, text: input[pos+2 : end]})
+			pos = end
+		case unicode.IsDigit(r) || ((r == '-' || r == '+') && pos+1 < len(input) && unicode.IsDigit(rune(input[pos+1]))):
+			end := pos + 1
+			for end < len(input) && (unicode.IsDigit(rune(input[end])) || (input[end] == '.' && end+1 < len(input) && unicode.IsDigit(rune(input[end+1])))) {
+				end++
+			}
+			result = append(result, token{kind: tokNumber, text: input[pos:end]})
+			pos = end
+		case unicode.IsLetter(r) || r == ':':
+			end := nameEnd(input, pos)
+			name := input[pos:end]
+			if end < len(input) && input[end] == ':' {
+				// prefixed name
+				local := nameEnd(input, end+1)
+				result = append(result, token{kind: tokPName, text: input[pos:local]})
+				pos = local
+			} else if r == ':' {
+				local := nameEnd(input, pos+1)
+				result = append(result, token{kind: tokPName, text: input[pos:local]})
+				pos = local
+			} else {
+				result = append(result, token{kind: tokKeyword, text: strings.ToUpper(name)})
+				pos = end
+			}
+		default:
+			op := punctuation(input[pos:])
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at %d", r, pos)
+			}
+			result = append(result, token{kind: tokPunct, text: op})
+			pos += len(op)
+		}
+	}
+	return result, nil
+}
+
+func punctuation(input string) string {
+	for _, op := range []string{"&&", "||", "!=", ">=", "{", "}", "(", ")", ".", ";", ",", "=", ">", "!", "*"} {
+		if strings.HasPrefix(input, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// nameEnd returns the end of a name starting at pos. Names may contain dots,
+// but not end with them.
+func nameEnd(input string, pos int) int {
+	end := pos
+	for end < len(input) {
+		r, w := utf8.DecodeRuneInString(input[end:])
+		if !isNameChar(r) {
+			break
+		}
+		end += w
+	}
+	for end > pos && input[end-1] == '.' {
+		end--
+	}
+	return end
+}
+
+// iriEnd returns the position of the closing bracket of an IRI reference, or
+// -1 if the input does not start with one.
+func iriEnd(input string) int {
+	for i := 1; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '>':
+			return i
+		case c <= 0x20, c == '<', c == '"', c == '{', c == '}', c == '|', c == '^', c == '`', c == '\\':
+			return -1
+		}
+	}
+	return -1
+}
+
+func lexString(input string) (string, int, error) {
+	quote := input[0]
+	long := len(input) >= 3 && input[1] == quote && input[2] == quote
+	start := 1
+	if long {
+		start = 3
+	}
+	var b strings.Builder
+	for i := start; i < len(input); i++ {
+		c := input[i]
+		switch {
+		case c == '\\':
+			if i+1 >= len(input) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			i++
+			switch input[i] {
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 'f':
+				b.WriteByte('\f')
+			case '"', '\'', '\\':
+				b.WriteByte(input[i])
+			default:
+				return "", 0, fmt.Errorf("invalid escape sequence \\%c", input[i])
+			}
+		case c == quote && !long:
+			return b.String(), i + 1, nil
+		case c == quote && long && strings.HasPrefix(input[i:], strings.Repeat(string(quote), 3)):
+			return b.String(), i + 3, nil
+		case (c == '\n' || c == '\r') && !long:
+			return "", 0, fmt.Errorf("line break in string")
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
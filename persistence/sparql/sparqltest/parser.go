@@ -0,0 +1,724 @@
+package sparqltest
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/knakk/rdf"
+)
+
+const (
+	rdfNS = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+	xsdNS = "http://www.w3.org/2001/XMLSchema#"
+)
+
+// node is a position in a triple pattern: either a variable or a term
+type node struct {
+	variable string
+	term     rdf.Term
+}
+
+func (n node) isVar() bool {
+	return n.variable != ""
+}
+
+type triplePattern struct {
+	subj, pred, obj node
+}
+
+// quadPattern is a triple pattern of an update template. A nil graph refers
+// to the graph of the WITH clause, or the default graph.
+type quadPattern struct {
+	graph *node
+	triplePattern
+}
+
+// pattern is an element of a group graph pattern
+type pattern interface {
+	eval(ctx *evalContext, input []solution) ([]solution, error)
+}
+
+type group struct {
+	elements []pattern
+	filters  []expression
+}
+
+type triplesBlock struct {
+	triples []triplePattern
+}
+
+type graphPattern struct {
+	graph node
+	inner *group
+}
+
+type optionalPattern struct {
+	inner *group
+}
+
+type unionPattern struct {
+	branches []*group
+}
+
+type valuesPattern struct {
+	vars []string
+	// rows contain nil for UNDEF values
+	rows [][]rdf.Term
+}
+
+type bindPattern struct {
+	expr     expression
+	variable string
+}
+
+type orderCondition struct {
+	expr       expression
+	descending bool
+}
+
+type selectQuery struct {
+	distinct bool
+	vars     []string
+	where    *group
+	order    []orderCondition
+	limit    int
+	offset   int
+}
+
+type updateOperation struct {
+	with   rdf.Term
+	delete []quadPattern
+	insert []quadPattern
+	where  *group
+	// data operations have no WHERE clause
+	data bool
+	// clear removes all quads
+	clear bool
+}
+
+type parser struct {
+	tokens   []token
+	pos      int
+	prefixes map[string]string
+	base     string
+	blanks   int
+}
+
+func newParser(input string) (*parser, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{
+		tokens:   tokens,
+		prefixes: make(map[string]string),
+	}, nil
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) isKeyword(keyword string) bool {
+	t := p.peek()
+	return t.kind == tokKeyword && t.text == keyword
+}
+
+func (p *parser) isPunct(punct string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == punct
+}
+
+func (p *parser) acceptKeyword(keyword string) bool {
+	if p.isKeyword(keyword) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) acceptPunct(punct string) bool {
+	if p.isPunct(punct) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(keyword string) error {
+	if !p.acceptKeyword(keyword) {
+		return fmt.Errorf("expected %s, found %s", keyword, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) expectPunct(punct string) error {
+	if !p.acceptPunct(punct) {
+		return fmt.Errorf("expected %q, found %s", punct, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) parsePrologue() error {
+	for {
+		switch {
+		case p.acceptKeyword("PREFIX"):
+			name := p.next()
+			iri := p.next()
+			if name.kind != tokPName || !strings.HasSuffix(name.text, ":") || iri.kind != tokIRI {
+				return fmt.Errorf("invalid prefix declaration")
+			}
+			p.prefixes[strings.TrimSuffix(name.text, ":")] = p.resolve(iri.text)
+		case p.acceptKeyword("BASE"):
+			iri := p.next()
+			if iri.kind != tokIRI {
+				return fmt.Errorf("invalid base declaration")
+			}
+			p.base = iri.text
+		default:
+			return nil
+		}
+	}
+}
+
+func (p *parser) resolve(iri string) string {
+	if p.base == "" || strings.Contains(iri, ":") {
+		return iri
+	}
+	return p.base + iri
+}
+
+func (p *parser) iri(value string) (rdf.Term, error) {
+	return rdf.NewIRI(p.resolve(value))
+}
+
+func (p *parser) pname(value string) (rdf.Term, error) {
+	i := strings.Index(value, ":")
+	ns, ok := p.prefixes[value[:i]]
+	if !ok {
+		return nil, fmt.Errorf("undefined prefix: %s", value[:i])
+	}
+	return rdf.NewIRI(ns + value[i+1:])
+}
+
+// parseTerm parses an RDF term or variable
+func (p *parser) parseNode() (node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokVar:
+		return node{variable: t.text}, nil
+	case tokBlank:
+		// blank nodes act as variables that are not projected
+		return node{variable: "_:" + t.text}, nil
+	case tokIRI:
+		term, err := p.iri(t.text)
+		return node{term: term}, err
+	case tokPName:
+		term, err := p.pname(t.text)
+		return node{term: term}, err
+	case tokString:
+		term, err := p.parseLiteral(t.text)
+		return node{term: term}, err
+	case tokNumber:
+		term, err := numberLiteral(t.text)
+		return node{term: term}, err
+	case tokKeyword:
+		switch t.text {
+		case "A":
+			term, err := rdf.NewIRI(rdfNS + "type")
+			return node{term: term}, err
+		case "TRUE", "FALSE":
+			term, err := rdf.NewLiteral(t.text == "TRUE")
+			return node{term: term}, err
+		}
+	}
+	return node{}, fmt.Errorf("expected term, found %s", t)
+}
+
+func numberLiteral(text string) (rdf.Term, error) {
+	datatype := "integer"
+	if strings.Contains(text, ".") {
+		datatype = "decimal"
+	}
+	dt, err := rdf.NewIRI(xsdNS + datatype)
+	if err != nil {
+		return nil, err
+	}
+	return rdf.NewTypedLiteral(text, dt), nil
+}
+
+// parseLiteral completes a string literal with an optional language tag or datatype
+func (p *parser) parseLiteral(value string) (rdf.Term, error) {
+	switch p.peek().kind {
+	case tokLang:
+		return rdf.NewLangLiteral(value, p.next().text)
+	case tokDatatype:
+		p.next()
+		dt := p.next()
+		var iri rdf.Term
+		var err error
+		switch dt.kind {
+		case tokIRI:
+			iri, err = p.iri(dt.text)
+		case tokPName:
+			iri, err = p.pname(dt.text)
+		default:
+			err = fmt.Errorf("expected datatype, found %s", dt)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return rdf.NewTypedLiteral(value, iri.(rdf.IRI)), nil
+	}
+	return rdf.NewLiteral(value)
+}
+
+// parseTriples parses a subject with its property list
+func (p *parser) parseTriples() ([]triplePattern, error) {
+	subj, err := p.parseNode()
+	if err != nil {
+		return nil, err
+	}
+	var result []triplePattern
+	for {
+		pred, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		for {
+			obj, err := p.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, triplePattern{subj: subj, pred: pred, obj: obj})
+			if !p.acceptPunct(",") {
+				break
+			}
+		}
+		if !p.acceptPunct(";") {
+			break
+		}
+		// trailing semicolon
+		if p.isPunct(".") || p.isPunct("}") {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (p *parser) parseGroup() (*group, error) {
+	err := p.expectPunct("{")
+	if err != nil {
+		return nil, err
+	}
+	g := &group{}
+	for !p.acceptPunct("}") {
+		switch {
+		case p.acceptPunct("."):
+		case p.isPunct("{"):
+			inner, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			branches := []*group{inner}
+			for p.acceptKeyword("UNION") {
+				inner, err = p.parseGroup()
+				if err != nil {
+					return nil, err
+				}
+				branches = append(branches, inner)
+			}
+			g.elements = append(g.elements, &unionPattern{branches: branches})
+		case p.acceptKeyword("GRAPH"):
+			name, err := p.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			inner, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			g.elements = append(g.elements, &graphPattern{graph: name, inner: inner})
+		case p.acceptKeyword("OPTIONAL"):
+			inner, err := p.parseGroup()
+			if err != nil {
+				return nil, err
+			}
+			g.elements = append(g.elements, &optionalPattern{inner: inner})
+		case p.acceptKeyword("FILTER"):
+			e, err := p.parseConstraint()
+			if err != nil {
+				return nil, err
+			}
+			g.filters = append(g.filters, e)
+		case p.acceptKeyword("BIND"):
+			b, err := p.parseBind()
+			if err != nil {
+				return nil, err
+			}
+			g.elements = append(g.elements, b)
+		case p.acceptKeyword("VALUES"):
+			v, err := p.parseValues()
+			if err != nil {
+				return nil, err
+			}
+			g.elements = append(g.elements, v)
+		case p.peek().kind == tokEOF:
+			return nil, fmt.Errorf("unterminated group")
+		default:
+			triples, err := p.parseTriples()
+			if err != nil {
+				return nil, err
+			}
+			g.elements = append(g.elements, &triplesBlock{triples: triples})
+		}
+	}
+	return g, nil
+}
+
+func (p *parser) parseBind() (*bindPattern, error) {
+	err := p.expectPunct("(")
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expectKeyword("AS")
+	if err != nil {
+		return nil, err
+	}
+	v := p.next()
+	if v.kind != tokVar {
+		return nil, fmt.Errorf("expected variable, found %s", v)
+	}
+	return &bindPattern{expr: e, variable: v.text}, p.expectPunct(")")
+}
+
+func (p *parser) parseValues() (*valuesPattern, error) {
+	v := &valuesPattern{}
+	multi := p.acceptPunct("(")
+	for {
+		t := p.peek()
+		if t.kind != tokVar {
+			break
+		}
+		p.next()
+		v.vars = append(v.vars, t.text)
+		if !multi {
+			break
+		}
+	}
+	if multi {
+		err := p.expectPunct(")")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(v.vars) == 0 {
+		return nil, fmt.Errorf("VALUES without variables")
+	}
+	err := p.expectPunct("{")
+	if err != nil {
+		return nil, err
+	}
+	for !p.acceptPunct("}") {
+		if multi {
+			err = p.expectPunct("(")
+			if err != nil {
+				return nil, err
+			}
+		}
+		row := make([]rdf.Term, len(v.vars))
+		for i := range v.vars {
+			if p.acceptKeyword("UNDEF") {
+				continue
+			}
+			n, err := p.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			if n.isVar() {
+				return nil, fmt.Errorf("variable in VALUES data")
+			}
+			row[i] = n.term
+		}
+		if multi {
+			err = p.expectPunct(")")
+			if err != nil {
+				return nil, err
+			}
+		}
+		v.rows = append(v.rows, row)
+	}
+	return v, nil
+}
+
+func (p *parser) parseQuery() (*selectQuery, error) {
+	err := p.parsePrologue()
+	if err != nil {
+		return nil, err
+	}
+	err = p.expectKeyword("SELECT")
+	if err != nil {
+		return nil, err
+	}
+	q := &selectQuery{limit: -1}
+	q.distinct = p.acceptKeyword("DISTINCT") || p.acceptKeyword("REDUCED")
+	if !p.acceptPunct("*") {
+		for p.peek().kind == tokVar {
+			q.vars = append(q.vars, p.next().text)
+		}
+		if len(q.vars) == 0 {
+			return nil, fmt.Errorf("no variables selected")
+		}
+	}
+	p.acceptKeyword("WHERE")
+	q.where, err = p.parseGroup()
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("ORDER") {
+		err = p.expectKeyword("BY")
+		if err != nil {
+			return nil, err
+		}
+		for {
+			var c orderCondition
+			if p.acceptKeyword("ASC") || p.isPunct("(") {
+				c.expr, err = p.parseBrackettedExpression()
+			} else if p.acceptKeyword("DESC") {
+				c.descending = true
+				c.expr, err = p.parseBrackettedExpression()
+			} else if p.peek().kind == tokVar {
+				c.expr = &variableExpr{name: p.next().text}
+			} else {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			q.order = append(q.order, c)
+		}
+	}
+	for {
+		if p.acceptKeyword("LIMIT") {
+			q.limit, err = p.parseInt()
+		} else if p.acceptKeyword("OFFSET") {
+			q.offset, err = p.parseInt()
+		} else {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.peek().kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s after query", p.peek())
+	}
+	return q, nil
+}
+
+func (p *parser) parseInt() (int, error) {
+	t := p.next()
+	var n int
+	_, err := fmt.Sscanf(t.text, "%d", &n)
+	if t.kind != tokNumber || err != nil {
+		return 0, fmt.Errorf("expected number, found %s", t)
+	}
+	return n, nil
+}
+
+func (p *parser) parseUpdate() ([]*updateOperation, error) {
+	var result []*updateOperation
+	for {
+		err := p.parsePrologue()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind == tokEOF {
+			return result, nil
+		}
+		op, err := p.parseOperation()
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, op)
+		if !p.acceptPunct(";") {
+			if p.peek().kind != tokEOF {
+				return nil, fmt.Errorf("unexpected %s after update", p.peek())
+			}
+			return result, nil
+		}
+	}
+}
+
+func (p *parser) parseOperation() (*updateOperation, error) {
+	op := &updateOperation{}
+	var err error
+	switch {
+	case p.acceptKeyword("CLEAR"), p.acceptKeyword("DROP"):
+		p.acceptKeyword("SILENT")
+		err = p.expectKeyword("ALL")
+		op.clear = true
+		return op, err
+	case p.acceptKeyword("INSERT"):
+		if p.acceptKeyword("DATA") {
+			op.data = true
+			op.insert, err = p.parseQuads(true)
+			return op, err
+		}
+		op.insert, err = p.parseQuads(false)
+		if err != nil {
+			return nil, err
+		}
+	case p.acceptKeyword("DELETE"):
+		if p.acceptKeyword("DATA") {
+			op.data = true
+			op.delete, err = p.parseQuads(true)
+			return op, err
+		}
+		if p.isKeyword("WHERE") {
+			// DELETE WHERE uses the pattern as template
+			p.next()
+			op.delete, err = p.parseQuads(false)
+			if err != nil {
+				return nil, err
+			}
+			op.where = quadsGroup(op.delete)
+			return op, nil
+		}
+		return p.parseModify(op)
+	case p.acceptKeyword("WITH"):
+		n, err := p.parseNode()
+		if err != nil {
+			return nil, err
+		}
+		if n.isVar() {
+			return nil, fmt.Errorf("variable in WITH")
+		}
+		op.with = n.term
+		if !p.acceptKeyword("DELETE") {
+			err = p.expectKeyword("INSERT")
+			if err != nil {
+				return nil, err
+			}
+			op.insert, err = p.parseQuads(false)
+			if err != nil {
+				return nil, err
+			}
+			return op, p.parseWhere(op)
+		}
+		return p.parseModify(op)
+	default:
+		return nil, fmt.Errorf("unsupported update operation %s", p.peek())
+	}
+	return op, p.parseWhere(op)
+}
+
+// parseModify parses the rest of a DELETE { } INSERT { } WHERE { } operation
+func (p *parser) parseModify(op *updateOperation) (*updateOperation, error) {
+	var err error
+	op.delete, err = p.parseQuads(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("INSERT") {
+		op.insert, err = p.parseQuads(false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return op, p.parseWhere(op)
+}
+
+func (p *parser) parseWhere(op *updateOperation) error {
+	err := p.expectKeyword("WHERE")
+	if err != nil {
+		return err
+	}
+	op.where, err = p.parseGroup()
+	return err
+}
+
+// parseQuads parses a quad template or quad data block
+func (p *parser) parseQuads(data bool) ([]quadPattern, error) {
+	err := p.expectPunct("{")
+	if err != nil {
+		return nil, err
+	}
+	var result []quadPattern
+	for !p.acceptPunct("}") {
+		switch {
+		case p.acceptPunct("."):
+		case p.acceptKeyword("GRAPH"):
+			name, err := p.parseNode()
+			if err != nil {
+				return nil, err
+			}
+			err = p.expectPunct("{")
+			if err != nil {
+				return nil, err
+			}
+			for !p.acceptPunct("}") {
+				if p.acceptPunct(".") {
+					continue
+				}
+				triples, err := p.parseTriples()
+				if err != nil {
+					return nil, err
+				}
+				for _, t := range triples {
+					g := name
+					result = append(result, quadPattern{graph: &g, triplePattern: t})
+				}
+			}
+		case p.peek().kind == tokEOF:
+			return nil, fmt.Errorf("unterminated quad block")
+		default:
+			triples, err := p.parseTriples()
+			if err != nil {
+				return nil, err
+			}
+			for _, t := range triples {
+				result = append(result, quadPattern{triplePattern: t})
+			}
+		}
+	}
+	if data {
+		for _, q := range result {
+			for _, n := range []node{q.subj, q.pred, q.obj} {
+				if n.isVar() && !strings.HasPrefix(n.variable, "_:") {
+					return nil, fmt.Errorf("variable in data block")
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// quadsGroup converts a quad pattern to a group graph pattern
+func quadsGroup(quads []quadPattern) *group {
+	g := &group{}
+	for _, q := range quads {
+		block := &group{elements: []pattern{&triplesBlock{triples: []triplePattern{q.triplePattern}}}}
+		if q.graph != nil {
+			g.elements = append(g.elements, &graphPattern{graph: *q.graph, inner: block})
+		} else {
+			g.elements = append(g.elements, block.elements...)
+		}
+	}
+	return g
+}
@@ -0,0 +1,119 @@
+// Package sparqltest provides an in-process SPARQL 1.1 endpoint over an
+// in-memory quad store, to test code talking to a SPARQL repository without
+// running one.
+//
+// Only the subset of SPARQL needed by oauthenticator and similar simple
+// applications is supported: SELECT queries with basic graph patterns, GRAPH,
+// OPTIONAL, UNION, FILTER, BIND and VALUES, and the INSERT DATA, DELETE DATA,
+// DELETE WHERE, DELETE/INSERT (with WITH) and CLEAR ALL update operations.
+package sparqltest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/knakk/rdf"
+	"github.com/knakk/sparql"
+)
+
+// Server is a SPARQL query and update endpoint serving a Store
+type Server struct {
+	*httptest.Server
+	Store *Store
+}
+
+// NewServer starts a new endpoint over an empty store. It has to be closed
+// after use.
+func NewServer() *Server {
+	s := &Server{
+		Store: NewStore(),
+	}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+// Repo returns a repository connected to the endpoint
+func (s *Server) Repo(options ...func(*sparql.Repo) error) (*sparql.Repo, error) {
+	return sparql.NewRepo(s.URL, options...)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := r.ParseForm()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if update := r.PostForm.Get("update"); update != "" {
+		err = s.Store.Update(update)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	query := r.Form.Get("query")
+	if query == "" {
+		http.Error(w, "query or update must be provided", http.StatusBadRequest)
+		return
+	}
+	vars, solutions, err := s.Store.Query(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/sparql-results+json")
+	json.NewEncoder(w).Encode(encodeResults(vars, solutions))
+}
+
+type jsonResults struct {
+	Head struct {
+		Vars []string `json:"vars"`
+	} `json:"head"`
+	Results struct {
+		Bindings []map[string]jsonBinding `json:"bindings"`
+	} `json:"results"`
+}
+
+type jsonBinding struct {
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Lang     string `json:"xml:lang,omitempty"`
+	DataType string `json:"datatype,omitempty"`
+}
+
+func encodeTerm(t rdf.Term) jsonBinding {
+	switch term := t.(type) {
+	case rdf.IRI:
+		return jsonBinding{Type: "uri", Value: term.String()}
+	case rdf.Blank:
+		return jsonBinding{Type: "bnode", Value: term.String()}
+	case rdf.Literal:
+		b := jsonBinding{Type: "literal", Value: term.String(), Lang: term.Lang()}
+		if dt := term.DataType.String(); b.Lang == "" && dt != xsdNS+"string" {
+			b.Type = "typed-literal"
+			b.DataType = dt
+		}
+		return b
+	}
+	return jsonBinding{}
+}
+
+func encodeResults(vars []string, solutions []map[string]rdf.Term) *jsonResults {
+	result := &jsonResults{}
+	result.Head.Vars = vars
+	result.Results.Bindings = make([]map[string]jsonBinding, len(solutions))
+	for i, s := range solutions {
+		b := make(map[string]jsonBinding, len(s))
+		for name, t := range s {
+			b[name] = encodeTerm(t)
+		}
+		result.Results.Bindings[i] = b
+	}
+	return result
+}
@@ -0,0 +1,191 @@
+package sparqltest
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/knakk/rdf"
+)
+
+// defaultGraph is the key of the default graph in the store
+const defaultGraph = ""
+
+// Store is an in-memory quad store
+type Store struct {
+	lock   sync.RWMutex
+	graphs map[string]*graph
+	blanks int
+}
+
+type graph struct {
+	name    rdf.Term
+	triples map[string]rdf.Triple
+}
+
+func NewStore() *Store {
+	return &Store{
+		graphs: make(map[string]*graph),
+	}
+}
+
+func termKey(t rdf.Term) string {
+	if t == nil {
+		return defaultGraph
+	}
+	return t.Serialize(rdf.NTriples)
+}
+
+func tripleKey(t rdf.Triple) string {
+	return termKey(t.Subj) + " " + termKey(t.Pred) + " " + termKey(t.Obj)
+}
+
+// Add inserts triples into a graph, nil being the default graph
+func (s *Store) Add(g rdf.Term, triples ...rdf.Triple) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.add(g, triples...)
+}
+
+func (s *Store) add(g rdf.Term, triples ...rdf.Triple) {
+	key := termKey(g)
+	target, ok := s.graphs[key]
+	if !ok {
+		target = &graph{
+			name:    g,
+			triples: make(map[string]rdf.Triple),
+		}
+		s.graphs[key] = target
+	}
+	for _, t := range triples {
+		target.triples[tripleKey(t)] = t
+	}
+}
+
+// Remove deletes triples from a graph, nil being the default graph
+func (s *Store) Remove(g rdf.Term, triples ...rdf.Triple) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.remove(g, triples...)
+}
+
+func (s *Store) remove(g rdf.Term, triples ...rdf.Triple) {
+	key := termKey(g)
+	target, ok := s.graphs[key]
+	if !ok {
+		return
+	}
+	for _, t := range triples {
+		delete(target.triples, tripleKey(t))
+	}
+	if len(target.triples) == 0 {
+		delete(s.graphs, key)
+	}
+}
+
+// Load adds the quads read in N-Quads format. Triples without a graph are
+// added to the default graph.
+func (s *Store) Load(r io.Reader) error {
+	quads, err := rdf.NewQuadDecoder(r, rdf.NQuads).DecodeAll()
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, q := range quads {
+		var g rdf.Term = q.Ctx
+		if q.Ctx == nil || q.Ctx.String() == "" {
+			g = nil
+		}
+		s.add(g, q.Triple)
+	}
+	return nil
+}
+
+// Quads returns the contents of the store in a stable order. Triples of the
+// default graph have a nil context.
+func (s *Store) Quads() []rdf.Quad {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var result []rdf.Quad
+	for _, g := range s.sortedGraphs() {
+		var ctx rdf.Context
+		if g.name != nil {
+			ctx = g.name.(rdf.Context)
+		}
+		keys := make([]string, 0, len(g.triples))
+		for key := range g.triples {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			result = append(result, rdf.Quad{Triple: g.triples[key], Ctx: ctx})
+		}
+	}
+	return result
+}
+
+// Len returns the number of quads in the store
+func (s *Store) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	n := 0
+	for _, g := range s.graphs {
+		n += len(g.triples)
+	}
+	return n
+}
+
+// Clear removes all quads
+func (s *Store) Clear() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.graphs = make(map[string]*graph)
+}
+
+func (s *Store) sortedGraphs() []*graph {
+	keys := make([]string, 0, len(s.graphs))
+	for key := range s.graphs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*graph, len(keys))
+	for i, key := range keys {
+		result[i] = s.graphs[key]
+	}
+	return result
+}
+
+// namedGraphs returns the names of all graphs except the default one
+func (s *Store) namedGraphs() []rdf.Term {
+	var result []rdf.Term
+	for _, g := range s.sortedGraphs() {
+		if g.name != nil {
+			result = append(result, g.name)
+		}
+	}
+	return result
+}
+
+// match returns the triples of a graph matching the given terms, nil terms
+// matching anything
+func (s *Store) match(g rdf.Term, subj, pred, obj rdf.Term) []rdf.Triple {
+	target, ok := s.graphs[termKey(g)]
+	if !ok {
+		return nil
+	}
+	var result []rdf.Triple
+	for _, t := range target.triples {
+		if subj != nil && termKey(subj) != termKey(t.Subj) {
+			continue
+		}
+		if pred != nil && termKey(pred) != termKey(t.Pred) {
+			continue
+		}
+		if obj != nil && termKey(obj) != termKey(t.Obj) {
+			continue
+		}
+		result = append(result, t)
+	}
+	return result
+}
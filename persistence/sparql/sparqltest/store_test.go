@@ -0,0 +1,136 @@
+package sparqltest_test
+
+import (
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator/persistence/sparql/sparqltest"
+)
+
+const data = `
+PREFIX ex: <http://example.com/>
+INSERT DATA {
+	GRAPH ex:g1 {
+		ex:a a ex:Thing ; ex:name "A" ; ex:size 3 .
+		ex:b a ex:Thing ; ex:name "B"@en .
+		ex:c a ex:Other .
+	}
+	GRAPH ex:g2 {
+		ex:a ex:tag "x", "y" .
+	}
+}
+`
+
+func load(t *testing.T) *sparqltest.Store {
+	s := sparqltest.NewStore()
+	err := s.Update(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSelect(t *testing.T) {
+	s := load(t)
+	vars, solutions, err := s.Query(`
+		PREFIX ex: <http://example.com/>
+		SELECT ?thing ?name ?size
+		WHERE {
+			GRAPH ?g {
+				?thing a ex:Thing ; ex:name ?name .
+				OPTIONAL { ?thing ex:size ?size }
+				FILTER (!BOUND(?size) || ?size > 2)
+			}
+		} ORDER BY ?name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vars) != 3 || len(solutions) != 2 {
+		t.Fatal(vars, solutions)
+	}
+	if solutions[0]["size"].String() != "3" || solutions[1]["name"].String() != "B" {
+		t.Fatal(solutions)
+	}
+	if _, ok := solutions[1]["size"]; ok {
+		t.Fatal("optional variable bound")
+	}
+}
+
+func TestValuesAndUnion(t *testing.T) {
+	s := load(t)
+	_, solutions, err := s.Query(`
+		PREFIX ex: <http://example.com/>
+		SELECT DISTINCT ?x
+		WHERE {
+			VALUES ?g { ex:g1 }
+			GRAPH ?g {
+				{ ?x a ex:Thing } UNION { ?x a ex:Other }
+			}
+		}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(solutions) != 3 {
+		t.Fatal(solutions)
+	}
+}
+
+func TestModify(t *testing.T) {
+	s := load(t)
+	err := s.Update(`
+		PREFIX ex: <http://example.com/>
+		WITH ex:g2
+		DELETE { ?x ex:tag ?tag }
+		INSERT { ?x ex:tag "z" }
+		WHERE { ?x ex:tag ?tag }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, solutions, err := s.Query(`SELECT ?tag WHERE { GRAPH <http://example.com/g2> { ?x <http://example.com/tag> ?tag } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(solutions) != 1 || solutions[0]["tag"].String() != "z" {
+		t.Fatal(solutions)
+	}
+
+	err = s.Update(`DELETE WHERE { GRAPH ?g { ?s ?p ?o } } ; CLEAR ALL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != 0 {
+		t.Fatal(s.Quads())
+	}
+}
+
+func TestSyntaxError(t *testing.T) {
+	s := sparqltest.NewStore()
+	_, _, err := s.Query(`SELECT ?x WHERE { ?x ?y }`)
+	if err == nil {
+		t.Fatal("invalid query accepted")
+	}
+	err = s.Update(`INSERT DATA { <a> <b> ?c }`)
+	if err == nil {
+		t.Fatal("variable in data accepted")
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := sparqltest.NewServer()
+	defer srv.Close()
+	repo, err := srv.Repo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = repo.Update(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := repo.Query(`PREFIX ex: <http://example.com/> SELECT ?name WHERE { GRAPH ex:g1 { ex:b ex:name ?name } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	solutions := res.Solutions()
+	if len(solutions) != 1 || solutions[0]["name"].String() != "B" {
+		t.Fatal(solutions)
+	}
+}
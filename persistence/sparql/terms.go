@@ -0,0 +1,59 @@
+package sparql
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/knakk/rdf"
+)
+
+// iriArg validates an IRI given as a string and serializes it for use in a query
+func iriArg(iri string) (string, error) {
+	term, err := rdf.NewIRI(iri)
+	if err != nil {
+		return "", fmt.Errorf("invalid IRI %q: %w", iri, err)
+	}
+	return term.Serialize(rdf.Turtle), nil
+}
+
+// termArg serializes a term for use in a query. Only IRIs are accepted, blank
+// nodes would act as variables in query patterns.
+func termArg(term rdf.Term) (string, error) {
+	if term == nil {
+		return "", errors.New("missing term")
+	}
+	if term.Type() != rdf.TermIRI {
+		return "", fmt.Errorf("not an IRI: %s", term.Serialize(rdf.NTriples))
+	}
+	return iriArg(term.String())
+}
+
+// literalArg serializes a string as a plain literal for use in a query
+func literalArg(value string) (string, error) {
+	if !utf8.ValidString(value) {
+		return "", errors.New("literal is not valid UTF-8")
+	}
+	literal, err := rdf.NewLiteral(value)
+	if err != nil {
+		return "", err
+	}
+	return literal.Serialize(rdf.Turtle), nil
+}
+
+// binding returns the value bound to a variable in a solution, or an error if
+// the variable is not bound
+func binding(solution map[string]rdf.Term, variable string) (string, error) {
+	term, ok := solution[variable]
+	if !ok || term == nil {
+		return "", fmt.Errorf("variable not bound: %s", variable)
+	}
+	return term.String(), nil
+}
+
+// optionalBinding returns the value bound to a variable in a solution, or an
+// empty string if it is not bound
+func optionalBinding(solution map[string]rdf.Term, variable string) string {
+	value, _ := binding(solution, variable)
+	return value
+}
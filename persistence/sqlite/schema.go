@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations create and upgrade the schema, the number of migrations applied
+// is stored as the user_version of the database. Released migrations must
+// not be changed, only new ones appended.
+var migrations = []string{
+	`CREATE TABLE configs (
+		identifier TEXT PRIMARY KEY,
+		type TEXT NOT NULL DEFAULT '',
+		label TEXT NOT NULL DEFAULT '',
+		clientid TEXT NOT NULL DEFAULT '',
+		clientsecret TEXT NOT NULL DEFAULT '',
+		authurl TEXT NOT NULL DEFAULT '',
+		tokenurl TEXT NOT NULL DEFAULT '',
+		redirecturl TEXT NOT NULL DEFAULT ''
+	);
+	CREATE INDEX configs_type ON configs(type);
+	CREATE TABLE scopes (
+		config TEXT NOT NULL REFERENCES configs(identifier) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		scope TEXT NOT NULL,
+		PRIMARY KEY (config, position)
+	);
+	CREATE TABLE params (
+		config TEXT NOT NULL REFERENCES configs(identifier) ON DELETE CASCADE,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (config, key)
+	);
+	CREATE TABLE tokens (
+		config TEXT NOT NULL REFERENCES configs(identifier) ON DELETE CASCADE,
+		account TEXT NOT NULL,
+		token TEXT NOT NULL,
+		PRIMARY KEY (config, account)
+	);
+	CREATE TABLE selected (
+		config TEXT PRIMARY KEY REFERENCES configs(identifier) ON DELETE CASCADE,
+		account TEXT NOT NULL
+	);`,
+}
+
+// migrate applies the migrations missing from the database
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	err = tx.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than supported (%d)", version, len(migrations))
+	}
+	if version == len(migrations) {
+		return nil
+	}
+	for _, migration := range migrations[version:] {
+		_, err = tx.Exec(migration)
+		if err != nil {
+			return fmt.Errorf("migrating database schema from version %d: %w", version, err)
+		}
+		version++
+	}
+	// PRAGMA does not accept parameters
+	_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
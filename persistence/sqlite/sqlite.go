@@ -0,0 +1,318 @@
+// Package sqlite stores configs and tokens in a SQLite database, using a pure
+// Go driver.
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+	_ "modernc.org/sqlite"
+)
+
+// DB is a provider over a SQLite database
+type DB struct {
+	db          *sql.DB
+	redirecturl string
+	sealer      oauthenticator.Sealer
+}
+
+type Option func(*DB)
+
+// Encrypt encrypts the tokens stored in the database
+func Encrypt(sealer oauthenticator.Sealer) Option {
+	return func(d *DB) {
+		d.sealer = sealer
+	}
+}
+
+type config struct {
+	db         *DB
+	definition oauthenticator.ConfigDefinition
+}
+
+var _ oauthenticator.WritableProvider = &DB{}
+
+// Open opens or creates the database at the given path and migrates its
+// schema. The redirect URL is used for configs that do not have their own.
+func Open(path string, redirectURL string, options ...Option) (*DB, error) {
+	// ? and # in the path are escaped, SQLite decodes them
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath() + "?" + url.Values{
+		"_pragma": {"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"},
+		"_txlock": {"immediate"},
+	}.Encode()
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	err = migrate(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	d := &DB{
+		db:          db,
+		redirecturl: redirectURL,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d, nil
+}
+
+func (d *DB) Close() error {
+	return d.db.Close()
+}
+
+// update runs f in a transaction
+func (d *DB) update(f func(tx *sql.Tx) error) error {
+	tx, err := d.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	err = f(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+const selectConfigs = "SELECT identifier, type, label, clientid, clientsecret, authurl, tokenurl, redirecturl FROM configs"
+
+func (d *DB) query(q querier, where string, args ...interface{}) ([]oauthenticator.Config, error) {
+	rows, err := q.Query(selectConfigs+" "+where+" ORDER BY identifier", args...)
+	if err != nil {
+		return nil, err
+	}
+	var configs []*config
+	for rows.Next() {
+		c := &config{db: d}
+		def := &c.definition
+		err = rows.Scan(&def.Identifier, &def.Type, &def.Label, &def.ClientID, &def.ClientSecret, &def.AuthURL, &def.TokenURL, &def.RedirectURL)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		configs = append(configs, c)
+	}
+	err = rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]oauthenticator.Config, 0, len(configs))
+	for _, c := range configs {
+		err = c.loadDetails(q)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+func (c *config) loadDetails(q querier) error {
+	def := &c.definition
+	rows, err := q.Query("SELECT scope FROM scopes WHERE config = ? ORDER BY position", def.Identifier)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var scope string
+		err = rows.Scan(&scope)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		def.Scopes = append(def.Scopes, scope)
+	}
+	err = rows.Close()
+	if err != nil {
+		return err
+	}
+
+	rows, err = q.Query("SELECT key, value FROM params WHERE config = ?", def.Identifier)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, value string
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			return err
+		}
+		if def.Params == nil {
+			def.Params = make(map[string]string)
+		}
+		def.Params[key] = value
+	}
+	return rows.Err()
+}
+
+func (d *DB) Configs() ([]oauthenticator.Config, error) {
+	return d.query(d.db, "")
+}
+
+func (d *DB) ConfigsOfType(ctype string) ([]oauthenticator.Config, error) {
+	return d.query(d.db, "WHERE type = ?", ctype)
+}
+
+func (d *DB) Config(identifier string) (oauthenticator.Config, error) {
+	configs, err := d.query(d.db, "WHERE identifier = ?", identifier)
+	if err != nil {
+		return nil, err
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+	}
+	return configs[0], nil
+}
+
+var _ oauthenticator.BatchWriter = &DB{}
+
+func (d *DB) PutConfig(def oauthenticator.ConfigDefinition) (oauthenticator.Config, error) {
+	result, err := d.PutConfigs([]oauthenticator.ConfigDefinition{def})
+	if err != nil {
+		return nil, err
+	}
+	return result[0], nil
+}
+
+// PutConfigs stores the configs in a single transaction
+func (d *DB) PutConfigs(defs []oauthenticator.ConfigDefinition) ([]oauthenticator.Config, error) {
+	for _, def := range defs {
+		if def.Identifier == "" {
+			return nil, errors.New("config identifier is empty")
+		}
+	}
+	result := make([]oauthenticator.Config, len(defs))
+	err := d.update(func(tx *sql.Tx) error {
+		for i, def := range defs {
+			err := putConfig(tx, def)
+			if err != nil {
+				return err
+			}
+			configs, err := d.query(tx, "WHERE identifier = ?", def.Identifier)
+			if err != nil {
+				return err
+			}
+			result[i] = configs[0]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func putConfig(tx *sql.Tx, def oauthenticator.ConfigDefinition) error {
+	_, err := tx.Exec(`INSERT INTO configs (identifier, type, label, clientid, clientsecret, authurl, tokenurl, redirecturl)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (identifier) DO UPDATE SET type = excluded.type, label = excluded.label,
+			clientid = excluded.clientid, clientsecret = excluded.clientsecret, authurl = excluded.authurl,
+			tokenurl = excluded.tokenurl, redirecturl = excluded.redirecturl`,
+		def.Identifier, def.Type, def.Label, def.ClientID, def.ClientSecret, def.AuthURL, def.TokenURL, def.RedirectURL)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM scopes WHERE config = ?", def.Identifier)
+	if err != nil {
+		return err
+	}
+	for i, scope := range def.Scopes {
+		_, err = tx.Exec("INSERT INTO scopes (config, position, scope) VALUES (?, ?, ?)", def.Identifier, i, scope)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM params WHERE config = ?", def.Identifier)
+	if err != nil {
+		return err
+	}
+	for key, value := range def.Params {
+		_, err = tx.Exec("INSERT INTO params (config, key, value) VALUES (?, ?, ?)", def.Identifier, key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *DB) RemoveConfig(identifier string) error {
+	return d.update(func(tx *sql.Tx) error {
+		result, err := tx.Exec("DELETE FROM configs WHERE identifier = ?", identifier)
+		if err != nil {
+			return err
+		}
+		removed, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			return fmt.Errorf("%w: %s", oauthenticator.ErrNotFound, identifier)
+		}
+		return nil
+	})
+}
+
+func (c *config) Type() string {
+	return c.definition.Type
+}
+
+func (c *config) Identifier() string {
+	return c.definition.Identifier
+}
+
+func (c *config) Label() string {
+	return c.definition.Label
+}
+
+func (c *config) Config() *oauth2.Config {
+	redirectURL := c.definition.RedirectURL
+	if redirectURL == "" {
+		redirectURL = c.db.redirecturl
+	}
+	return &oauth2.Config{
+		ClientID:     c.definition.ClientID,
+		ClientSecret: c.definition.ClientSecret,
+		Endpoint:     c.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       c.definition.Scopes,
+	}
+}
+
+func (c *config) Endpoint() oauth2.Endpoint {
+	return oauth2.Endpoint{
+		AuthURL:  c.definition.AuthURL,
+		TokenURL: c.definition.TokenURL,
+	}
+}
+
+func (c *config) Token() oauthenticator.TokenPersistence {
+	return oauthenticator.SelectedToken(c.Accounts())
+}
+
+func (c *config) Accounts() oauthenticator.Accounts {
+	return &accounts{
+		db:     c.db,
+		config: c.definition.Identifier,
+	}
+}
+
+func (c *config) Options() []oauth2.AuthCodeOption {
+	var result []oauth2.AuthCodeOption
+	for key, value := range c.definition.Params {
+		result = append(result, oauth2.SetAuthURLParam(key, value))
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package sqlite_test
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/conformance"
+	"github.com/balazsgrill/oauthenticator/persistence/sqlite"
+	"golang.org/x/oauth2"
+)
+
+func open(t *testing.T, path string) *sqlite.DB {
+	db, err := sqlite.Open(path, "http://localhost:8083/verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestConformance(t *testing.T) {
+	conformance.RunWritable(t, func(t *testing.T) oauthenticator.WritableProvider {
+		return open(t, t.TempDir()+"/test.db")
+	})
+}
+
+func TestReopen(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	db := open(t, path)
+	c, err := db.PutConfig(conformance.Configs()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Token().SetToken(&oauth2.Token{AccessToken: "stored"})
+	db.Close()
+
+	db = open(t, path)
+	c, err = db.Config(conformance.Configs()[0].Identifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := c.Token().Token()
+	if err != nil || token == nil || token.AccessToken != "stored" {
+		t.Fatal(token, err)
+	}
+}
+
+func TestNewerSchema(t *testing.T) {
+	path := t.TempDir() + "/test.db"
+	open(t, path).Close()
+	raw, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = raw.Exec("PRAGMA user_version = 1000")
+	raw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqlite.Open(path, "")
+	if err == nil {
+		t.Fatal("database with newer schema opened")
+	}
+}
+
+func TestSpecialPath(t *testing.T) {
+	path := t.TempDir() + "/test?a=b#c%20d.db"
+	open(t, path)
+	_, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
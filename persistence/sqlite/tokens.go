@@ -0,0 +1,122 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+// accounts are the rows of the tokens table belonging to a config, the
+// selected one is stored in the selected table
+type accounts struct {
+	db     *DB
+	config string
+}
+
+type accountToken struct {
+	accounts *accounts
+	account  string
+}
+
+func (a *accounts) List() ([]string, error) {
+	rows, err := a.db.db.Query("SELECT account FROM tokens WHERE config = ? ORDER BY account", a.config)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	result := []string{}
+	for rows.Next() {
+		var account string
+		err = rows.Scan(&account)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, account)
+	}
+	return result, rows.Err()
+}
+
+func (a *accounts) Token(account string) oauthenticator.TokenPersistence {
+	return &accountToken{
+		accounts: a,
+		account:  account,
+	}
+}
+
+func (a *accounts) Selected() (string, error) {
+	var selected string
+	err := a.db.db.QueryRow(`SELECT s.account FROM selected s
+		JOIN tokens t ON t.config = s.config AND t.account = s.account
+		WHERE s.config = ?`, a.config).Scan(&selected)
+	if err == nil {
+		return selected, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	accounts, err := a.List()
+	if err != nil {
+		return "", err
+	}
+	return oauthenticator.SelectedAccount(accounts), nil
+}
+
+func (a *accounts) Select(account string) error {
+	return a.db.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO selected (config, account) VALUES (?, ?)
+			ON CONFLICT (config) DO UPDATE SET account = excluded.account`, a.config, account)
+		return err
+	})
+}
+
+func (a *accounts) Remove(account string) error {
+	return a.db.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM tokens WHERE config = ? AND account = ?", a.config, account)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM selected WHERE config = ? AND account = ?", a.config, account)
+		return err
+	})
+}
+
+func (at *accountToken) Token() (*oauth2.Token, error) {
+	var data string
+	err := at.accounts.db.db.QueryRow("SELECT token FROM tokens WHERE config = ? AND account = ?",
+		at.accounts.config, at.account).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return oauthenticator.OpenToken(at.accounts.db.sealer, []byte(data), at.accounts.config, at.account)
+}
+
+func (at *accountToken) SetToken(t *oauth2.Token) {
+	var err error
+	if t == nil {
+		err = at.accounts.Remove(at.account)
+	} else {
+		err = at.setToken(t)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func (at *accountToken) setToken(t *oauth2.Token) error {
+	data, err := oauthenticator.SealToken(at.accounts.db.sealer, t, at.accounts.config, at.account)
+	if err != nil {
+		return err
+	}
+	return at.accounts.db.update(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO tokens (config, account, token) VALUES (?, ?, ?)
+			ON CONFLICT (config, account) DO UPDATE SET token = excluded.token`,
+			at.accounts.config, at.account, string(data))
+		return err
+	})
+}
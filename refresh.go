@@ -0,0 +1,73 @@
+package oauthenticator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// ErrNoToken is returned by token sources if no token is stored
+var ErrNoToken = errors.New("no token stored, log in first")
+
+type refreshingTokenSource struct {
+	ctx         context.Context
+	config      *oauth2.Config
+	persistence TokenPersistence
+	lock        sync.Mutex
+}
+
+// RefreshingTokenSource returns the stored token, refreshing it with the config
+// if it is expired. Refreshed tokens are stored.
+func RefreshingTokenSource(ctx context.Context, config *oauth2.Config, tp TokenPersistence) oauth2.TokenSource {
+	return &refreshingTokenSource{
+		ctx:         ctx,
+		config:      config,
+		persistence: tp,
+	}
+}
+
+func (s *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	token, err := s.persistence.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrNoToken
+	}
+	if token.Valid() {
+		return token, nil
+	}
+	return refresh(s.ctx, s.config, s.persistence, token)
+}
+
+// Refresh refreshes the stored token even if it is still valid, and stores
+// the result
+func Refresh(ctx context.Context, config *oauth2.Config, tp TokenPersistence) (*oauth2.Token, error) {
+	token, err := tp.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrNoToken
+	}
+	return refresh(ctx, config, tp, token)
+}
+
+func refresh(ctx context.Context, config *oauth2.Config, tp TokenPersistence, token *oauth2.Token) (*oauth2.Token, error) {
+	if token.RefreshToken == "" {
+		return nil, errors.New("token can not be refreshed without a refresh token, log in again")
+	}
+	expired := *token
+	expired.Expiry = time.Now().Add(-time.Hour)
+	refreshed, err := config.TokenSource(ctx, &expired).Token()
+	if err != nil {
+		return nil, err
+	}
+	tp.SetToken(refreshed)
+	return refreshed, nil
+}
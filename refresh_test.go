@@ -0,0 +1,68 @@
+package oauthenticator_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+	"golang.org/x/oauth2"
+)
+
+func TestRefreshingTokenSource(t *testing.T) {
+	auth := oauthtest.NewServer()
+	defer auth.Close()
+	config := auth.Config("client", "", "http://localhost/callback")
+	tp := memory.NewTokenStore().Accounts("test").Token(oauthenticator.DefaultAccount)
+	ts := oauthenticator.RefreshingTokenSource(context.Background(), config, tp)
+
+	_, err := ts.Token()
+	if !errors.Is(err, oauthenticator.ErrNoToken) {
+		t.Fatal(err)
+	}
+
+	redirect, err := auth.Authorize(config.AuthCodeURL("state"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := config.Exchange(context.Background(), redirect.Query().Get("code"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.Expiry = time.Now().Add(-time.Minute)
+	tp.SetToken(token)
+
+	refreshed, err := ts.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.AccessToken == token.AccessToken || !refreshed.Valid() {
+		t.Fatal(refreshed)
+	}
+	stored, _ := tp.Token()
+	if stored.AccessToken != refreshed.AccessToken {
+		t.Fatal("refreshed token not stored")
+	}
+	requests := auth.Requests(oauthtest.EndpointToken)
+	_, err = ts.Token()
+	if err != nil || auth.Requests(oauthtest.EndpointToken) != requests {
+		t.Fatal("valid token refreshed", err)
+	}
+
+	forced, err := oauthenticator.Refresh(context.Background(), config, tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forced.AccessToken == refreshed.AccessToken {
+		t.Fatal("token not refreshed")
+	}
+
+	tp.SetToken(&oauth2.Token{AccessToken: "expired", Expiry: time.Now().Add(-time.Minute)})
+	_, err = ts.Token()
+	if err == nil {
+		t.Fatal("token without refresh token refreshed")
+	}
+}
@@ -0,0 +1,122 @@
+package oauthenticator
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/oauth2"
+)
+
+// Sealer encrypts tokens before they are persisted. Backends accept one as an
+// option, without it tokens are stored in plain text. The additional data is
+// authenticated but not encrypted, it has to be the same when opening.
+type Sealer interface {
+	Seal(plaintext []byte, additional []byte) ([]byte, error)
+	Open(ciphertext []byte, additional []byte) ([]byte, error)
+}
+
+type aesgcm struct {
+	aead cipher.AEAD
+}
+
+// NewAESSealer returns a Sealer using AES-GCM with the given 16, 24 or 32
+// byte key
+func NewAESSealer(key []byte) (Sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aesgcm{aead: aead}, nil
+}
+
+// LoadAESSealer reads a base64 encoded key from a file and returns an AES-GCM
+// Sealer using it
+func LoadAESSealer(path string) (Sealer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid key in %s: %w", path, err)
+	}
+	return NewAESSealer(key)
+}
+
+func (s *aesgcm) Seal(plaintext []byte, additional []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func (s *aesgcm) Open(ciphertext []byte, additional []byte) ([]byte, error) {
+	if len(ciphertext) < s.aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce := ciphertext[:s.aead.NonceSize()]
+	return s.aead.Open(nil, nonce, ciphertext[s.aead.NonceSize():], additional)
+}
+
+// tokenBinding is the additional data binding a sealed token to the config and
+// account it was stored for, so it can not be opened as the token of another
+func tokenBinding(config string, account string) []byte {
+	data, _ := json.Marshal([]string{config, account})
+	return data
+}
+
+// SealToken serializes a token like MarshalToken, and encrypts it if a Sealer
+// is given. The result is a JSON string holding the base64 encoded
+// ciphertext, so backends can store it wherever a plain token fits. The
+// ciphertext is bound to the identifier of the config and the account.
+func SealToken(s Sealer, t *oauth2.Token, config string, account string) ([]byte, error) {
+	data, err := MarshalToken(t)
+	if err != nil || s == nil || t == nil {
+		return data, err
+	}
+	sealed, err := s.Seal(data, tokenBinding(config, account))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(sealed))
+}
+
+// OpenToken parses a token written by SealToken for the same config and
+// account. Plain tokens are accepted even if a Sealer is given, so encryption
+// can be enabled on existing stores.
+func OpenToken(s Sealer, data []byte, config string, account string) (*oauth2.Token, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || data[0] != '"' {
+		return UnmarshalToken(data)
+	}
+	if s == nil {
+		return nil, errors.New("token is encrypted, but no key is configured")
+	}
+	var encoded string
+	err := json.Unmarshal(data, &encoded)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := s.Open(sealed, tokenBinding(config, account))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting token: %w", err)
+	}
+	return UnmarshalToken(plain)
+}
@@ -0,0 +1,57 @@
+package oauthenticator_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+func Test_sealtoken(t *testing.T) {
+	keyfile := t.TempDir() + "/key"
+	err := os.WriteFile(keyfile, []byte("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealer, err := oauthenticator.LoadAESSealer(keyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := (&oauth2.Token{AccessToken: "at"}).WithExtra(map[string]interface{}{
+		"scope": "profile",
+	})
+	data, err := oauthenticator.SealToken(sealer, token, "config", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "access_token") {
+		t.Fatal("token not encrypted")
+	}
+	opened, err := oauthenticator.OpenToken(sealer, data, "config", "alice")
+	if err != nil || opened.AccessToken != "at" || oauthenticator.GrantedScopes(opened)[0] != "profile" {
+		t.Fatal(opened, err)
+	}
+
+	other, _ := oauthenticator.NewAESSealer([]byte("fedcba9876543210"))
+	_, err = oauthenticator.OpenToken(other, data, "config", "alice")
+	if err == nil {
+		t.Fatal("opened with wrong key")
+	}
+	_, err = oauthenticator.OpenToken(sealer, data, "config", "bob")
+	if err == nil {
+		t.Fatal("opened as the token of another account")
+	}
+	_, err = oauthenticator.OpenToken(sealer, data, "other", "alice")
+	if err == nil {
+		t.Fatal("opened as the token of another config")
+	}
+
+	// tokens stored before encryption was enabled
+	plain, _ := oauthenticator.MarshalToken(token)
+	opened, err = oauthenticator.OpenToken(sealer, plain, "config", "alice")
+	if err != nil || opened.AccessToken != "at" {
+		t.Fatal(opened, err)
+	}
+}
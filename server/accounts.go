@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/balazsgrill/oauthenticator"
+)
+
+type accountStatus = oauthenticator.AccountStatus
+
+// Status values of an account
+const (
+	StatusMissing = oauthenticator.StatusMissing
+	StatusInvalid = oauthenticator.StatusInvalid
+	StatusConsent = oauthenticator.StatusConsent
+	StatusValid   = oauthenticator.StatusValid
+	StatusExpired = oauthenticator.StatusExpired
+)
+
+// sameOrigin tells if the request was not sent by a page of another origin.
+// Browsers tell the origin of POST requests, requests of other clients are
+// accepted without it.
+func sameOrigin(r *http.Request) bool {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Referer()
+	}
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// accountRequest resolves the config and account of a request, writing an
+// error response if they are not valid
+func (s *Server) accountRequest(w http.ResponseWriter, r *http.Request) (oauthenticator.Accounts, string, bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, "", false
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return nil, "", false
+	}
+	id := r.FormValue("id")
+	account := r.FormValue("account")
+	if id == "" || account == "" {
+		http.Error(w, "id and account must be provided", http.StatusBadRequest)
+		return nil, "", false
+	}
+	c := s.getConfigByID(id)
+	if c == nil {
+		http.Error(w, "unknown config: "+id, http.StatusNotFound)
+		return nil, "", false
+	}
+	return c.Accounts(), account, true
+}
+
+func (s *Server) SelectAccount(w http.ResponseWriter, r *http.Request) {
+	accounts, account, ok := s.accountRequest(w, r)
+	if !ok {
+		return
+	}
+	err := accounts.Select(account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) RemoveAccount(w http.ResponseWriter, r *http.Request) {
+	accounts, account, ok := s.accountRequest(w, r)
+	if !ok {
+		return
+	}
+	err := accounts.Remove(account)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
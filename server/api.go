@@ -0,0 +1,92 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/balazsgrill/oauthenticator"
+)
+
+type apiConfig struct {
+	Identifier string          `json:"id"`
+	Label      string          `json:"label"`
+	Type       string          `json:"type,omitempty"`
+	Accounts   []accountStatus `json:"accounts"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// ApiConfigs lists all configs with the status of their accounts
+func (s *Server) ApiConfigs(w http.ResponseWriter, r *http.Request) {
+	cs, err := s.provider.Configs()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	result := make([]apiConfig, 0, len(cs))
+	for _, c := range cs {
+		accounts, err := oauthenticator.AccountStatuses(c)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		result = append(result, apiConfig{
+			Identifier: c.Identifier(),
+			Label:      c.Label(),
+			Type:       c.Type(),
+			Accounts:   accounts,
+		})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ApiAccounts lists the accounts of the config given by the id parameter
+func (s *Server) ApiAccounts(w http.ResponseWriter, r *http.Request) {
+	id := r.FormValue("id")
+	c, err := s.provider.Config(id)
+	if err != nil || c == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown config: %s", id))
+		return
+	}
+	accounts, err := oauthenticator.AccountStatuses(c)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (s *Server) ApiSelectAccount(w http.ResponseWriter, r *http.Request) {
+	accounts, account, ok := s.accountRequest(w, r)
+	if !ok {
+		return
+	}
+	err := accounts.Select(account)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) ApiRemoveAccount(w http.ResponseWriter, r *http.Request) {
+	accounts, account, ok := s.accountRequest(w, r)
+	if !ok {
+		return
+	}
+	err := accounts.Remove(account)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
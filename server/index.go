@@ -2,8 +2,12 @@ package server
 
 import (
 	"fmt"
+	"html"
 	"net/http"
-	"time"
+	"net/url"
+	"strings"
+
+	"github.com/balazsgrill/oauthenticator"
 )
 
 const header = `
@@ -14,6 +18,14 @@ const header = `
 <body class="w3-container"><ul class="w3-ul w3-card-4 w3-margin" style="max-width:40em">
 `
 
+var statusClasses = map[string]string{
+	StatusMissing: "w3-white",
+	StatusInvalid: "w3-red",
+	StatusConsent: "w3-orange",
+	StatusValid:   "w3-green",
+	StatusExpired: "w3-yellow",
+}
+
 func (s *Server) Index(w http.ResponseWriter, r *http.Request) {
 	cs, err := s.provider.Configs()
 	if err != nil {
@@ -24,29 +36,58 @@ func (s *Server) Index(w http.ResponseWriter, r *http.Request) {
 
 	fmt.Fprint(w, header)
 	for _, c := range cs {
-		var class string
-		token, err := c.Token().Token()
+		accounts, err := oauthenticator.AccountStatuses(c)
+		// the config shows the status of the selected account
+		status := oauthenticator.AccountStatus{Status: oauthenticator.StatusMissing}
 		if err != nil {
-			class = "w3-red"
-		} else if token == nil {
-			class = "w3-white"
-		} else if token.AccessToken == "" {
-			class = "w3-red"
-		} else if token.Expiry.IsZero() || time.Now().Before(token.Expiry) {
-			class = "w3-green"
-		} else {
-			class = "w3-yellow"
+			status.Status = oauthenticator.StatusInvalid
 		}
+		for _, account := range accounts {
+			if account.Selected {
+				status = account
+			}
+		}
+		id := url.QueryEscape(c.Identifier())
 
-		fmt.Fprintf(w, "<a href=\"/auth?id=%s\">", c.Identifier())
-		fmt.Fprintf(w, "<li class=\"w3-border %s\">", class)
+		fmt.Fprintf(w, "<li class=\"w3-border %s\">", statusClasses[status.Status])
+		fmt.Fprintf(w, "<a href=\"/auth?id=%s\">", id)
 		fmt.Fprintf(w, "<p>")
 		if s.favicon != nil {
 			imgsrc := s.favicon.FaviconSrc(c.Endpoint().TokenURL)
-			fmt.Fprintf(w, "<img src=\"%s\" style=\"width:3em;height:3em;\">", imgsrc)
+			fmt.Fprintf(w, "<img src=\"%s\" style=\"width:3em;height:3em;\">", html.EscapeString(imgsrc))
 		}
-		fmt.Fprintf(w, "%s</p></li>", c.Label())
+		fmt.Fprintf(w, "%s</p>", html.EscapeString(c.Label()))
 		fmt.Fprintf(w, "</a>")
+		if len(status.Scopes) > 0 {
+			fmt.Fprintf(w, "<p class=\"w3-small\">Scopes: %s</p>", html.EscapeString(strings.Join(status.Scopes, " ")))
+		}
+		if len(status.Missing) > 0 {
+			fmt.Fprintf(w, "<p class=\"w3-small\">Consent required for: %s</p>", html.EscapeString(strings.Join(status.Missing, " ")))
+		}
+
+		if err != nil {
+			fmt.Fprintf(w, "<p class=\"w3-small\">%s</p>", html.EscapeString(err.Error()))
+		}
+		fmt.Fprint(w, "<ul class=\"w3-ul w3-small\">")
+		for _, account := range accounts {
+			name := html.EscapeString(account.Name)
+			fmt.Fprintf(w, "<li class=\"%s\">", statusClasses[account.Status])
+			if account.Selected {
+				fmt.Fprintf(w, "<b>%s</b>", name)
+			} else {
+				fmt.Fprintf(w, "%s", name)
+				fmt.Fprintf(w, accountForm, "/accounts/select", id, name, "Select")
+			}
+			fmt.Fprintf(w, accountForm, "/accounts/remove", id, name, "Remove")
+			fmt.Fprint(w, "</li>")
+		}
+		fmt.Fprint(w, "</ul>")
+		fmt.Fprintf(w, loginForm, html.EscapeString(c.Identifier()))
+		fmt.Fprint(w, "</li>")
 	}
-	fmt.Fprint(w, "</body></html>")
+	fmt.Fprint(w, "</ul></body></html>")
 }
+
+const accountForm = `<form method="post" action="%[1]s?id=%[2]s" style="display:inline"><input type="hidden" name="account" value="%[3]s"><button class="w3-button w3-tiny">%[4]s</button></form>`
+
+const loginForm = `<form method="get" action="/auth"><input type="hidden" name="id" value="%s"><input name="account" placeholder="account name"><button class="w3-button w3-tiny">Add account</button></form>`
@@ -4,28 +4,71 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"html"
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/balazsgrill/oauthenticator"
 	"github.com/google/uuid"
+	"golang.org/x/oauth2"
 )
 
 type Server struct {
 	provider      oauthenticator.Provider
-	authprocesses map[string]oauthenticator.Config
+	authprocesses map[string]authprocess
+	authlock      sync.Mutex
 	favicon       FaviconService
+	// client sends the token requests
+	client *http.Client
+	// apiKeys are required by the API, the token API is disabled if empty
+	apiKeys []string
 }
 
-func InitializeServer(serveMux *http.ServeMux, provider oauthenticator.Provider, favicon FaviconService) {
-	server := Server{
+type Option func(*Server)
+
+// HTTPClient sets the client token requests are sent with
+func HTTPClient(client *http.Client) Option {
+	return func(s *Server) {
+		s.client = client
+	}
+}
+
+// APIKeys enables the token API, and requires one of the keys from clients of
+// all API endpoints
+func APIKeys(keys ...string) Option {
+	return func(s *Server) {
+		s.apiKeys = append(s.apiKeys, keys...)
+	}
+}
+
+// authprocess is a login in progress, waiting for the redirect to /verify
+type authprocess struct {
+	config oauthenticator.Config
+	// account is the name requested by the user, empty if it should be derived from the token
+	account string
+}
+
+func InitializeServer(serveMux *http.ServeMux, provider oauthenticator.Provider, favicon FaviconService, options ...Option) {
+	server := &Server{
 		provider:      provider,
-		authprocesses: make(map[string]oauthenticator.Config),
+		authprocesses: make(map[string]authprocess),
 		favicon:       favicon,
+		client:        http.DefaultClient,
+	}
+	for _, option := range options {
+		option(server)
 	}
 	// handle route using handler function
 	serveMux.HandleFunc("/verify", server.VerifyRequest)
 	serveMux.HandleFunc("/auth", server.Authenticate)
+	serveMux.HandleFunc("/accounts/select", server.SelectAccount)
+	serveMux.HandleFunc("/accounts/remove", server.RemoveAccount)
+	serveMux.HandleFunc("/api/configs", server.requireKey(server.ApiConfigs))
+	serveMux.HandleFunc("/api/accounts", server.requireKey(server.ApiAccounts))
+	serveMux.HandleFunc("/api/accounts/select", server.requireKey(server.ApiSelectAccount))
+	serveMux.HandleFunc("/api/accounts/remove", server.requireKey(server.ApiRemoveAccount))
+	serveMux.HandleFunc("/api/token", server.ApiToken)
 	//http.HandleFunc("/proxy/", server.ApiReverseProxy)
 	serveMux.HandleFunc("/", server.Index)
 }
@@ -45,13 +88,34 @@ func (s *Server) Authenticate(w http.ResponseWriter, r *http.Request) {
 	id := query.Get("id")
 	if id == "" {
 		w.WriteHeader(http.StatusBadRequest)
-		fmt.Println("ID is not provided")
+		fmt.Fprint(w, "ID is not provided")
+		return
 	}
 	c := s.getConfigByID(id)
+	if c == nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, "Unknown config: %s", id)
+		return
+	}
+	account := query.Get("account")
 	config := c.Config()
 	state := uuid.NewString()
-	s.authprocesses[state] = c
-	http.Redirect(w, r, config.AuthCodeURL(state, c.Options()...), http.StatusTemporaryRedirect)
+	s.authlock.Lock()
+	s.authprocesses[state] = authprocess{
+		config:  c,
+		account: account,
+	}
+	s.authlock.Unlock()
+	options := c.Options()
+	token := c.Token()
+	if account != "" {
+		token = c.Accounts().Token(account)
+	}
+	if token, err := token.Token(); err == nil && len(oauthenticator.MissingScopes(config.Scopes, token)) > 0 {
+		// scopes were extended since the last login
+		options = append(options, oauth2.SetAuthURLParam("prompt", "consent"))
+	}
+	http.Redirect(w, r, config.AuthCodeURL(state, options...), http.StatusTemporaryRedirect)
 }
 
 func (s *Server) VerifyRequest(w http.ResponseWriter, r *http.Request) {
@@ -61,31 +125,33 @@ func (s *Server) VerifyRequest(w http.ResponseWriter, r *http.Request) {
 	var err error = nil
 
 	if r.URL.Query().Has("error") {
+		w.WriteHeader(http.StatusBadRequest)
 		err = fmt.Errorf("%s: %s", r.URL.Query().Get("error"), r.URL.Query().Get("error_description"))
 	}
-	if state == "" {
+	if state == "" && err == nil {
 		w.WriteHeader(http.StatusBadRequest)
 		err = errors.New("state is not provided")
 	}
-	c, ok := s.authprocesses[state]
-	if !ok {
+	s.authlock.Lock()
+	process, ok := s.authprocesses[state]
+	delete(s.authprocesses, state)
+	s.authlock.Unlock()
+	if !ok && err == nil {
 		w.WriteHeader(http.StatusBadRequest)
 		err = errors.New("invalid state")
 	}
-	config := c.Config()
-
-	// TODO Sparql client leaks HTTP Client settings
-	http.DefaultClient = &http.Client{}
 
 	if err == nil {
-		token, err := config.Exchange(context.Background(), code, c.Options()...)
+		c := process.config
+		var token *oauth2.Token
+		ctx := context.WithValue(r.Context(), oauth2.HTTPClient, s.client)
+		token, err = c.Config().Exchange(ctx, code, c.Options()...)
 		if err == nil {
-			tokenpersistence := c.Token()
-			tokenpersistence.SetToken(token)
+			_, err = oauthenticator.StoreToken(c.Accounts(), process.account, token)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
 		}
-	}
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
 	}
 
 	msg := "Auth successful"
@@ -94,5 +160,5 @@ func (s *Server) VerifyRequest(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fmt.Fprint(w, "<a href=\"/\">Return</a><br>")
-	fmt.Fprintf(w, "<pre>%s</pre>", msg)
+	fmt.Fprintf(w, "<pre>%s</pre>", html.EscapeString(msg))
 }
@@ -0,0 +1,294 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/oauthtest"
+	"github.com/balazsgrill/oauthenticator/persistence/file"
+	"github.com/balazsgrill/oauthenticator/server"
+)
+
+type testSetup struct {
+	auth     *oauthtest.Server
+	server   *httptest.Server
+	config   oauthenticator.Config
+	configid string
+}
+
+func newTestSetup(t *testing.T, options ...server.Option) *testSetup {
+	auth := oauthtest.NewServer()
+	t.Cleanup(auth.Close)
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	dir := t.TempDir()
+	data, err := json.Marshal(&file.Configdata{
+		Label_:   "test",
+		ClientID: "client",
+		AuthURL:  auth.Endpoint().AuthURL,
+		TokenURL: auth.Endpoint().TokenURL,
+		Scopes:   []string{"openid", "profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(dir+"/test.json", data, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := file.NewDirectory(dir, ts.URL+"/verify")
+	server.InitializeServer(mux, provider, nil, options...)
+	c, err := provider.Config(dir + "/test.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSetup{
+		auth:     auth,
+		server:   ts,
+		config:   c,
+		configid: dir + "/test.json",
+	}
+}
+
+// login walks through /auth, the authorization server and /verify like a browser would
+func (s *testSetup) login(t *testing.T, account string) (int, string) {
+	resp, err := http.Get(s.server.URL + "/auth?id=" + url.QueryEscape(s.configid) + "&account=" + url.QueryEscape(account))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestLogin(t *testing.T) {
+	s := newTestSetup(t)
+	status, body := s.login(t, "")
+	if status != http.StatusOK || !strings.Contains(body, "Auth successful") {
+		t.Fatal(status, body)
+	}
+	names, err := s.config.Accounts().List()
+	if err != nil || len(names) != 1 || names[0] != "user" {
+		t.Fatal(names, err)
+	}
+	token, err := s.config.Token().Token()
+	if err != nil || token == nil || token.RefreshToken == "" {
+		t.Fatal(token, err)
+	}
+	if len(oauthenticator.MissingScopes([]string{"openid", "profile"}, token)) > 0 {
+		t.Fail()
+	}
+
+	s.auth.Subject = "other"
+	status, _ = s.login(t, "work")
+	if status != http.StatusOK {
+		t.Fatal(status)
+	}
+	selected, _ := s.config.Accounts().Selected()
+	if selected != "work" {
+		t.Fatal(selected)
+	}
+}
+
+func TestLoginDenied(t *testing.T) {
+	s := newTestSetup(t)
+	s.auth.FailNext(oauthtest.EndpointAuthorize, oauthtest.Error{Code: "access_denied", Description: "user declined"})
+	status, body := s.login(t, "")
+	if status != http.StatusBadRequest || !strings.Contains(body, "access_denied") {
+		t.Fatal(status, body)
+	}
+	names, _ := s.config.Accounts().List()
+	if len(names) != 0 {
+		t.Fatal(names)
+	}
+}
+
+func TestLoginErrorEscaped(t *testing.T) {
+	s := newTestSetup(t)
+	s.auth.FailNext(oauthtest.EndpointAuthorize, oauthtest.Error{Code: "access_denied", Description: "<script>alert(1)</script>"})
+	status, body := s.login(t, "")
+	if status != http.StatusBadRequest || strings.Contains(body, "<script>") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Fatal(status, body)
+	}
+}
+
+func TestLoginTokenError(t *testing.T) {
+	s := newTestSetup(t)
+	// the client library retries the exchange with a different client authentication
+	for i := 0; i < 2; i++ {
+		s.auth.FailNext(oauthtest.EndpointToken, oauthtest.Error{Code: "invalid_grant"})
+	}
+	status, body := s.login(t, "")
+	if status != http.StatusInternalServerError || !strings.Contains(body, "invalid_grant") {
+		t.Fatal(status, body)
+	}
+}
+
+func TestApiAccounts(t *testing.T) {
+	s := newTestSetup(t)
+	s.login(t, "")
+	resp, err := http.Get(s.server.URL + "/api/accounts?id=" + url.QueryEscape(s.configid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var accounts []map[string]interface{}
+	err = json.NewDecoder(resp.Body).Decode(&accounts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 1 || accounts[0]["name"] != "user" || accounts[0]["status"] != "valid" {
+		t.Fatal(accounts)
+	}
+}
+
+// requestToken requests a token from the token API with the key
+func (s *testSetup) requestToken(t *testing.T, key string, form url.Values) (int, map[string]interface{}) {
+	req, err := http.NewRequest(http.MethodPost, s.server.URL+"/api/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+key)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	result := map[string]interface{}{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+func TestApiToken(t *testing.T) {
+	s := newTestSetup(t, server.APIKeys("key"))
+	s.login(t, "")
+	stored, err := s.config.Token().Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status, result := s.requestToken(t, "key", url.Values{"id": {s.configid}})
+	if status != http.StatusOK || result["access_token"] != stored.AccessToken || result["refresh_token"] != nil {
+		t.Fatal(status, result)
+	}
+	status, result = s.requestToken(t, "key", url.Values{"id": {s.configid}, "account": {"user"}})
+	if status != http.StatusOK || result["access_token"] != stored.AccessToken {
+		t.Fatal(status, result)
+	}
+
+	// only the stored token is refreshed if rejected
+	status, result = s.requestToken(t, "key", url.Values{"id": {s.configid}, "rejected": {"old"}})
+	if status != http.StatusOK || result["access_token"] != stored.AccessToken {
+		t.Fatal(status, result)
+	}
+	status, result = s.requestToken(t, "key", url.Values{"id": {s.configid}, "rejected": {stored.AccessToken}})
+	if status != http.StatusOK || result["access_token"] == stored.AccessToken {
+		t.Fatal(status, result)
+	}
+
+	status, _ = s.requestToken(t, "wrong", url.Values{"id": {s.configid}})
+	if status != http.StatusUnauthorized {
+		t.Fatal(status)
+	}
+	status, _ = s.requestToken(t, "key", url.Values{"id": {"unknown"}})
+	if status != http.StatusNotFound {
+		t.Fatal(status)
+	}
+	status, _ = s.requestToken(t, "key", url.Values{"id": {s.configid}, "account": {"missing"}})
+	if status != http.StatusNotFound {
+		t.Fatal(status)
+	}
+}
+
+func TestApiTokenDisabled(t *testing.T) {
+	s := newTestSetup(t)
+	s.login(t, "")
+	status, result := s.requestToken(t, "", url.Values{"id": {s.configid}})
+	if status != http.StatusNotFound || result["access_token"] != nil {
+		t.Fatal(status, result)
+	}
+}
+
+func TestApiKeys(t *testing.T) {
+	s := newTestSetup(t, server.APIKeys("key"))
+	s.login(t, "")
+	for _, path := range []string{"/api/configs", "/api/accounts?id=" + url.QueryEscape(s.configid)} {
+		for key, expected := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "key": http.StatusOK} {
+			req, err := http.NewRequest(http.MethodGet, s.server.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+key)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != expected {
+				t.Fatal(path, key, resp.Status)
+			}
+		}
+	}
+	resp, err := http.PostForm(s.server.URL+"/api/accounts/remove", url.Values{"id": {s.configid}, "account": {"user"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	names, _ := s.config.Accounts().List()
+	if resp.StatusCode != http.StatusUnauthorized || len(names) != 1 {
+		t.Fatal(resp.Status, names)
+	}
+}
+
+func TestCrossOrigin(t *testing.T) {
+	s := newTestSetup(t)
+	s.login(t, "")
+	form := url.Values{"id": {s.configid}, "account": {"user"}}
+	for _, path := range []string{"/accounts/remove", "/api/accounts/remove"} {
+		req, err := http.NewRequest(http.MethodPost, s.server.URL+path, strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", "https://attacker.example.com")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Fatal(path, resp.Status)
+		}
+	}
+	names, _ := s.config.Accounts().List()
+	if len(names) != 1 {
+		t.Fatal(names)
+	}
+
+	// forms of the index are posted from the same origin
+	req, err := http.NewRequest(http.MethodPost, s.server.URL+"/accounts/remove", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", s.server.URL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	names, _ = s.config.Accounts().List()
+	if resp.StatusCode != http.StatusOK || len(names) != 0 {
+		t.Fatal(resp.Status, names)
+	}
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/balazsgrill/oauthenticator"
+	"golang.org/x/oauth2"
+)
+
+type apiToken struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type,omitempty"`
+	Expiry      *time.Time `json:"expiry,omitempty"`
+	ExpiresIn   int64      `json:"expires_in,omitempty"`
+}
+
+// authorized tells if the request presents one of the API keys as a bearer
+// token
+func (s *Server) authorized(r *http.Request) bool {
+	key := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if key == "" {
+		return false
+	}
+	for _, k := range s.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// unauthorized rejects a request without a valid API key
+func unauthorized(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="oauthenticator"`)
+	writeJSONError(w, http.StatusUnauthorized, errors.New("invalid API key"))
+}
+
+// requireKey serves the handler only to requests presenting one of the API
+// keys, if keys are set
+func (s *Server) requireKey(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.apiKeys) > 0 && !s.authorized(r) {
+			unauthorized(w)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// ApiToken returns a valid access token of the config given by the id
+// parameter, of the account parameter or the selected account. If the
+// access token in the rejected parameter is the stored one, it is refreshed.
+// It is only served if API keys are set.
+func (s *Server) ApiToken(w http.ResponseWriter, r *http.Request) {
+	if len(s.apiKeys) == 0 {
+		writeJSONError(w, http.StatusNotFound, errors.New("the token API is disabled, no API keys are set"))
+		return
+	}
+	if !s.authorized(r) {
+		unauthorized(w)
+		return
+	}
+	id := r.FormValue("id")
+	c, err := s.provider.Config(id)
+	if err != nil || c == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown config: %s", id))
+		return
+	}
+	tp := c.Token()
+	if account := r.FormValue("account"); account != "" {
+		tp = c.Accounts().Token(account)
+	}
+
+	ctx := context.WithValue(r.Context(), oauth2.HTTPClient, s.client)
+	var token *oauth2.Token
+	if rejected := r.PostFormValue("rejected"); rejected != "" {
+		stored, err := tp.Token()
+		if err == nil && stored != nil && stored.AccessToken == rejected {
+			token, err = oauthenticator.Refresh(ctx, c.Config(), tp)
+			if err != nil {
+				writeJSONError(w, http.StatusBadGateway, err)
+				return
+			}
+		}
+	}
+	if token == nil {
+		token, err = oauthenticator.RefreshingTokenSource(ctx, c.Config(), tp).Token()
+	}
+	if errors.Is(err, oauthenticator.ErrNoToken) {
+		writeJSONError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	result := apiToken{
+		AccessToken: token.AccessToken,
+		TokenType:   token.Type(),
+	}
+	if !token.Expiry.IsZero() {
+		result.Expiry = &token.Expiry
+		result.ExpiresIn = int64(time.Until(token.Expiry).Seconds())
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,72 @@
+package oauthenticator
+
+import (
+	"time"
+)
+
+// AccountStatus describes the token stored for an account
+type AccountStatus struct {
+	Name     string     `json:"name"`
+	Selected bool       `json:"selected"`
+	Status   string     `json:"status"`
+	Expiry   *time.Time `json:"expiry,omitempty"`
+	Scopes   []string   `json:"scopes,omitempty"`
+	Missing  []string   `json:"missingscopes,omitempty"`
+}
+
+// Status values of an account
+const (
+	StatusMissing = "missing"
+	StatusInvalid = "invalid"
+	StatusConsent = "consent"
+	StatusValid   = "valid"
+	StatusExpired = "expired"
+)
+
+// TokenStatus checks the token without refreshing it
+func TokenStatus(c Config, tp TokenPersistence) AccountStatus {
+	token, err := tp.Token()
+	result := AccountStatus{
+		Scopes:  GrantedScopes(token),
+		Missing: MissingScopes(c.Config().Scopes, token),
+	}
+	if token != nil && !token.Expiry.IsZero() {
+		expiry := token.Expiry
+		result.Expiry = &expiry
+	}
+	if err != nil {
+		result.Status = StatusInvalid
+	} else if token == nil {
+		result.Status = StatusMissing
+	} else if token.AccessToken == "" {
+		result.Status = StatusInvalid
+	} else if len(result.Missing) > 0 {
+		result.Status = StatusConsent
+	} else if token.Expiry.IsZero() || time.Now().Before(token.Expiry) {
+		result.Status = StatusValid
+	} else {
+		result.Status = StatusExpired
+	}
+	return result
+}
+
+// AccountStatuses returns the status of all accounts of the config
+func AccountStatuses(c Config) ([]AccountStatus, error) {
+	accounts := c.Accounts()
+	names, err := accounts.List()
+	if err != nil {
+		return nil, err
+	}
+	selected, err := accounts.Selected()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]AccountStatus, 0, len(names))
+	for _, name := range names {
+		status := TokenStatus(c, accounts.Token(name))
+		status.Name = name
+		status.Selected = name == selected
+		result = append(result, status)
+	}
+	return result, nil
+}
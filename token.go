@@ -0,0 +1,107 @@
+package oauthenticator
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// storedToken is the persisted form of a token. oauth2.Token drops the raw
+// token response on marshalling, so the granted scopes and the id_token are
+// kept explicitly.
+type storedToken struct {
+	*oauth2.Token
+	Scope   string `json:"scope,omitempty"`
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// MarshalToken serializes a token including the scopes granted by the
+// authorization server.
+func MarshalToken(t *oauth2.Token) ([]byte, error) {
+	if t == nil {
+		return json.Marshal(t)
+	}
+	idtoken, _ := t.Extra("id_token").(string)
+	return json.Marshal(&storedToken{
+		Token:   t,
+		Scope:   strings.Join(GrantedScopes(t), " "),
+		IDToken: idtoken,
+	})
+}
+
+// UnmarshalToken parses a token serialized by MarshalToken. The granted
+// scopes are available through GrantedScopes on the result, the id_token as
+// its "id_token" extra field.
+func UnmarshalToken(data []byte) (*oauth2.Token, error) {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil, nil
+	}
+	st := &storedToken{
+		Token: &oauth2.Token{},
+	}
+	err := json.Unmarshal(data, st)
+	if err != nil {
+		return nil, err
+	}
+	extra := map[string]interface{}{}
+	if st.Scope != "" {
+		extra["scope"] = st.Scope
+	}
+	if st.IDToken != "" {
+		extra["id_token"] = st.IDToken
+	}
+	if len(extra) == 0 {
+		return st.Token, nil
+	}
+	return st.Token.WithExtra(extra), nil
+}
+
+// GrantedScopes returns the scopes granted with the token, as reported by the
+// authorization server in the "scope" field of the token response. It returns
+// nil if the server did not report them.
+func GrantedScopes(t *oauth2.Token) []string {
+	if t == nil {
+		return nil
+	}
+	scope, _ := t.Extra("scope").(string)
+	return strings.Fields(scope)
+}
+
+// MissingScopes returns the requested scopes that were not granted with the
+// token. A non-empty result means that the user has to consent again. If the
+// authorization server did not report granted scopes, they are assumed to be
+// identical to the requested ones (RFC 6749 section 5.1).
+func MissingScopes(requested []string, t *oauth2.Token) []string {
+	granted := GrantedScopes(t)
+	if len(granted) == 0 {
+		return nil
+	}
+	has := make(map[string]bool, len(granted))
+	for _, s := range granted {
+		has[s] = true
+	}
+	var missing []string
+	for _, s := range requested {
+		if !has[s] {
+			missing = append(missing, s)
+		}
+	}
+	return missing
+}
+
+// IDToken returns the id_token issued with the token and its expiry, which is
+// zero if it has no exp claim. The id_token is not verified.
+func IDToken(t *oauth2.Token) (string, time.Time, bool) {
+	claims, ok := idTokenClaims(t)
+	if !ok {
+		return "", time.Time{}, false
+	}
+	idtoken, _ := t.Extra("id_token").(string)
+	if claims.Expiry == 0 {
+		return idtoken, time.Time{}, true
+	}
+	return idtoken, time.Unix(claims.Expiry, 0), true
+}
@@ -0,0 +1,95 @@
+package oauthenticator_test
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/balazsgrill/oauthenticator"
+	"github.com/balazsgrill/oauthenticator/persistence/memory"
+	"golang.org/x/oauth2"
+)
+
+func Test_tokenscopes(t *testing.T) {
+	token := (&oauth2.Token{AccessToken: "at"}).WithExtra(map[string]interface{}{
+		"scope": "profile email",
+	})
+	data, err := oauthenticator.MarshalToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := oauthenticator.UnmarshalToken(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.AccessToken != "at" {
+		t.Fail()
+	}
+	if len(oauthenticator.GrantedScopes(loaded)) != 2 {
+		t.Fail()
+	}
+	missing := oauthenticator.MissingScopes([]string{"profile", "all"}, loaded)
+	if len(missing) != 1 || missing[0] != "all" {
+		t.Fail()
+	}
+}
+
+func Test_idtoken(t *testing.T) {
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user","exp":2000000000}`))
+	idtoken := "header." + claims + ".signature"
+	token := (&oauth2.Token{AccessToken: "at"}).WithExtra(map[string]interface{}{
+		"id_token": idtoken,
+	})
+	data, err := oauthenticator.MarshalToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := oauthenticator.UnmarshalToken(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, expiry, ok := oauthenticator.IDToken(loaded)
+	if !ok || stored != idtoken || expiry.Unix() != 2000000000 {
+		t.Fatal(stored, expiry, ok)
+	}
+	if oauthenticator.AccountName(loaded) != "user" {
+		t.Fail()
+	}
+	_, _, ok = oauthenticator.IDToken(&oauth2.Token{AccessToken: "at"})
+	if ok {
+		t.Fail()
+	}
+}
+
+func Test_storetoken(t *testing.T) {
+	c, err := memory.New(oauthenticator.ConfigDefinition{Identifier: "test"}).Config("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user"}`))
+	for i := 0; i < 2; i++ {
+		name, err := oauthenticator.StoreToken(c.Accounts(), "", (&oauth2.Token{AccessToken: "user"}).WithExtra(map[string]interface{}{
+			"id_token": "header." + claims + ".signature",
+		}))
+		if err != nil || name != "user" {
+			t.Fatal(name, err)
+		}
+	}
+	name, err := oauthenticator.StoreToken(c.Accounts(), "", &oauth2.Token{AccessToken: "first"})
+	if err != nil || name != oauthenticator.DefaultAccount {
+		t.Fatal(name, err)
+	}
+	// the token of another account does not overwrite the first one
+	_, err = oauthenticator.StoreToken(c.Accounts(), "", &oauth2.Token{AccessToken: "second"})
+	if !errors.Is(err, oauthenticator.ErrAccountRequired) {
+		t.Fatal(err)
+	}
+	token, err := c.Accounts().Token(oauthenticator.DefaultAccount).Token()
+	if err != nil || token.AccessToken != "first" {
+		t.Fatal(token, err)
+	}
+	name, err = oauthenticator.StoreToken(c.Accounts(), oauthenticator.DefaultAccount, &oauth2.Token{AccessToken: "second"})
+	if err != nil || name != oauthenticator.DefaultAccount {
+		t.Fatal(name, err)
+	}
+}